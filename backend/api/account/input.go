@@ -0,0 +1,5 @@
+package account
+
+type DeleteAccountInput struct {
+	Password string `json:"password"`
+}
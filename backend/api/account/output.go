@@ -0,0 +1,21 @@
+package account
+
+import "time"
+
+// Profile is the account itself in a data export, with the fields the API
+// never shows to other users.
+type Profile struct {
+	CreatedAt     time.Time `json:"created_at"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	Phone         string    `json:"phone"`
+	Bio           string    `json:"bio"`
+	Avatar        string    `json:"avatar"`
+	Role          string    `json:"role"`
+	SignupType    string    `json:"signup_type"`
+	ID            uint64    `json:"id"`
+	Verified      bool      `json:"verified"`
+	PhoneVerified bool      `json:"phone_verified"`
+	TOTPEnabled   bool      `json:"totp_enabled"`
+	HasPassword   bool      `json:"has_password"`
+}
@@ -0,0 +1,23 @@
+package admin
+
+type RoleInput struct {
+	Name        string   `binding:"required" json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `binding:"required" json:"permissions"`
+}
+
+type UpdateRoleInput struct {
+	Description string   `json:"description"`
+	Permissions []string `binding:"required" json:"permissions"`
+}
+
+type AssignRoleInput struct {
+	Role string `binding:"required" json:"role"`
+}
+
+// Actor is the admin performing a change, with the permissions of their
+// access token.
+type Actor struct {
+	Permissions []string
+	ID          uint64
+}
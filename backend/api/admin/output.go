@@ -0,0 +1,13 @@
+package admin
+
+type RoleOutput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	Builtin     bool     `json:"builtin"`
+}
+
+type RolesOutput struct {
+	Roles       []RoleOutput `json:"roles"`
+	Permissions []string     `json:"permissions"`
+}
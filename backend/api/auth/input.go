@@ -1,16 +1,117 @@
 package auth
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type RegisterInput struct {
 	Username string `binding:"required"       json:"username"`
 	Password string `binding:"required"       json:"password"`
 	Email    string `binding:"required,email" json:"email"`
+	Invite   string `json:"invite"`
 }
 
 type LoginInput struct {
 	Username string `binding:"required" json:"username"`
 	Password string `binding:"required" json:"password"`
+	Device   string `json:"device,omitempty"`
+}
+
+// ClientInfo describes the device a session is opened from.
+type ClientInfo struct {
+	Device    string
+	UserAgent string
+	IP        string
+}
+
+type RefreshInput struct {
+	RefreshToken string `binding:"required" json:"refresh_token"`
+}
+
+type LogoutInput struct {
+	ExpiresAt time.Time
+	SessionID string
+	TokenID   string
+	UserID    uint64
+}
+
+type TwoFactorCodeInput struct {
+	Code string `binding:"required" json:"code"`
+}
+
+// DisableTOTPInput needs the password as well as a second factor, for users
+// who have one.
+type DisableTOTPInput struct {
+	Code     string `binding:"required" json:"code"`
+	Password string `json:"password"`
+}
+
+type TwoFactorInput struct {
+	ExpiresAt time.Time
+	Code      string
+	TokenID   string
+	UserID    uint64
+}
+
+// PasskeyFinishInput carries the browser's answer to a ceremony started by
+// one of the passkey begin endpoints.
+type PasskeyFinishInput struct {
+	CeremonyID string          `binding:"required" json:"ceremony_id"`
+	Credential json.RawMessage `binding:"required" json:"credential"  swaggertype:"object"`
+	Name       string          `json:"name,omitempty"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `binding:"required,email" json:"email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `binding:"required"       json:"token"`
+	Password string `binding:"required,min=8" json:"password"`
 }
 
 type OauthInput struct {
-	Code string `binding:"required" form:"code" json:"code"`
+	Code  string `binding:"required" form:"code"  json:"code"`
+	State string `binding:"required" form:"state" json:"state"`
+}
+
+type OauthLoginInput struct {
+	Redirect string `form:"redirect" json:"redirect"`
+	Invite   string `form:"invite"   json:"invite"`
+}
+
+type EmailChangeInput struct {
+	Email    string `binding:"required,email" json:"email"`
+	Password string `json:"password"`
+}
+
+type EmailChangeConfirmInput struct {
+	Code string `binding:"required" json:"code"`
+}
+
+type EmailChangeCancelInput struct {
+	Token string `binding:"required" json:"token"`
+}
+
+type PhoneInput struct {
+	Phone string `binding:"required,e164" json:"phone"`
+}
+
+type PhoneVerifyInput struct {
+	Code string `binding:"required" json:"code"`
+}
+
+type PersonalTokenInput struct {
+	Name          string   `binding:"required,max=100"        json:"name"`
+	Scopes        []string `binding:"required,min=1"          json:"scopes"`
+	ExpiresInDays int      `binding:"omitempty,min=1,max=365" json:"expires_in_days"`
+}
+
+// InviteInput creates an invite code. MaxUses and ExpiresInHours fall back to
+// the configured defaults.
+type InviteInput struct {
+	Note           string `binding:"max=255"                  json:"note"`
+	MaxUses        int    `binding:"omitempty,min=1,max=1000" json:"max_uses"`
+	ExpiresInHours int    `binding:"omitempty,min=1,max=8760" json:"expires_in_hours"`
 }
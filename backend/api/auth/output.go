@@ -1,10 +1,30 @@
 package auth
 
+import "time"
+
 type JWTToken struct {
 	AccessToken    string         `json:"access_token"`
 	RefreshToken   string         `json:"refresh_token"`
 	IDToken        string         `json:"id_token"`
+	TwoFactorToken string         `json:"-"`
 	VerifyResponse VerifyResponse `json:"-"`
+	Redirect       string         `json:"-"`
+}
+
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_url"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// PasskeyOptions are the options to pass to navigator.credentials.create or
+// navigator.credentials.get, along with the ceremony to finish.
+type PasskeyOptions struct {
+	Options    interface{} `json:"options"`
+	CeremonyID string      `json:"ceremony_id"`
 }
 
 type VerifyResponse struct {
@@ -16,3 +36,22 @@ type VerifyResponse struct {
 func (v VerifyResponse) IsEmpty() bool {
 	return v.ID == 0 && v.Username == "" && !v.Verified
 }
+
+type PhoneOutput struct {
+	Phone    string `json:"phone"`
+	Verified bool   `json:"verified"`
+}
+
+// PersonalToken describes a personal access token. Token is only set in the
+// response to its creation.
+type PersonalToken struct {
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	LastUsedIP string     `json:"last_used_ip"`
+	Scopes     []string   `json:"scopes"`
+	ID         uint64     `json:"id"`
+}
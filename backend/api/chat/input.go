@@ -1,7 +1,8 @@
 package chat
 
 type CreateMessageInput struct {
-	Content    string `json:"content"`
-	ReceiverID uint64 `json:"to"`
-	UserID     uint64 `json:"user_id"`
+	Content        string `json:"content"`
+	IdempotencyKey string `binding:"max=64" json:"idempotency_key"`
+	ReceiverID     uint64 `json:"to"`
+	UserID         uint64 `json:"user_id"`
 }
@@ -6,13 +6,20 @@ type UpdateProfileInput struct {
 	Email  *string `json:"email,omitempty"`
 }
 
+// Verification channels. Each one has its own code, so that a code sent by
+// email cannot verify a phone number.
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
 type VerifyCodeInput struct {
-	Code   string `binding:"required" json:"code"`
-	Type   string `binding:"required" json:"type"`
-	UserID uint64 `binding:"required" json:"id"`
+	Code   string `binding:"required"                json:"code"`
+	Type   string `binding:"required,oneof=email sms" json:"type"`
+	UserID uint64 `binding:"required"                json:"id"`
 }
 
 type ResendCodeInput struct {
-	Type   string `binding:"required" json:"type"`
-	UserID uint64 `binding:"required" json:"id"`
+	Type   string `binding:"required,oneof=email sms" json:"type"`
+	UserID uint64 `binding:"required"                json:"id"`
 }
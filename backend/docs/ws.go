@@ -0,0 +1,9 @@
+package docs
+
+import _ "embed"
+
+// WSSchema is the JSON schema of the websocket protocol, kept by hand next
+// to the generated swagger docs.
+//
+//go:embed ws.schema.json
+var WSSchema []byte
@@ -17,6 +17,7 @@ type Config struct {
 	LLM      LLM      `envPrefix:"LLM_"`
 	Media    Media    `envPrefix:"MEDIA_"`
 	Mailtrap Mailtrap `envPrefix:"MAILER_"`
+	Account  Account  `envPrefix:"ACCOUNT_"`
 	Auth     Auth
 	Redis    Redis `envPrefix:"REDIS_"`
 }
@@ -26,16 +27,72 @@ type DB struct {
 }
 
 type Auth struct {
-	JWTSecret          string        `env:"JWT_SECRET"  envDefault:"secret"`
-	JWTExp             string        `env:"JWT_EXP"     envDefault:"15m"`
-	RefreshExp         string        `env:"REFRESH_EXP" envDefault:"24h"`
-	Sso                Sso           `envPrefix:"SSO_"`
-	JWTExpDuration     time.Duration `env:"-"`
-	RefreshExpDuration time.Duration `env:"-"`
+	JWTSecret              string        `env:"JWT_SECRET"         envDefault:"secret"`
+	JWTExp                 string        `env:"JWT_EXP"            envDefault:"15m"`
+	RefreshExp             string        `env:"REFRESH_EXP"        envDefault:"24h"`
+	JWTAlg                 string        `env:"JWT_ALG"            envDefault:"HS256"`
+	JWTKeyRotation         string        `env:"JWT_KEY_ROTATION"   envDefault:"168h"`
+	JWTKeyEncryptionKey    string        `env:"JWT_KEY_ENCRYPTION_KEY"`
+	TOTPIssuer             string        `env:"TOTP_ISSUER"        envDefault:"social-app"`
+	PasswordResetURL       string        `env:"PASSWORD_RESET_URL" envDefault:"http://localhost:5173/reset-password"`
+	PasswordResetExp       string        `env:"PASSWORD_RESET_EXP" envDefault:"30m"`
+	Sso                    Sso           `envPrefix:"SSO_"`
+	WebAuthn               WebAuthn      `envPrefix:"WEBAUTHN_"`
+	Lockout                Lockout       `envPrefix:"LOCKOUT_"`
+	EmailChange            EmailChange   `envPrefix:"EMAIL_CHANGE_"`
+	Registration           Registration  `envPrefix:"REGISTRATION_"`
+	JWTExpDuration         time.Duration `env:"-"`
+	RefreshExpDuration     time.Duration `env:"-"`
+	JWTKeyRotationDuration time.Duration `env:"-"`
+	PasswordResetDuration  time.Duration `env:"-"`
 }
 
 type Sso struct {
-	Google SsoGoogle `envPrefix:"GOOGLE_"`
+	Google               SsoGoogle     `envPrefix:"GOOGLE_"`
+	ProvidersRaw         string        `env:"PROVIDERS"`
+	StateExp             string        `env:"STATE_EXP"          envDefault:"10m"`
+	RedirectAllowlistRaw string        `env:"REDIRECT_ALLOWLIST" envDefault:"http://localhost:5173"`
+	Providers            []SsoProvider `env:"-"`
+	StateDuration        time.Duration `env:"-"`
+}
+
+// GetRedirectAllowlist returns the origins a login may redirect to besides
+// relative paths.
+func (s *Sso) GetRedirectAllowlist() []string {
+	return strings.Fields(s.RedirectAllowlistRaw)
+}
+
+func (s *Sso) GetProviderNames() []string {
+	return strings.FieldsFunc(strings.ToLower(s.ProvidersRaw), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// SsoProvider configures a login provider listed in SSO_PROVIDERS from its
+// SSO_<NAME>_* variables. OpenID Connect providers only need an issuer, plain
+// OAuth2 providers list their endpoints and the claims to read the profile
+// from. Well-known providers (github, gitlab) come with defaults.
+type SsoProvider struct {
+	Name          string `env:"-"`
+	Type          string `env:"TYPE"`
+	Issuer        string `env:"ISSUER"`
+	ClientID      string `env:"CLIENT_ID"`
+	ClientSecret  string `env:"CLIENT_SECRET"`
+	RedirectURL   string `env:"REDIRECT_URL"`
+	ScopesRaw     string `env:"SCOPES_RAW"`
+	AuthURL       string `env:"AUTH_URL"`
+	TokenURL      string `env:"TOKEN_URL"`
+	UserInfoURL   string `env:"USERINFO_URL"`
+	EmailsURL     string `env:"EMAILS_URL"`
+	SubjectClaim  string `env:"SUBJECT_CLAIM"`
+	EmailClaim    string `env:"EMAIL_CLAIM"`
+	NameClaim     string `env:"NAME_CLAIM"`
+	UsernameClaim string `env:"USERNAME_CLAIM"`
+	PictureClaim  string `env:"PICTURE_CLAIM"`
+}
+
+func (p *SsoProvider) GetScopes() []string {
+	return strings.Fields(p.ScopesRaw)
 }
 
 type SsoGoogle struct {
@@ -51,6 +108,64 @@ func (g *SsoGoogle) GetScopes() []string {
 	return strings.Fields(g.ScopesRaw)
 }
 
+// Lockout tunes brute-force protection: failures are counted per account and
+// per IP over Window, and each lockout of an account lasts twice as long as
+// the previous one, up to MaxDuration. Codes sent by SMS are spaced by
+// SMSCooldown and capped at SMSDailyMax a day, per account and per number.
+type Lockout struct {
+	Window              string        `env:"WINDOW"            envDefault:"15m"`
+	Duration            string        `env:"DURATION"          envDefault:"15m"`
+	MaxDuration         string        `env:"MAX_DURATION"      envDefault:"24h"`
+	SMSCooldown         string        `env:"SMS_COOLDOWN"      envDefault:"1m"`
+	MaxFailures         int64         `env:"MAX_FAILURES"      envDefault:"5"`
+	IPMaxFailures       int64         `env:"IP_MAX_FAILURES"   envDefault:"50"`
+	CodeMaxAttempts     int64         `env:"CODE_MAX_ATTEMPTS" envDefault:"5"`
+	SMSDailyMax         int64         `env:"SMS_DAILY_MAX"     envDefault:"5"`
+	WindowDuration      time.Duration `env:"-"`
+	LockDuration        time.Duration `env:"-"`
+	MaxLockDuration     time.Duration `env:"-"`
+	SMSCooldownDuration time.Duration `env:"-"`
+}
+
+// EmailChange tunes the confirmation of a new email address. The old address
+// can cancel the change, and restore itself, during CancelWindow.
+type EmailChange struct {
+	CodeExp              string        `env:"CODE_EXP"      envDefault:"15m"`
+	CancelWindow         string        `env:"CANCEL_WINDOW" envDefault:"72h"`
+	CancelURL            string        `env:"CANCEL_URL"    envDefault:"http://localhost:5173/email-change/cancel"`
+	CodeDuration         time.Duration `env:"-"`
+	CancelWindowDuration time.Duration `env:"-"`
+}
+
+// Registration modes: anyone can sign up, only with an invite code, or
+// nobody at all.
+const (
+	RegistrationOpen   = "open"
+	RegistrationInvite = "invite"
+	RegistrationClosed = "closed"
+)
+
+// Registration decides who may sign up, through the form or a login
+// provider. Users may hold InvitesPerUser active invites of up to
+// InviteMaxUses uses each; users allowed to manage invites have no limit.
+type Registration struct {
+	Mode              string        `env:"MODE"             envDefault:"open"`
+	InviteExp         string        `env:"INVITE_EXP"       envDefault:"168h"`
+	InviteMaxUses     int           `env:"INVITE_MAX_USES"  envDefault:"5"`
+	InvitesPerUser    int           `env:"INVITES_PER_USER" envDefault:"5"`
+	InviteExpDuration time.Duration `env:"-"`
+}
+
+type WebAuthn struct {
+	RPID          string `env:"RP_ID"           envDefault:"localhost"`
+	RPDisplayName string `env:"RP_DISPLAY_NAME" envDefault:"Social App"`
+	RPOriginsRaw  string `env:"RP_ORIGINS_RAW"  envDefault:"http://localhost:5173"`
+}
+
+func (w *WebAuthn) GetOrigins() []string {
+	return strings.Fields(w.RPOriginsRaw)
+}
+
 type Redis struct {
 	Host     string `env:"HOST"      envDefault:"localhost"`
 	Password string `env:"PASSWORD"  envDefault:""`
@@ -88,6 +203,15 @@ type Media struct {
 	BaseURL string `env:"BASE_URL" envDefault:"http://localhost:3222"`
 }
 
+// Account tunes account deletion: deleted accounts are kept for
+// DeletionGrace, then purged by a job running every PurgeInterval.
+type Account struct {
+	DeletionGrace         string        `env:"DELETION_GRACE" envDefault:"720h"`
+	PurgeInterval         string        `env:"PURGE_INTERVAL" envDefault:"1h"`
+	DeletionGraceDuration time.Duration `env:"-"`
+	PurgeIntervalDuration time.Duration `env:"-"`
+}
+
 func NewConfig() (*Config, error) {
 	cfg := &Config{}
 
@@ -104,6 +228,69 @@ func NewConfig() (*Config, error) {
 		return nil, fmt.Errorf("invalid REFRESH_EXP: %w", err)
 	}
 
+	if cfg.Auth.JWTKeyRotationDuration, err = time.ParseDuration(cfg.Auth.JWTKeyRotation); err != nil {
+		return nil, fmt.Errorf("invalid JWT_KEY_ROTATION: %w", err)
+	}
+
+	if cfg.Auth.PasswordResetDuration, err = time.ParseDuration(cfg.Auth.PasswordResetExp); err != nil {
+		return nil, fmt.Errorf("invalid PASSWORD_RESET_EXP: %w", err)
+	}
+
+	if cfg.Auth.Lockout.WindowDuration, err = time.ParseDuration(cfg.Auth.Lockout.Window); err != nil {
+		return nil, fmt.Errorf("invalid LOCKOUT_WINDOW: %w", err)
+	}
+
+	if cfg.Auth.Lockout.LockDuration, err = time.ParseDuration(cfg.Auth.Lockout.Duration); err != nil {
+		return nil, fmt.Errorf("invalid LOCKOUT_DURATION: %w", err)
+	}
+
+	if cfg.Auth.Lockout.MaxLockDuration, err = time.ParseDuration(cfg.Auth.Lockout.MaxDuration); err != nil {
+		return nil, fmt.Errorf("invalid LOCKOUT_MAX_DURATION: %w", err)
+	}
+
+	if cfg.Auth.Lockout.SMSCooldownDuration, err = time.ParseDuration(cfg.Auth.Lockout.SMSCooldown); err != nil {
+		return nil, fmt.Errorf("invalid LOCKOUT_SMS_COOLDOWN: %w", err)
+	}
+
+	if cfg.Auth.EmailChange.CodeDuration, err = time.ParseDuration(cfg.Auth.EmailChange.CodeExp); err != nil {
+		return nil, fmt.Errorf("invalid EMAIL_CHANGE_CODE_EXP: %w", err)
+	}
+
+	if cfg.Auth.EmailChange.CancelWindowDuration, err = time.ParseDuration(cfg.Auth.EmailChange.CancelWindow); err != nil {
+		return nil, fmt.Errorf("invalid EMAIL_CHANGE_CANCEL_WINDOW: %w", err)
+	}
+
+	switch cfg.Auth.Registration.Mode {
+	case RegistrationOpen, RegistrationInvite, RegistrationClosed:
+	default:
+		return nil, fmt.Errorf("invalid REGISTRATION_MODE %q: expected open, invite or closed", cfg.Auth.Registration.Mode)
+	}
+
+	if cfg.Auth.Registration.InviteExpDuration, err = time.ParseDuration(cfg.Auth.Registration.InviteExp); err != nil {
+		return nil, fmt.Errorf("invalid REGISTRATION_INVITE_EXP: %w", err)
+	}
+
+	if cfg.Account.DeletionGraceDuration, err = time.ParseDuration(cfg.Account.DeletionGrace); err != nil {
+		return nil, fmt.Errorf("invalid ACCOUNT_DELETION_GRACE: %w", err)
+	}
+
+	if cfg.Account.PurgeIntervalDuration, err = time.ParseDuration(cfg.Account.PurgeInterval); err != nil {
+		return nil, fmt.Errorf("invalid ACCOUNT_PURGE_INTERVAL: %w", err)
+	}
+
+	if cfg.Auth.Sso.StateDuration, err = time.ParseDuration(cfg.Auth.Sso.StateExp); err != nil {
+		return nil, fmt.Errorf("invalid SSO_STATE_EXP: %w", err)
+	}
+
+	for _, name := range cfg.Auth.Sso.GetProviderNames() {
+		provider := SsoProvider{Name: name}
+		prefix := "SSO_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		if err := env.ParseWithOptions(&provider, env.Options{Prefix: prefix}); err != nil {
+			return nil, fmt.Errorf("invalid %s* variables: %w", prefix, err)
+		}
+		cfg.Auth.Sso.Providers = append(cfg.Auth.Sso.Providers, provider)
+	}
+
 	cfg.Auth.Sso.Google.Endpoint = google.Endpoint
 
 	return cfg, nil
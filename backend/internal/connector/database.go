@@ -37,6 +37,14 @@ func ConnectDatabase(dsn string) (*gorm.DB, error) {
 		&models.Message{},
 		&models.Notification{},
 		&models.Media{},
+		&models.Session{},
+		&models.RecoveryCode{},
+		&models.WebAuthnCredential{},
+		&models.Identity{},
+		&models.Role{},
+		&models.EmailChange{},
+		&models.PersonalAccessToken{},
+		&models.Invite{},
 	); err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
@@ -94,6 +94,14 @@ func (rc *RedisConnector) SetIfNotExists(ctx context.Context, key, value string)
 	return result, nil
 }
 
+func (rc *RedisConnector) SetNX(ctx context.Context, key, value string, exp time.Duration) (bool, error) {
+	result, err := rc.client.SetNX(ctx, key, value, exp).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to set key %s if not exists: %w", key, err)
+	}
+	return result, nil
+}
+
 func (rc *RedisConnector) IsExists(ctx context.Context, key string) (bool, error) {
 	exists, err := rc.client.Exists(ctx, key).Result()
 	if err != nil {
@@ -101,3 +109,106 @@ func (rc *RedisConnector) IsExists(ctx context.Context, key string) (bool, error
 	}
 	return exists == 1, nil
 }
+
+func (rc *RedisConnector) Expire(ctx context.Context, key string, exp time.Duration) error {
+	if err := rc.client.Expire(ctx, key, exp).Err(); err != nil {
+		return fmt.Errorf("failed to set expiration on key %s: %w", key, err)
+	}
+	return nil
+}
+
+func (rc *RedisConnector) SAdd(ctx context.Context, key string, members ...string) error {
+	if err := rc.client.SAdd(ctx, key, members).Err(); err != nil {
+		return fmt.Errorf("failed to add members to set %s: %w", key, err)
+	}
+	return nil
+}
+
+func (rc *RedisConnector) SRem(ctx context.Context, key string, members ...string) error {
+	if err := rc.client.SRem(ctx, key, members).Err(); err != nil {
+		return fmt.Errorf("failed to remove members from set %s: %w", key, err)
+	}
+	return nil
+}
+
+func (rc *RedisConnector) SMembers(ctx context.Context, key string) ([]string, error) {
+	members, err := rc.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of set %s: %w", key, err)
+	}
+	return members, nil
+}
+
+// Incr increments a counter and starts its expiration when it is created.
+func (rc *RedisConnector) Incr(ctx context.Context, key string, exp time.Duration) (int64, error) {
+	n, err := rc.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment key %s: %w", key, err)
+	}
+	if n == 1 {
+		if err := rc.client.Expire(ctx, key, exp).Err(); err != nil {
+			return 0, fmt.Errorf("failed to set expiration on key %s: %w", key, err)
+		}
+	}
+	return n, nil
+}
+
+// TTL returns the remaining lifetime of a key, or zero when it does not exist
+// or never expires.
+func (rc *RedisConnector) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := rc.client.TTL(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get TTL of key %s: %w", key, err)
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (rc *RedisConnector) Publish(ctx context.Context, channel string, message []byte) error {
+	if err := rc.client.Publish(ctx, channel, message).Err(); err != nil {
+		return fmt.Errorf("failed to publish to channel %s: %w", channel, err)
+	}
+	return nil
+}
+
+// Subscribe listens to the channels until the returned PubSub is closed.
+func (rc *RedisConnector) Subscribe(ctx context.Context, channels ...string) (*redis.PubSub, error) {
+	ps := rc.client.Subscribe(ctx, channels...)
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return nil, fmt.Errorf("failed to subscribe to channels %v: %w", channels, err)
+	}
+	return ps, nil
+}
+
+// appendSeqScript numbers an entry with the next value of a counter and adds
+// it to a stream under the ID "<seq>-0", atomically so that IDs follow the
+// counter. The stream keeps its last ARGV[1] entries.
+var appendSeqScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[2])
+redis.call('XADD', KEYS[1], 'MAXLEN', ARGV[1], seq .. '-0', 'data', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return seq
+`)
+
+// AppendSeq adds data to a capped stream under the next sequence number of
+// seqKey and returns it. Both keys expire after exp without appends.
+func (rc *RedisConnector) AppendSeq(ctx context.Context, stream, seqKey string, maxLen int64, exp time.Duration, data []byte) (int64, error) {
+	seq, err := appendSeqScript.Run(ctx, rc.client, []string{stream, seqKey}, maxLen, data, exp.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to append to stream %s: %w", stream, err)
+	}
+	return seq, nil
+}
+
+// XRange returns up to count entries of a stream between two IDs, inclusive.
+func (rc *RedisConnector) XRange(ctx context.Context, stream, start, stop string, count int64) ([]redis.XMessage, error) {
+	entries, err := rc.client.XRangeN(ctx, stream, start, stop, count).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stream %s: %w", stream, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,55 @@
+package connector
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"social-app/internal/config"
+)
+
+func TestAppendSeq(t *testing.T) {
+	mr := miniredis.RunT(t)
+	host, port, _ := net.SplitHostPort(mr.Addr())
+	p, _ := strconv.Atoi(port)
+	rc := NewRedisConnector(config.Redis{Host: host, Port: p})
+	ctx := context.Background()
+
+	for want := int64(1); want <= 5; want++ {
+		seq, err := rc.AppendSeq(ctx, "stream", "seq", 3, time.Hour, []byte(strconv.FormatInt(want, 10)))
+		if err != nil {
+			t.Fatalf("AppendSeq failed: %v", err)
+		}
+		if seq != want {
+			t.Fatalf("Expected seq %d, got %d", want, seq)
+		}
+	}
+
+	// The stream keeps the last entries, each under its seq.
+	entries, err := rc.XRange(ctx, "stream", "-", "+", 10)
+	if err != nil {
+		t.Fatalf("XRange failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	for i, entry := range entries {
+		want := strconv.Itoa(i + 3)
+		if entry.ID != want+"-0" || entry.Values["data"] != want {
+			t.Errorf("Unexpected entry %s: %v", entry.ID, entry.Values)
+		}
+	}
+
+	for _, key := range []string{"stream", "seq"} {
+		if ttl := mr.TTL(key); ttl != time.Hour {
+			t.Errorf("Expected %s to expire in an hour, got %s", key, ttl)
+		}
+	}
+	mr.FastForward(time.Hour)
+	if mr.Exists("stream") || mr.Exists("seq") {
+		t.Error("Expected the stream and its counter to expire together")
+	}
+}
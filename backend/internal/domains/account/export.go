@@ -0,0 +1,103 @@
+package account
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+
+	"social-app/api/account"
+	"social-app/internal/models"
+)
+
+// Export is the data of a user, written as a zip archive of JSON files with
+// the uploaded media files under media/.
+type Export struct {
+	Profile        account.Profile
+	Posts          []models.Post
+	Comments       []models.Comment
+	Likes          []models.Like
+	Messages       []models.Message
+	Notifications  []models.Notification
+	Medias         []models.Media
+	Sessions       []models.Session
+	Identities     []models.Identity
+	Passkeys       []models.WebAuthnCredential
+	PersonalTokens []models.PersonalAccessToken
+	Invites        []models.Invite
+}
+
+func (e Export) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", e.Profile},
+		{"posts.json", e.Posts},
+		{"comments.json", e.Comments},
+		{"likes.json", e.Likes},
+		{"messages.json", e.Messages},
+		{"notifications.json", e.Notifications},
+		{"media.json", e.Medias},
+		{"sessions.json", e.Sessions},
+		{"identities.json", e.Identities},
+		{"passkeys.json", e.Passkeys},
+		{"tokens.json", e.PersonalTokens},
+		{"invites.json", e.Invites},
+	}
+	for _, f := range files {
+		if err := writeJSON(zw, f.name, f.data); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range e.Medias {
+		if err := writeFile(zw, path.Join("media", m.FileName), m.FilePath); err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to close export archive: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(zw *zip.Writer, name string, data interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to export: %w", name, err)
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		return fmt.Errorf("failed to write %s to export: %w", name, err)
+	}
+	return nil
+}
+
+// writeFile copies a media file into the archive. Files missing from the disk
+// are skipped: their metadata is still in media.json.
+func writeFile(zw *zip.Writer, name, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		log.Printf("[Account] Skipping media file %s in export: %v", src, err)
+		return nil
+	}
+	defer in.Close()
+
+	out, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to export: %w", name, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("failed to write %s to export: %w", name, err)
+	}
+	return nil
+}
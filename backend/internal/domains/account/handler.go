@@ -0,0 +1,132 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"social-app/api/account"
+	authapi "social-app/api/auth"
+	"social-app/internal/domains/auth"
+	"social-app/pkg/middleware"
+)
+
+type Handler struct {
+	usecase UseCase
+}
+
+func NewHandler(uc UseCase) Handler {
+	return Handler{
+		usecase: uc,
+	}
+}
+
+// DeleteAccount godoc
+// @Summary      Delete the current account
+// @Description  Hide the account and its content and revoke every session. Everything is purged for good after the grace period. Users with a password have to give it.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input body account.DeleteAccountInput false "Current password"
+// @Success      202 {object} map[string]interface{} "purge_at"
+// @Failure      401 {object} map[string]string "Invalid password"
+// @Failure      429 {object} map[string]string "Too many attempts"
+// @Failure      500 {object} map[string]string "Failed to delete account"
+// @Router       /me [delete]
+// @Security BearerAuth
+func (h Handler) DeleteAccount(c *middleware.Context) {
+	var input account.DeleteAccountInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+			return
+		}
+	}
+
+	client := authapi.ClientInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+	purgeAt, err := h.usecase.DeleteAccount(c.Request.Context(), c.User.ID, input, client)
+	if err != nil {
+		var attempts *auth.AttemptsError
+		switch {
+		case errors.As(err, &attempts):
+			c.Writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(attempts.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, try again later"})
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		case errors.Is(err, ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "account deleted", "purge_at": purgeAt})
+}
+
+// ExportAccount godoc
+// @Summary      Export the current account
+// @Description  Download a zip archive with everything tied to the account as JSON, and the uploaded media files
+// @Tags         users
+// @Produce      application/zip
+// @Success      200 {file} file "Zip archive"
+// @Failure      500 {object} map[string]string "Failed to export account"
+// @Router       /me/export [get]
+// @Security BearerAuth
+func (h Handler) ExportAccount(c *middleware.Context) {
+	exp, err := h.usecase.Export(c.Request.Context(), c.User.ID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		return
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "application/zip")
+	header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="social-app-export-%d.zip"`, c.User.ID))
+	c.Writer.WriteHeader(http.StatusOK)
+
+	// The status is already sent: a failure can only cut the archive short.
+	if err := exp.WriteZip(c.Writer); err != nil {
+		log.Printf("[Account] Failed to write export of user %d: %v", c.User.ID, err)
+	}
+}
+
+// RestoreAccount godoc
+// @Summary      Restore a deleted account
+// @Description  Bring back an account and its content during the grace period. Requires users:manage.
+// @Tags         admin
+// @Produce      json
+// @Param        id path int true "User ID"
+// @Success      200 {object} map[string]string "account restored"
+// @Failure      400 {object} map[string]string "Invalid user ID"
+// @Failure      403 {object} map[string]string "Forbidden"
+// @Failure      404 {object} map[string]string "No account deleted during the grace period"
+// @Failure      500 {object} map[string]string "Failed to restore account"
+// @Router       /admin/users/{id}/restore [post]
+// @Security BearerAuth
+func (h Handler) RestoreAccount(c *middleware.Context) {
+	userID, err := c.GetUint64("id")
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.usecase.RestoreAccount(c.Request.Context(), userID); err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No account deleted during the grace period"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "account restored"})
+}
@@ -0,0 +1,51 @@
+package account
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"social-app/internal/config"
+)
+
+// Purger removes deleted accounts once their grace period is over.
+type Purger struct {
+	usecase  UseCase
+	interval time.Duration
+}
+
+func NewPurger(uc UseCase, cfg config.Account) Purger {
+	return Purger{
+		usecase:  uc,
+		interval: cfg.PurgeIntervalDuration,
+	}
+}
+
+// Start purges every interval until ctx is done. A zero interval disables
+// purging.
+func (p Purger) Start(ctx context.Context) {
+	if p.interval <= 0 {
+		log.Println("[Account] Purge disabled")
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[Account] Purger stopped by context cancellation")
+			return
+		case <-ticker.C:
+			n, err := p.usecase.Purge(ctx)
+			if err != nil {
+				log.Printf("[Account] Failed to purge deleted accounts: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("[Account] Purged %d deleted accounts", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"social-app/internal/connector"
+	"social-app/internal/models"
+)
+
+type AccountRepository interface {
+	GetUser(ctx context.Context, id uint64) (models.User, error)
+	SoftDelete(ctx context.Context, userID uint64) error
+	Restore(ctx context.Context, userID uint64, since time.Time) (bool, error)
+	GetDeletedBefore(ctx context.Context, before time.Time) ([]uint64, error)
+	Purge(ctx context.Context, userID uint64) ([]string, error)
+	GetPosts(ctx context.Context, userID uint64) ([]models.Post, error)
+	GetComments(ctx context.Context, userID uint64) ([]models.Comment, error)
+	GetLikes(ctx context.Context, userID uint64) ([]models.Like, error)
+	GetMessages(ctx context.Context, userID uint64) ([]models.Message, error)
+	GetNotifications(ctx context.Context, userID uint64) ([]models.Notification, error)
+	GetMedias(ctx context.Context, userID uint64) ([]models.Media, error)
+	GetSessions(ctx context.Context, userID uint64) ([]models.Session, error)
+	GetIdentities(ctx context.Context, userID uint64) ([]models.Identity, error)
+	GetPasskeys(ctx context.Context, userID uint64) ([]models.WebAuthnCredential, error)
+	GetPersonalTokens(ctx context.Context, userID uint64) ([]models.PersonalAccessToken, error)
+	GetInvites(ctx context.Context, userID uint64) ([]models.Invite, error)
+}
+
+type Repository struct {
+	conn connector.DBConn
+}
+
+func NewRepository(con connector.DBConn) Repository {
+	return Repository{
+		conn: con,
+	}
+}
+
+// GetUser returns a zero User when there is none with the ID.
+func (r Repository) GetUser(ctx context.Context, id uint64) (models.User, error) {
+	var user models.User
+	if err := r.conn.DB.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.User{}, nil
+		}
+		return models.User{}, fmt.Errorf("failed to get user %d: %w", id, err)
+	}
+	return user, nil
+}
+
+// SoftDelete hides the user along with their posts, comments and media. They
+// all get the same deletion time so that Restore can bring back exactly what
+// was hidden with the account.
+func (r Repository) SoftDelete(ctx context.Context, userID uint64) error {
+	now := time.Now()
+	return r.conn.DB.Transaction(func(tx *gorm.DB) error {
+		for _, m := range []interface{}{&models.Post{}, &models.Comment{}, &models.Media{}} {
+			err := tx.Model(m).
+				Where("user_id = ?", userID).
+				Update("deleted_at", now).Error
+			if err != nil {
+				return fmt.Errorf("failed to soft delete content of user %d: %w", userID, err)
+			}
+		}
+
+		err := tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Updates(map[string]interface{}{"deleted_at": now, "active": false}).Error
+		if err != nil {
+			return fmt.Errorf("failed to soft delete user %d: %w", userID, err)
+		}
+		return nil
+	})
+}
+
+// Restore undoes SoftDelete for a user deleted after since. It reports false
+// when there is no such user.
+func (r Repository) Restore(ctx context.Context, userID uint64, since time.Time) (bool, error) {
+	var user models.User
+	err := r.conn.DB.Unscoped().
+		Where("id = ? AND deleted_at IS NOT NULL AND deleted_at > ?", userID, since).
+		First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get deleted user %d: %w", userID, err)
+	}
+
+	err = r.conn.DB.Transaction(func(tx *gorm.DB) error {
+		for _, m := range []interface{}{&models.Post{}, &models.Comment{}, &models.Media{}} {
+			err := tx.Unscoped().Model(m).
+				Where("user_id = ? AND deleted_at = ?", userID, user.DeletedAt.Time).
+				Update("deleted_at", nil).Error
+			if err != nil {
+				return fmt.Errorf("failed to restore content of user %d: %w", userID, err)
+			}
+		}
+
+		err := tx.Unscoped().Model(&models.User{}).
+			Where("id = ?", userID).
+			Updates(map[string]interface{}{"deleted_at": nil, "active": true}).Error
+		if err != nil {
+			return fmt.Errorf("failed to restore user %d: %w", userID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r Repository) GetDeletedBefore(ctx context.Context, before time.Time) ([]uint64, error) {
+	var ids []uint64
+	err := r.conn.DB.Unscoped().Model(&models.User{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted users: %w", err)
+	}
+	return ids, nil
+}
+
+// Purge removes the user and everything tied to them for good: their posts
+// with the comments and likes on them, their own comments and likes, both
+// sides of their conversations, notifications, media, invites and login
+// data. Users they invited are kept, without an inviter. It returns the paths of the media files, to remove once the rows are gone.
+func (r Repository) Purge(ctx context.Context, userID uint64) ([]string, error) {
+	var paths []string
+	err := r.conn.DB.Transaction(func(tx *gorm.DB) error {
+		var postIDs, mediaIDs []uint64
+		if err := tx.Unscoped().Model(&models.Post{}).Where("user_id = ?", userID).Pluck("id", &postIDs).Error; err != nil {
+			return fmt.Errorf("failed to get posts of user %d: %w", userID, err)
+		}
+		var medias []models.Media
+		if err := tx.Unscoped().Where("user_id = ?", userID).Find(&medias).Error; err != nil {
+			return fmt.Errorf("failed to get media of user %d: %w", userID, err)
+		}
+		for _, m := range medias {
+			mediaIDs = append(mediaIDs, m.ID)
+			paths = append(paths, m.FilePath)
+		}
+
+		// IDs start at 1, so 0 keeps the IN lists valid when they are empty.
+		postIDs, mediaIDs = append(postIDs, 0), append(mediaIDs, 0)
+
+		err := tx.Exec("DELETE FROM post_medias WHERE post_id IN (?) OR media_id IN (?)", postIDs, mediaIDs).Error
+		if err != nil {
+			return fmt.Errorf("failed to unlink media of user %d: %w", userID, err)
+		}
+
+		err = tx.Unscoped().Model(&models.User{}).Where("invited_by_id = ?", userID).Update("invited_by_id", nil).Error
+		if err != nil {
+			return fmt.Errorf("failed to unlink users invited by user %d: %w", userID, err)
+		}
+
+		deletes := []struct {
+			model interface{}
+			query string
+			args  []interface{}
+		}{
+			{&models.Like{}, "user_id = ? OR post_id IN (?)", []interface{}{userID, postIDs}},
+			{&models.Comment{}, "user_id = ? OR post_id IN (?)", []interface{}{userID, postIDs}},
+			{&models.Post{}, "user_id = ?", []interface{}{userID}},
+			{&models.Media{}, "user_id = ?", []interface{}{userID}},
+			{&models.Message{}, "user_id = ? OR sender_id = ? OR receiver_id = ?", []interface{}{userID, userID, userID}},
+			{&models.Notification{}, "user_id = ? OR receiver_id = ?", []interface{}{userID, userID}},
+			{&models.Session{}, "user_id = ?", []interface{}{userID}},
+			{&models.WebAuthnCredential{}, "user_id = ?", []interface{}{userID}},
+			{&models.RecoveryCode{}, "user_id = ?", []interface{}{userID}},
+			{&models.Identity{}, "user_id = ?", []interface{}{userID}},
+			{&models.EmailChange{}, "user_id = ?", []interface{}{userID}},
+			{&models.PersonalAccessToken{}, "user_id = ?", []interface{}{userID}},
+			{&models.Invite{}, "created_by_id = ?", []interface{}{userID}},
+			{&models.User{}, "id = ?", []interface{}{userID}},
+		}
+		for _, d := range deletes {
+			if err := tx.Unscoped().Where(d.query, d.args...).Delete(d.model).Error; err != nil {
+				return fmt.Errorf("failed to purge %T of user %d: %w", d.model, userID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+func (r Repository) GetPosts(ctx context.Context, userID uint64) ([]models.Post, error) {
+	var posts []models.Post
+	if err := r.conn.DB.Preload("Medias").Where("user_id = ?", userID).Order("created_at ASC").Find(&posts).Error; err != nil {
+		return nil, fmt.Errorf("failed to get posts of user %d: %w", userID, err)
+	}
+	return posts, nil
+}
+
+func (r Repository) GetComments(ctx context.Context, userID uint64) ([]models.Comment, error) {
+	var comments []models.Comment
+	if err := r.conn.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&comments).Error; err != nil {
+		return nil, fmt.Errorf("failed to get comments of user %d: %w", userID, err)
+	}
+	return comments, nil
+}
+
+func (r Repository) GetLikes(ctx context.Context, userID uint64) ([]models.Like, error) {
+	var likes []models.Like
+	if err := r.conn.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&likes).Error; err != nil {
+		return nil, fmt.Errorf("failed to get likes of user %d: %w", userID, err)
+	}
+	return likes, nil
+}
+
+func (r Repository) GetMessages(ctx context.Context, userID uint64) ([]models.Message, error) {
+	var messages []models.Message
+	err := r.conn.DB.
+		Where("sender_id = ? OR receiver_id = ?", userID, userID).
+		Order("created_at ASC").
+		Find(&messages).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages of user %d: %w", userID, err)
+	}
+	return messages, nil
+}
+
+func (r Repository) GetNotifications(ctx context.Context, userID uint64) ([]models.Notification, error) {
+	var notifications []models.Notification
+	err := r.conn.DB.
+		Where("user_id = ? OR receiver_id = ?", userID, userID).
+		Order("created_at ASC").
+		Find(&notifications).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications of user %d: %w", userID, err)
+	}
+	return notifications, nil
+}
+
+func (r Repository) GetMedias(ctx context.Context, userID uint64) ([]models.Media, error) {
+	var medias []models.Media
+	if err := r.conn.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&medias).Error; err != nil {
+		return nil, fmt.Errorf("failed to get media of user %d: %w", userID, err)
+	}
+	return medias, nil
+}
+
+func (r Repository) GetSessions(ctx context.Context, userID uint64) ([]models.Session, error) {
+	var sessions []models.Session
+	if err := r.conn.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get sessions of user %d: %w", userID, err)
+	}
+	return sessions, nil
+}
+
+func (r Repository) GetIdentities(ctx context.Context, userID uint64) ([]models.Identity, error) {
+	var identities []models.Identity
+	if err := r.conn.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&identities).Error; err != nil {
+		return nil, fmt.Errorf("failed to get identities of user %d: %w", userID, err)
+	}
+	return identities, nil
+}
+
+func (r Repository) GetPasskeys(ctx context.Context, userID uint64) ([]models.WebAuthnCredential, error) {
+	var passkeys []models.WebAuthnCredential
+	if err := r.conn.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&passkeys).Error; err != nil {
+		return nil, fmt.Errorf("failed to get passkeys of user %d: %w", userID, err)
+	}
+	return passkeys, nil
+}
+
+func (r Repository) GetPersonalTokens(ctx context.Context, userID uint64) ([]models.PersonalAccessToken, error) {
+	var pats []models.PersonalAccessToken
+	if err := r.conn.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&pats).Error; err != nil {
+		return nil, fmt.Errorf("failed to get personal access tokens of user %d: %w", userID, err)
+	}
+	return pats, nil
+}
+
+func (r Repository) GetInvites(ctx context.Context, userID uint64) ([]models.Invite, error) {
+	var invites []models.Invite
+	if err := r.conn.DB.Where("created_by_id = ?", userID).Order("created_at ASC").Find(&invites).Error; err != nil {
+		return nil, fmt.Errorf("failed to get invites of user %d: %w", userID, err)
+	}
+	return invites, nil
+}
@@ -0,0 +1,159 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"social-app/api/account"
+	authapi "social-app/api/auth"
+	"social-app/internal/config"
+	"social-app/internal/domains/auth"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+type UseCase struct {
+	repo   Repository
+	authUC auth.UseCase
+	cfg    config.Account
+}
+
+func NewUseCase(r Repository, a auth.UseCase, cfg config.Account) UseCase {
+	return UseCase{
+		repo:   r,
+		authUC: a,
+		cfg:    cfg,
+	}
+}
+
+// DeleteAccount hides the account and its content right away and signs it out
+// everywhere. Everything is purged for good once the grace period is over,
+// and the returned time tells when.
+func (u UseCase) DeleteAccount(ctx context.Context, userID uint64, input account.DeleteAccountInput, client authapi.ClientInfo) (time.Time, error) {
+	user, err := u.repo.GetUser(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if user.IsZero() {
+		return time.Time{}, ErrUserNotFound
+	}
+
+	if err := u.authUC.Reauthenticate(ctx, user, input.Password, client); err != nil {
+		return time.Time{}, err
+	}
+
+	if err := u.repo.SoftDelete(ctx, userID); err != nil {
+		return time.Time{}, err
+	}
+	if err := u.authUC.RevokeAllSessions(ctx, userID); err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Now().Add(u.cfg.DeletionGraceDuration), nil
+}
+
+// RestoreAccount brings back an account deleted during the grace period.
+func (u UseCase) RestoreAccount(ctx context.Context, userID uint64) error {
+	restored, err := u.repo.Restore(ctx, userID, time.Now().Add(-u.cfg.DeletionGraceDuration))
+	if err != nil {
+		return err
+	}
+	if !restored {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// Purge removes the accounts whose grace period is over and returns how many
+// were removed. A failing account is logged and left for the next run.
+func (u UseCase) Purge(ctx context.Context) (int, error) {
+	ids, err := u.repo.GetDeletedBefore(ctx, time.Now().Add(-u.cfg.DeletionGraceDuration))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		paths, err := u.repo.Purge(ctx, id)
+		if err != nil {
+			log.Printf("[Account] Failed to purge user %d: %v", id, err)
+			continue
+		}
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("[Account] Failed to remove media file %s: %v", path, err)
+			}
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// Export gathers everything tied to the user across all domains.
+func (u UseCase) Export(ctx context.Context, userID uint64) (Export, error) {
+	user, err := u.repo.GetUser(ctx, userID)
+	if err != nil {
+		return Export{}, err
+	}
+	if user.IsZero() {
+		return Export{}, ErrUserNotFound
+	}
+
+	exp := Export{
+		Profile: account.Profile{
+			CreatedAt:     user.CreatedAt,
+			Username:      user.Username,
+			Email:         user.Email,
+			Phone:         user.Phone,
+			Bio:           user.Bio,
+			Avatar:        user.Avatar,
+			Role:          user.Role,
+			SignupType:    user.SignupType,
+			ID:            user.ID,
+			Verified:      user.Verified,
+			PhoneVerified: user.PhoneVerified,
+			TOTPEnabled:   user.TOTPEnabled,
+			HasPassword:   user.Password != "",
+		},
+	}
+
+	if exp.Posts, err = u.repo.GetPosts(ctx, userID); err != nil {
+		return Export{}, err
+	}
+	if exp.Comments, err = u.repo.GetComments(ctx, userID); err != nil {
+		return Export{}, err
+	}
+	if exp.Likes, err = u.repo.GetLikes(ctx, userID); err != nil {
+		return Export{}, err
+	}
+	if exp.Messages, err = u.repo.GetMessages(ctx, userID); err != nil {
+		return Export{}, err
+	}
+	if exp.Notifications, err = u.repo.GetNotifications(ctx, userID); err != nil {
+		return Export{}, err
+	}
+	if exp.Medias, err = u.repo.GetMedias(ctx, userID); err != nil {
+		return Export{}, err
+	}
+	if exp.Sessions, err = u.repo.GetSessions(ctx, userID); err != nil {
+		return Export{}, err
+	}
+	if exp.Identities, err = u.repo.GetIdentities(ctx, userID); err != nil {
+		return Export{}, err
+	}
+	if exp.Passkeys, err = u.repo.GetPasskeys(ctx, userID); err != nil {
+		return Export{}, err
+	}
+	if exp.PersonalTokens, err = u.repo.GetPersonalTokens(ctx, userID); err != nil {
+		return Export{}, err
+	}
+	if exp.Invites, err = u.repo.GetInvites(ctx, userID); err != nil {
+		return Export{}, err
+	}
+
+	return exp, nil
+}
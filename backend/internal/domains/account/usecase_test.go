@@ -0,0 +1,229 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"social-app/api/account"
+	authapi "social-app/api/auth"
+	"social-app/internal/config"
+	"social-app/internal/connector"
+	"social-app/internal/domains/auth"
+	"social-app/pkg/token"
+	"social-app/pkg/ws"
+)
+
+const testGrace = 30 * 24 * time.Hour
+
+// newTestUseCase returns a UseCase on a miniredis and a mocked database,
+// with the auth use case it signs users out with.
+func newTestUseCase(t *testing.T) (UseCase, sqlmock.Sqlmock, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	host, port, _ := net.SplitHostPort(mr.Addr())
+	p, _ := strconv.Atoi(port)
+	rc := connector.NewRedisConnector(config.Redis{Host: host, Port: p})
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("gorm: %v", err)
+	}
+	conn := connector.DBConn{DB: db}
+
+	cfg := config.Auth{
+		JWTAlg:    token.AlgHS256,
+		JWTSecret: "secret",
+		Lockout: config.Lockout{
+			MaxFailures:     5,
+			IPMaxFailures:   50,
+			CodeMaxAttempts: 5,
+			WindowDuration:  15 * time.Minute,
+			LockDuration:    15 * time.Minute,
+			MaxLockDuration: 24 * time.Hour,
+		},
+	}
+	keys, err := token.NewKeyManager(cfg, rc)
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	secrets, err := token.NewSecretSealer(cfg)
+	if err != nil {
+		t.Fatalf("NewSecretSealer: %v", err)
+	}
+	authUC := auth.NewUseCase(
+		auth.NewRepository(conn),
+		auth.NewTokenStore(rc),
+		auth.NewLoginGuard(rc, cfg),
+		token.NewDenylist(rc),
+		keys,
+		secrets,
+		nil,
+		nil,
+		cfg,
+		ws.NewConnector(rc),
+		nil,
+		nil,
+	)
+
+	uc := NewUseCase(NewRepository(conn), authUC, config.Account{DeletionGraceDuration: testGrace})
+	return uc, mock, mr
+}
+
+func TestDeleteAccount(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	user := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "username", "password"}).AddRow(7, "alice", string(hash))
+	}
+	client := authapi.ClientInfo{IP: "1.2.3.4"}
+
+	t.Run("wrong password", func(t *testing.T) {
+		uc, mock, mr := newTestUseCase(t)
+		mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(user())
+
+		_, err := uc.DeleteAccount(context.Background(), 7, account.DeleteAccountInput{Password: "wrong"}, client)
+		if !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+		}
+		if mr.Exists("auth:denylist:user:7") {
+			t.Error("Expected the account to stay signed in")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		uc, mock, _ := newTestUseCase(t)
+		mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		_, err := uc.DeleteAccount(context.Background(), 7, account.DeleteAccountInput{}, client)
+		if !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("Expected ErrUserNotFound, got %v", err)
+		}
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		uc, mock, mr := newTestUseCase(t)
+		mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(user())
+		mock.ExpectBegin()
+		for _, table := range []string{"posts", "comments", "media"} {
+			mock.ExpectExec(`UPDATE "` + table + `" SET "deleted_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectExec(`UPDATE "users" SET "active"=\$1,"deleted_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`UPDATE "sessions" SET "revoked_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		purgeAt, err := uc.DeleteAccount(context.Background(), 7, account.DeleteAccountInput{Password: "password"}, client)
+		if err != nil {
+			t.Fatalf("DeleteAccount failed: %v", err)
+		}
+		if d := time.Until(purgeAt); d < testGrace-time.Minute || d > testGrace {
+			t.Errorf("Expected the purge after the grace period, got %s", purgeAt)
+		}
+		if !mr.Exists("auth:denylist:user:7") {
+			t.Error("Expected the account to be signed out everywhere")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestRestoreAccount(t *testing.T) {
+	t.Run("within the grace period", func(t *testing.T) {
+		uc, mock, _ := newTestUseCase(t)
+
+		deletedAt := time.Now().Add(-time.Hour)
+		rows := sqlmock.NewRows([]string{"id", "deleted_at"}).AddRow(7, deletedAt)
+		mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1 AND deleted_at IS NOT NULL AND deleted_at > \$2`).WillReturnRows(rows)
+		mock.ExpectBegin()
+		// Only the content hidden with the account comes back.
+		for _, table := range []string{"posts", "comments", "media"} {
+			mock.ExpectExec(`UPDATE "`+table+`" SET "deleted_at"=\$1,"updated_at"=\$2 WHERE user_id = \$3 AND deleted_at = \$4`).
+				WithArgs(nil, sqlmock.AnyArg(), 7, deletedAt).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectExec(`UPDATE "users" SET "active"=\$1,"deleted_at"=\$2`).
+			WithArgs(true, nil, sqlmock.AnyArg(), 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := uc.RestoreAccount(context.Background(), 7); err != nil {
+			t.Fatalf("RestoreAccount failed: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("past the grace period", func(t *testing.T) {
+		uc, mock, _ := newTestUseCase(t)
+		mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		if err := uc.RestoreAccount(context.Background(), 7); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("Expected ErrUserNotFound, got %v", err)
+		}
+	})
+}
+
+func TestPurge(t *testing.T) {
+	uc, mock, _ := newTestUseCase(t)
+
+	file := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(file, []byte("jpg"), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	mock.ExpectQuery(`SELECT "id" FROM "users" WHERE deleted_at IS NOT NULL AND deleted_at < \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7).AddRow(8))
+
+	// Purging user 7 fails and is left for the next run.
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "id" FROM "posts"`).WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "id" FROM "posts"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectQuery(`SELECT \* FROM "media" WHERE user_id = \$1$`).WillReturnRows(sqlmock.NewRows([]string{"id", "file_path"}).AddRow(4, file))
+	mock.ExpectExec(`DELETE FROM post_medias`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "users" SET "invited_by_id"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	for range 14 {
+		mock.ExpectExec(`DELETE FROM`).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	purged, err := uc.Purge(context.Background())
+	if err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected one account purged, got %d", purged)
+	}
+	if _, err := os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the media file to be removed, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
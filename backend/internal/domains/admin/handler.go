@@ -0,0 +1,214 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"social-app/api/admin"
+	"social-app/pkg/middleware"
+	"social-app/pkg/rbac"
+)
+
+type Handler struct {
+	usecase UseCase
+}
+
+func NewHandler(uc UseCase) Handler {
+	return Handler{
+		usecase: uc,
+	}
+}
+
+// ListUsers godoc
+// @Summary      List users
+// @Description  List users, newest first. Requires users:read.
+// @Tags         admin
+// @Produce      json
+// @Param        cursor query string false "Cursor for pagination"
+// @Param        role   query string false "Only users with this role"
+// @Success      200 {object} models.UserList
+// @Failure      403 {object} map[string]string "Forbidden"
+// @Failure      500 {object} map[string]string "Failed to list users"
+// @Router       /admin/users [get]
+// @Security BearerAuth
+func (h Handler) ListUsers(c *middleware.Context) {
+	users, err := h.usecase.ListUsers(c.Request.Context(), c.Query("cursor"), c.Query("role"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// AssignRole godoc
+// @Summary      Change the role of a user
+// @Description  Requires users:manage and every permission of both the current and the new role
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        id    path int                   true "User ID"
+// @Param        input body admin.AssignRoleInput true "New role"
+// @Success      200 {object} models.User
+// @Failure      400 {object} map[string]string "Invalid input"
+// @Failure      403 {object} map[string]string "Forbidden"
+// @Failure      404 {object} map[string]string "User or role not found"
+// @Failure      500 {object} map[string]string "Failed to change role"
+// @Router       /admin/users/{id}/role [put]
+// @Security BearerAuth
+func (h Handler) AssignRole(c *middleware.Context) {
+	userID, err := c.GetUint64("id")
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input admin.AssignRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
+	}
+
+	user, err := h.usecase.AssignRole(c.Request.Context(), actor(c), userID, input)
+	if err != nil {
+		writeError(c, err, "Failed to change role")
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ListRoles godoc
+// @Summary      List roles
+// @Description  Built-in and custom roles with their permissions, and every known permission. Requires users:read.
+// @Tags         admin
+// @Produce      json
+// @Success      200 {object} admin.RolesOutput
+// @Failure      403 {object} map[string]string "Forbidden"
+// @Failure      500 {object} map[string]string "Failed to list roles"
+// @Router       /admin/roles [get]
+// @Security BearerAuth
+func (h Handler) ListRoles(c *middleware.Context) {
+	roles, err := h.usecase.ListRoles(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// CreateRole godoc
+// @Summary      Create a custom role
+// @Description  Requires roles:manage and every permission granted by the role
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        input body admin.RoleInput true "Role"
+// @Success      201 {object} admin.RoleOutput
+// @Failure      400 {object} map[string]string "Invalid role name or permission"
+// @Failure      403 {object} map[string]string "Forbidden"
+// @Failure      409 {object} map[string]string "Role already exists"
+// @Failure      500 {object} map[string]string "Failed to create role"
+// @Router       /admin/roles [post]
+// @Security BearerAuth
+func (h Handler) CreateRole(c *middleware.Context) {
+	var input admin.RoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
+	}
+
+	role, err := h.usecase.CreateRole(c.Request.Context(), actor(c), input)
+	if err != nil {
+		writeError(c, err, "Failed to create role")
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole godoc
+// @Summary      Update a custom role
+// @Description  Replace the permissions of a custom role. Requires roles:manage.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        name  path string                true "Role name"
+// @Param        input body admin.UpdateRoleInput true "Role"
+// @Success      200 {object} admin.RoleOutput
+// @Failure      400 {object} map[string]string "Invalid permission or built-in role"
+// @Failure      403 {object} map[string]string "Forbidden"
+// @Failure      404 {object} map[string]string "Role not found"
+// @Failure      500 {object} map[string]string "Failed to update role"
+// @Router       /admin/roles/{name} [put]
+// @Security BearerAuth
+func (h Handler) UpdateRole(c *middleware.Context) {
+	var input admin.UpdateRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
+	}
+
+	role, err := h.usecase.UpdateRole(c.Request.Context(), actor(c), c.Param("name"), input)
+	if err != nil {
+		writeError(c, err, "Failed to update role")
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole godoc
+// @Summary      Delete a custom role
+// @Description  Only roles no user holds can be deleted. Requires roles:manage.
+// @Tags         admin
+// @Produce      json
+// @Param        name path string true "Role name"
+// @Success      200 {object} map[string]string "role deleted"
+// @Failure      400 {object} map[string]string "Built-in role"
+// @Failure      403 {object} map[string]string "Forbidden"
+// @Failure      404 {object} map[string]string "Role not found"
+// @Failure      409 {object} map[string]string "Role still assigned"
+// @Failure      500 {object} map[string]string "Failed to delete role"
+// @Router       /admin/roles/{name} [delete]
+// @Security BearerAuth
+func (h Handler) DeleteRole(c *middleware.Context) {
+	if err := h.usecase.DeleteRole(c.Request.Context(), actor(c), c.Param("name")); err != nil {
+		writeError(c, err, "Failed to delete role")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "role deleted"})
+}
+
+func actor(c *middleware.Context) admin.Actor {
+	return admin.Actor{
+		ID:          c.User.ID,
+		Permissions: c.Permissions,
+	}
+}
+
+func writeError(c *middleware.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+	case errors.Is(err, ErrRoleExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+	case errors.Is(err, ErrRoleInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is still assigned to users"})
+	case errors.Is(err, ErrOwnRole):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot change your own role"})
+	case errors.Is(err, ErrPrivilegeEscalation):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot grant or revoke permissions you do not hold"})
+	case errors.Is(err, ErrBuiltinRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles cannot be changed"})
+	case errors.Is(err, rbac.ErrInvalidRoleName), errors.Is(err, rbac.ErrUnknownPermission):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"social-app/internal/connector"
+	"social-app/internal/models"
+	"social-app/pkg/pagination"
+)
+
+const limit = 20
+
+type AdminRepository interface {
+	GetUsers(ctx context.Context, cursor, role string) (models.UserList, error)
+	GetUser(ctx context.Context, id uint64) (models.User, error)
+	UpdateRole(ctx context.Context, userID uint64, role string) error
+	CountUsersWithRole(ctx context.Context, role string) (int64, error)
+	GetRoles(ctx context.Context) ([]models.Role, error)
+	GetRole(ctx context.Context, name string) (models.Role, error)
+	CreateRole(ctx context.Context, role models.Role) (models.Role, error)
+	UpdateRoleDefinition(ctx context.Context, role models.Role) error
+	DeleteRole(ctx context.Context, name string) error
+}
+
+type Repository struct {
+	conn connector.DBConn
+}
+
+func NewRepository(con connector.DBConn) Repository {
+	return Repository{
+		conn: con,
+	}
+}
+
+func (r Repository) GetUsers(ctx context.Context, cursor, role string) (models.UserList, error) {
+	var users []models.User
+
+	db := r.conn.DB.Limit(limit + 1)
+	if role != "" {
+		db = db.Where("role = ?", role)
+	}
+
+	db = pagination.CursorFilter[models.User](cursor, db, "desc")
+
+	if err := db.Find(&users).Error; err != nil {
+		return models.UserList{}, fmt.Errorf("failed to fetch users: %w", err)
+	}
+
+	nextCursor, hasMore, items := pagination.NextCursor(users, limit)
+
+	return models.UserList{
+		Users:      items,
+		HasMore:    hasMore,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// GetUser returns a zero User when there is none with the ID.
+func (r Repository) GetUser(ctx context.Context, id uint64) (models.User, error) {
+	var user models.User
+	if err := r.conn.DB.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.User{}, nil
+		}
+		return models.User{}, fmt.Errorf("failed to get user %d: %w", id, err)
+	}
+	return user, nil
+}
+
+func (r Repository) UpdateRole(ctx context.Context, userID uint64, role string) error {
+	err := r.conn.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("role", role).Error
+	if err != nil {
+		return fmt.Errorf("failed to update role of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+func (r Repository) CountUsersWithRole(ctx context.Context, role string) (int64, error) {
+	var count int64
+	if err := r.conn.DB.Model(&models.User{}).Where("role = ?", role).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count users with role %s: %w", role, err)
+	}
+	return count, nil
+}
+
+func (r Repository) GetRoles(ctx context.Context) ([]models.Role, error) {
+	var roles []models.Role
+	if err := r.conn.DB.Order("name ASC").Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+	return roles, nil
+}
+
+// GetRole returns a zero Role when no custom role has the name.
+func (r Repository) GetRole(ctx context.Context, name string) (models.Role, error) {
+	var role models.Role
+	if err := r.conn.DB.Where("name = ?", name).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Role{}, nil
+		}
+		return models.Role{}, fmt.Errorf("failed to get role %s: %w", name, err)
+	}
+	return role, nil
+}
+
+func (r Repository) CreateRole(ctx context.Context, role models.Role) (models.Role, error) {
+	if err := r.conn.DB.Create(&role).Error; err != nil {
+		return models.Role{}, fmt.Errorf("failed to create role %s: %w", role.Name, err)
+	}
+	return role, nil
+}
+
+func (r Repository) UpdateRoleDefinition(ctx context.Context, role models.Role) error {
+	err := r.conn.DB.Model(&role).
+		Updates(map[string]interface{}{
+			"description": role.Description,
+			"permissions": role.PermissionsRaw,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update role %s: %w", role.Name, err)
+	}
+	return nil
+}
+
+func (r Repository) DeleteRole(ctx context.Context, name string) error {
+	if err := r.conn.DB.Unscoped().Where("name = ?", name).Delete(&models.Role{}).Error; err != nil {
+		return fmt.Errorf("failed to delete role %s: %w", name, err)
+	}
+	return nil
+}
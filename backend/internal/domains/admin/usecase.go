@@ -0,0 +1,212 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"social-app/api/admin"
+	"social-app/internal/config"
+	"social-app/internal/models"
+	"social-app/pkg/rbac"
+	"social-app/pkg/token"
+)
+
+var (
+	ErrUserNotFound        = errors.New("user not found")
+	ErrRoleNotFound        = errors.New("role not found")
+	ErrRoleExists          = errors.New("role already exists")
+	ErrRoleInUse           = errors.New("role still assigned to users")
+	ErrBuiltinRole         = errors.New("built-in roles cannot be changed")
+	ErrOwnRole             = errors.New("cannot change your own role")
+	ErrPrivilegeEscalation = errors.New("cannot grant permissions you do not hold")
+)
+
+type UseCase struct {
+	repo     Repository
+	denylist *token.Denylist
+	authCfg  config.Auth
+}
+
+func NewUseCase(r Repository, dl *token.Denylist, cfg config.Auth) UseCase {
+	return UseCase{
+		repo:     r,
+		denylist: dl,
+		authCfg:  cfg,
+	}
+}
+
+func (u UseCase) ListUsers(ctx context.Context, cursor, role string) (models.UserList, error) {
+	return u.repo.GetUsers(ctx, cursor, role)
+}
+
+func (u UseCase) ListRoles(ctx context.Context) (admin.RolesOutput, error) {
+	custom, err := u.repo.GetRoles(ctx)
+	if err != nil {
+		return admin.RolesOutput{}, err
+	}
+
+	roles := make([]admin.RoleOutput, 0, len(custom)+3)
+	for _, name := range rbac.BuiltinRoles() {
+		perms, _ := rbac.Builtin(name)
+		roles = append(roles, admin.RoleOutput{Name: name, Permissions: perms, Builtin: true})
+	}
+	for _, r := range custom {
+		roles = append(roles, roleOutput(r))
+	}
+
+	return admin.RolesOutput{Roles: roles, Permissions: rbac.Known()}, nil
+}
+
+// AssignRole changes the role of a user. The actor must hold every
+// permission of both the current and the new role, so that nobody can grant
+// or take away more than they have. The user's access tokens are revoked so
+// that the next refresh carries the new permissions.
+func (u UseCase) AssignRole(ctx context.Context, actor admin.Actor, userID uint64, input admin.AssignRoleInput) (models.User, error) {
+	if userID == actor.ID {
+		return models.User{}, ErrOwnRole
+	}
+
+	user, err := u.repo.GetUser(ctx, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if user.IsZero() {
+		return models.User{}, ErrUserNotFound
+	}
+
+	newPerms, err := u.permissions(ctx, input.Role)
+	if err != nil {
+		return models.User{}, err
+	}
+	currentPerms, err := u.permissions(ctx, user.Role)
+	if err != nil && !errors.Is(err, ErrRoleNotFound) {
+		return models.User{}, err
+	}
+	if !rbac.Has(actor.Permissions, newPerms...) || !rbac.Has(actor.Permissions, currentPerms...) {
+		return models.User{}, ErrPrivilegeEscalation
+	}
+
+	if err := u.repo.UpdateRole(ctx, userID, input.Role); err != nil {
+		return models.User{}, err
+	}
+	if err := u.denylist.RevokeUser(ctx, userID, u.authCfg.JWTExpDuration); err != nil {
+		return models.User{}, fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+
+	user.Role = input.Role
+	return user, nil
+}
+
+func (u UseCase) CreateRole(ctx context.Context, actor admin.Actor, input admin.RoleInput) (admin.RoleOutput, error) {
+	if err := rbac.ValidateRoleName(input.Name); err != nil {
+		return admin.RoleOutput{}, err
+	}
+
+	perms, err := rbac.Normalize(input.Permissions)
+	if err != nil {
+		return admin.RoleOutput{}, err
+	}
+	if !rbac.Has(actor.Permissions, perms...) {
+		return admin.RoleOutput{}, ErrPrivilegeEscalation
+	}
+
+	existing, err := u.repo.GetRole(ctx, input.Name)
+	if err != nil {
+		return admin.RoleOutput{}, err
+	}
+	if existing.ID != 0 {
+		return admin.RoleOutput{}, ErrRoleExists
+	}
+
+	role := models.Role{Name: input.Name, Description: input.Description}
+	role.SetPermissions(perms)
+
+	role, err = u.repo.CreateRole(ctx, role)
+	if err != nil {
+		return admin.RoleOutput{}, err
+	}
+	return roleOutput(role), nil
+}
+
+// UpdateRole replaces the permissions of a custom role. Users holding it get
+// the new permissions when their access token is refreshed.
+func (u UseCase) UpdateRole(ctx context.Context, actor admin.Actor, name string, input admin.UpdateRoleInput) (admin.RoleOutput, error) {
+	role, err := u.customRole(ctx, name)
+	if err != nil {
+		return admin.RoleOutput{}, err
+	}
+
+	perms, err := rbac.Normalize(input.Permissions)
+	if err != nil {
+		return admin.RoleOutput{}, err
+	}
+	if !rbac.Has(actor.Permissions, perms...) || !rbac.Has(actor.Permissions, role.GetPermissions()...) {
+		return admin.RoleOutput{}, ErrPrivilegeEscalation
+	}
+
+	role.Description = input.Description
+	role.SetPermissions(perms)
+	if err := u.repo.UpdateRoleDefinition(ctx, role); err != nil {
+		return admin.RoleOutput{}, err
+	}
+	return roleOutput(role), nil
+}
+
+func (u UseCase) DeleteRole(ctx context.Context, actor admin.Actor, name string) error {
+	role, err := u.customRole(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !rbac.Has(actor.Permissions, role.GetPermissions()...) {
+		return ErrPrivilegeEscalation
+	}
+
+	count, err := u.repo.CountUsersWithRole(ctx, name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+
+	return u.repo.DeleteRole(ctx, name)
+}
+
+func (u UseCase) customRole(ctx context.Context, name string) (models.Role, error) {
+	if rbac.IsBuiltin(name) {
+		return models.Role{}, ErrBuiltinRole
+	}
+
+	role, err := u.repo.GetRole(ctx, name)
+	if err != nil {
+		return models.Role{}, err
+	}
+	if role.ID == 0 {
+		return models.Role{}, ErrRoleNotFound
+	}
+	return role, nil
+}
+
+func (u UseCase) permissions(ctx context.Context, name string) ([]string, error) {
+	if perms, ok := rbac.Builtin(name); ok {
+		return perms, nil
+	}
+
+	role, err := u.repo.GetRole(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if role.ID == 0 {
+		return nil, ErrRoleNotFound
+	}
+	return role.GetPermissions(), nil
+}
+
+func roleOutput(r models.Role) admin.RoleOutput {
+	return admin.RoleOutput{
+		Name:        r.Name,
+		Description: r.Description,
+		Permissions: r.GetPermissions(),
+	}
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"social-app/api/auth"
+	"social-app/internal/models"
+	"social-app/internal/utils"
+)
+
+const emailChangeCodeKind = "email_change"
+
+var (
+	ErrEmailTaken          = errors.New("email already in use")
+	ErrSameEmail           = errors.New("email unchanged")
+	ErrEmailChangeNotFound = errors.New("email change not found")
+	ErrNoEmail             = errors.New("no email address")
+)
+
+// RequestEmailChange stages a move to a new address. Nothing changes until the
+// code sent to the new address is confirmed; the old address is told about it
+// and gets a link to cancel. Users with a password have to give it.
+func (u UseCase) RequestEmailChange(ctx context.Context, userID uint64, input auth.EmailChangeInput, client auth.ClientInfo) (models.EmailChange, error) {
+	user, err := u.repo.Get(ctx, userID)
+	if err != nil {
+		return models.EmailChange{}, err
+	}
+
+	if err := u.Reauthenticate(ctx, user, input.Password, client); err != nil {
+		return models.EmailChange{}, err
+	}
+
+	email := strings.TrimSpace(input.Email)
+	if strings.EqualFold(email, user.Email) {
+		return models.EmailChange{}, ErrSameEmail
+	}
+	owner, err := u.repo.GetByEmail(ctx, email)
+	if err != nil {
+		return models.EmailChange{}, err
+	}
+	if !owner.IsZero() {
+		return models.EmailChange{}, ErrEmailTaken
+	}
+
+	code, err := utils.GenerateCode(6)
+	if err != nil {
+		return models.EmailChange{}, fmt.Errorf("failed to generate email change code: %w", err)
+	}
+	cancelToken, err := randomCancelToken()
+	if err != nil {
+		return models.EmailChange{}, err
+	}
+	if err := u.guard.ResetCode(ctx, user.ID, emailChangeCodeKind); err != nil {
+		return models.EmailChange{}, err
+	}
+
+	now := time.Now()
+	change, err := u.repo.CreateEmailChange(ctx, models.EmailChange{
+		UserID:          user.ID,
+		OldEmail:        user.Email,
+		NewEmail:        email,
+		CodeHash:        hashToken(code),
+		CancelTokenHash: hashToken(cancelToken),
+		ExpiresAt:       now.Add(u.authCfg.EmailChange.CodeDuration),
+		CancelableUntil: now.Add(u.authCfg.EmailChange.CancelWindowDuration),
+	})
+	if err != nil {
+		return models.EmailChange{}, err
+	}
+
+	if err := u.mailer.SendEmailChangeCode(email, code); err != nil {
+		return models.EmailChange{}, fmt.Errorf("failed to send email change code: %w", err)
+	}
+
+	if user.Email != "" {
+		link := u.authCfg.EmailChange.CancelURL + "?token=" + url.QueryEscape(cancelToken)
+		go func(to string) {
+			if err := u.mailer.SendEmailChangeNotice(to, email, link, change.CancelableUntil); err != nil {
+				log.Printf("[Auth] Failed to send email change notice: %v", err)
+			}
+		}(user.Email)
+	}
+
+	return change, nil
+}
+
+// GetPendingEmailChange returns the change waiting for its code, if any.
+func (u UseCase) GetPendingEmailChange(ctx context.Context, userID uint64) (models.EmailChange, error) {
+	change, err := u.repo.GetPendingEmailChange(ctx, userID)
+	if err != nil {
+		return models.EmailChange{}, err
+	}
+	if change.ID == 0 || change.ExpiresAt.Before(time.Now()) {
+		return models.EmailChange{}, ErrEmailChangeNotFound
+	}
+	return change, nil
+}
+
+// ConfirmEmailChange applies the pending change once the code sent to the new
+// address is given back. A change whose code has used up its attempts is
+// canceled.
+func (u UseCase) ConfirmEmailChange(ctx context.Context, userID uint64, code string, client auth.ClientInfo) (models.User, error) {
+	change, err := u.GetPendingEmailChange(ctx, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err := u.repo.Get(ctx, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if err := u.guard.Check(ctx, user.ID, client.IP); err != nil {
+		return models.User{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(change.CodeHash), []byte(hashToken(code))) != 1 {
+		if err := u.emailChangeCodeFailed(ctx, user, change, client.IP); err != nil {
+			return models.User{}, err
+		}
+		return models.User{}, ErrInvalidCode
+	}
+
+	if err := u.guard.Succeed(ctx, user.ID); err != nil {
+		return models.User{}, err
+	}
+
+	// The address may have been taken since the change was requested.
+	owner, err := u.repo.GetByEmail(ctx, change.NewEmail)
+	if err != nil {
+		return models.User{}, err
+	}
+	if !owner.IsZero() {
+		if err := u.repo.CancelEmailChange(ctx, change, false); err != nil {
+			return models.User{}, err
+		}
+		return models.User{}, ErrEmailTaken
+	}
+
+	if err := u.repo.ConfirmEmailChange(ctx, change); err != nil {
+		return models.User{}, err
+	}
+
+	user.Email = change.NewEmail
+	return user, nil
+}
+
+func (u UseCase) emailChangeCodeFailed(ctx context.Context, user models.User, change models.EmailChange, ip string) error {
+	if err := u.loginFailed(ctx, user, ip); err != nil {
+		return err
+	}
+
+	exhausted, err := u.guard.FailCode(ctx, user.ID, emailChangeCodeKind)
+	if err != nil {
+		return err
+	}
+	if !exhausted {
+		return nil
+	}
+	return u.repo.CancelEmailChange(ctx, change, false)
+}
+
+// CancelEmailChange drops the pending change of the current user.
+func (u UseCase) CancelEmailChange(ctx context.Context, userID uint64) error {
+	change, err := u.repo.GetPendingEmailChange(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if change.ID == 0 {
+		return ErrEmailChangeNotFound
+	}
+	return u.repo.CancelEmailChange(ctx, change, false)
+}
+
+// CancelEmailChangeByToken handles the link sent to the old address. Until the
+// window closes it drops a pending change or, when the change was already
+// confirmed, moves the account back to the old address and signs it out
+// everywhere, since whoever confirmed it may not be the owner.
+func (u UseCase) CancelEmailChangeByToken(ctx context.Context, cancelToken string) error {
+	change, err := u.repo.GetEmailChangeByCancelToken(ctx, hashToken(cancelToken))
+	if err != nil {
+		return err
+	}
+	if change.ID == 0 || change.CanceledAt != nil || change.CancelableUntil.Before(time.Now()) {
+		return ErrEmailChangeNotFound
+	}
+
+	if change.ConfirmedAt == nil {
+		return u.repo.CancelEmailChange(ctx, change, false)
+	}
+
+	owner, err := u.repo.GetByEmail(ctx, change.OldEmail)
+	if err != nil {
+		return err
+	}
+	if !owner.IsZero() && owner.ID != change.UserID {
+		return ErrEmailTaken
+	}
+
+	if err := u.repo.CancelEmailChange(ctx, change, true); err != nil {
+		return err
+	}
+	return u.RevokeAllSessions(ctx, change.UserID)
+}
+
+func randomCancelToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate cancel token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
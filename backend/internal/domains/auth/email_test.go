@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"social-app/api/auth"
+)
+
+// pendingChange returns the row of an email change of user 7 to
+// new@example.com, with the code 123456.
+func pendingChange(expiresAt time.Time) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "old_email", "new_email", "code_hash", "expires_at", "cancelable_until"}).
+		AddRow(1, 7, "old@example.com", "new@example.com", hashToken("123456"), expiresAt, time.Now().Add(time.Hour))
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	client := auth.ClientInfo{IP: "1.2.3.4"}
+	owner := func(rows *sqlmock.Rows) func(sqlmock.Sqlmock) {
+		return func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(`SELECT \* FROM "users" WHERE email`).WillReturnRows(rows)
+		}
+	}
+	cancel := func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "email_changes" SET "canceled_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		attempts string
+		expect   []func(sqlmock.Sqlmock)
+		wantErr  error
+	}{
+		{
+			name:    "wrong code",
+			code:    "000000",
+			wantErr: ErrInvalidCode,
+		},
+		{
+			name:     "last attempt",
+			code:     "000000",
+			attempts: "4",
+			expect:   []func(sqlmock.Sqlmock){cancel},
+			wantErr:  ErrInvalidCode,
+		},
+		{
+			name:    "address taken meanwhile",
+			code:    "123456",
+			expect:  []func(sqlmock.Sqlmock){owner(sqlmock.NewRows([]string{"id"}).AddRow(8)), cancel},
+			wantErr: ErrEmailTaken,
+		},
+		{
+			name: "right code",
+			code: "123456",
+			expect: []func(sqlmock.Sqlmock){owner(sqlmock.NewRows([]string{"id"})), func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "users" SET "email"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE "email_changes" SET "confirmed_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, mock, mr := newTestUseCase(t)
+			if tt.attempts != "" {
+				if err := mr.Set(codeFailKey(7, emailChangeCodeKind), tt.attempts); err != nil {
+					t.Fatalf("Set failed: %v", err)
+				}
+			}
+
+			mock.ExpectQuery(`SELECT \* FROM "email_changes"`).WillReturnRows(pendingChange(time.Now().Add(time.Hour)))
+			rows := sqlmock.NewRows([]string{"id", "username", "email"}).AddRow(7, "alice", "old@example.com")
+			mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(rows)
+			for _, expect := range tt.expect {
+				expect(mock)
+			}
+
+			user, err := uc.ConfirmEmailChange(context.Background(), 7, tt.code, client)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && user.Email != "new@example.com" {
+				t.Errorf("Expected the new address, got %q", user.Email)
+			}
+			if errors.Is(tt.wantErr, ErrInvalidCode) && !mr.Exists(userFailKeyPrefix+"7") {
+				t.Error("Expected a wrong code to count as a failed login")
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestConfirmEmailChangeExpired(t *testing.T) {
+	uc, mock, _ := newTestUseCase(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "email_changes"`).WillReturnRows(pendingChange(time.Now().Add(-time.Minute)))
+
+	if _, err := uc.ConfirmEmailChange(context.Background(), 7, "123456", auth.ClientInfo{}); !errors.Is(err, ErrEmailChangeNotFound) {
+		t.Errorf("Expected ErrEmailChangeNotFound, got %v", err)
+	}
+}
+
+func TestCancelEmailChangeByToken(t *testing.T) {
+	now := time.Now()
+	change := func(confirmedAt, canceledAt any, cancelableUntil time.Time) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "user_id", "old_email", "new_email", "confirmed_at", "canceled_at", "cancelable_until"}).
+			AddRow(1, 7, "old@example.com", "new@example.com", confirmedAt, canceledAt, cancelableUntil)
+	}
+	oldOwner := func(rows *sqlmock.Rows) func(sqlmock.Sqlmock) {
+		return func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(`SELECT \* FROM "users" WHERE email`).WillReturnRows(rows)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		rows    *sqlmock.Rows
+		expect  []func(sqlmock.Sqlmock)
+		wantErr error
+		signOut bool
+	}{
+		{
+			name: "pending change",
+			rows: change(nil, nil, now.Add(time.Hour)),
+			expect: []func(sqlmock.Sqlmock){func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "email_changes" SET "canceled_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}},
+		},
+		{
+			name:    "window closed",
+			rows:    change(now.Add(-2*time.Hour), nil, now.Add(-time.Hour)),
+			wantErr: ErrEmailChangeNotFound,
+		},
+		{
+			name:    "already canceled",
+			rows:    change(nil, now, now.Add(time.Hour)),
+			wantErr: ErrEmailChangeNotFound,
+		},
+		{
+			name:    "unknown token",
+			rows:    sqlmock.NewRows([]string{"id"}),
+			wantErr: ErrEmailChangeNotFound,
+		},
+		{
+			name:    "old address taken since",
+			rows:    change(now, nil, now.Add(time.Hour)),
+			expect:  []func(sqlmock.Sqlmock){oldOwner(sqlmock.NewRows([]string{"id"}).AddRow(8))},
+			wantErr: ErrEmailTaken,
+		},
+		{
+			name: "confirmed change",
+			rows: change(now, nil, now.Add(time.Hour)),
+			expect: []func(sqlmock.Sqlmock){oldOwner(sqlmock.NewRows([]string{"id"})), func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "users" SET "email"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE "email_changes" SET "canceled_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectExec(`UPDATE "sessions" SET "revoked_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+			}},
+			signOut: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, mock, mr := newTestUseCase(t)
+
+			mock.ExpectQuery(`SELECT \* FROM "email_changes"`).WillReturnRows(tt.rows)
+			for _, expect := range tt.expect {
+				expect(mock)
+			}
+
+			if err := uc.CancelEmailChangeByToken(context.Background(), "token"); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if signedOut := mr.Exists("auth:denylist:user:7"); signedOut != tt.signOut {
+				t.Errorf("Expected signed out %v, got %v", tt.signOut, signedOut)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
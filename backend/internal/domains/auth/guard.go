@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"social-app/internal/config"
+	"social-app/internal/connector"
+)
+
+const (
+	userFailKeyPrefix  = "auth:fail:user:"
+	ipFailKeyPrefix    = "auth:fail:ip:"
+	userLockKeyPrefix  = "auth:lock:user:"
+	ipLockKeyPrefix    = "auth:lock:ip:"
+	lockLevelKeyPrefix = "auth:lock:level:"
+	codeFailKeyPrefix  = "auth:fail:code:"
+	smsWaitKeyPrefix   = "auth:sms:wait:"
+	smsDailyKeyPrefix  = "auth:sms:daily:"
+
+	verifyCodeKind    = "verify"
+	phoneCodeKind     = "verify_sms"
+	twoFactorCodeKind = "2fa"
+
+	maxBackoff = time.Minute
+	smsDay     = 24 * time.Hour
+)
+
+var ErrTooManyAttempts = errors.New("too many attempts")
+
+// AttemptsError tells how long a locked out client must wait. It matches
+// ErrTooManyAttempts with errors.Is.
+type AttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *AttemptsError) Error() string {
+	return fmt.Sprintf("too many attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+func (e *AttemptsError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// LoginGuard counts failed logins and verification codes in Redis. Each
+// failure makes the account wait twice as long before the next attempt, and
+// reaching the failure limit locks the account (or the IP) for a while.
+type LoginGuard struct {
+	redisConn *connector.RedisConnector
+	cfg       config.Lockout
+}
+
+func NewLoginGuard(r *connector.RedisConnector, cfg config.Auth) LoginGuard {
+	return LoginGuard{
+		redisConn: r,
+		cfg:       cfg.Lockout,
+	}
+}
+
+// Check returns an AttemptsError while the account or the IP is locked out.
+// A zero user ID or an empty IP is skipped.
+func (g LoginGuard) Check(ctx context.Context, userID uint64, ip string) error {
+	keys := make([]string, 0, 2)
+	if userID != 0 {
+		keys = append(keys, fmt.Sprintf("%s%d", userLockKeyPrefix, userID))
+	}
+	if ip != "" {
+		keys = append(keys, ipLockKeyPrefix+ip)
+	}
+
+	for _, key := range keys {
+		ttl, err := g.redisConn.TTL(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to check lockout: %w", err)
+		}
+		if ttl > 0 {
+			return &AttemptsError{RetryAfter: ttl}
+		}
+	}
+
+	return nil
+}
+
+// Fail records a failed attempt. It returns the lockout duration when this
+// failure locked the account, zero otherwise.
+func (g LoginGuard) Fail(ctx context.Context, userID uint64, ip string) (time.Duration, error) {
+	if ip != "" {
+		n, err := g.redisConn.Incr(ctx, ipFailKeyPrefix+ip, g.cfg.WindowDuration)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count failure: %w", err)
+		}
+		if n >= g.cfg.IPMaxFailures {
+			if err := g.redisConn.Set(ctx, ipLockKeyPrefix+ip, "locked", g.cfg.LockDuration); err != nil {
+				return 0, fmt.Errorf("failed to lock IP: %w", err)
+			}
+			if err := g.redisConn.Delete(ctx, ipFailKeyPrefix+ip); err != nil {
+				return 0, fmt.Errorf("failed to reset failures: %w", err)
+			}
+		}
+	}
+
+	if userID == 0 {
+		return 0, nil
+	}
+
+	failKey := fmt.Sprintf("%s%d", userFailKeyPrefix, userID)
+	lockKey := fmt.Sprintf("%s%d", userLockKeyPrefix, userID)
+
+	n, err := g.redisConn.Incr(ctx, failKey, g.cfg.WindowDuration)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count failure: %w", err)
+	}
+
+	if n < g.cfg.MaxFailures {
+		if err := g.redisConn.Set(ctx, lockKey, "backoff", backoff(n)); err != nil {
+			return 0, fmt.Errorf("failed to delay next attempt: %w", err)
+		}
+		return 0, nil
+	}
+
+	level, err := g.redisConn.Incr(ctx, fmt.Sprintf("%s%d", lockLevelKeyPrefix, userID), g.cfg.MaxLockDuration)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count lockouts: %w", err)
+	}
+
+	d := lockDuration(g.cfg.LockDuration, g.cfg.MaxLockDuration, level)
+	if err := g.redisConn.Set(ctx, lockKey, "locked", d); err != nil {
+		return 0, fmt.Errorf("failed to lock account: %w", err)
+	}
+	if err := g.redisConn.Delete(ctx, failKey); err != nil {
+		return 0, fmt.Errorf("failed to reset failures: %w", err)
+	}
+
+	return d, nil
+}
+
+// Succeed forgets the failures of the account. The lockout level is kept so
+// that repeated lockouts keep growing until it expires.
+func (g LoginGuard) Succeed(ctx context.Context, userID uint64) error {
+	if err := g.redisConn.Delete(ctx, fmt.Sprintf("%s%d", userFailKeyPrefix, userID)); err != nil {
+		return fmt.Errorf("failed to reset failures: %w", err)
+	}
+	return nil
+}
+
+// FailCode counts a wrong code of the given kind (email verification, 2FA)
+// and reports true once the code has used up its attempts and must be
+// discarded.
+func (g LoginGuard) FailCode(ctx context.Context, userID uint64, kind string) (bool, error) {
+	key := codeFailKey(userID, kind)
+
+	n, err := g.redisConn.Incr(ctx, key, g.cfg.WindowDuration)
+	if err != nil {
+		return false, fmt.Errorf("failed to count code attempt: %w", err)
+	}
+	if n < g.cfg.CodeMaxAttempts {
+		return false, nil
+	}
+
+	if err := g.redisConn.Delete(ctx, key); err != nil {
+		return false, fmt.Errorf("failed to reset code attempts: %w", err)
+	}
+	return true, nil
+}
+
+// ResetCode gives a freshly issued code its full number of attempts.
+func (g LoginGuard) ResetCode(ctx context.Context, userID uint64, kind string) error {
+	if err := g.redisConn.Delete(ctx, codeFailKey(userID, kind)); err != nil {
+		return fmt.Errorf("failed to reset code attempts: %w", err)
+	}
+	return nil
+}
+
+// AllowSMS counts a code about to be sent by SMS to phone for the user. It
+// returns an AttemptsError while the previous code sent to the account or to
+// the number is more recent than SMSCooldown, or once either has been sent
+// SMSDailyMax codes in a day.
+func (g LoginGuard) AllowSMS(ctx context.Context, userID uint64, phone string) error {
+	targets := []string{fmt.Sprintf("user:%d", userID), "phone:" + phone}
+
+	if g.cfg.SMSCooldownDuration > 0 {
+		for _, target := range targets {
+			key := smsWaitKeyPrefix + target
+			ok, err := g.redisConn.SetNX(ctx, key, "1", g.cfg.SMSCooldownDuration)
+			if err != nil {
+				return fmt.Errorf("failed to space SMS: %w", err)
+			}
+			if !ok {
+				return g.retryAfter(ctx, key)
+			}
+		}
+	}
+
+	if g.cfg.SMSDailyMax > 0 {
+		for _, target := range targets {
+			key := smsDailyKeyPrefix + target
+			n, err := g.redisConn.Incr(ctx, key, smsDay)
+			if err != nil {
+				return fmt.Errorf("failed to count SMS: %w", err)
+			}
+			if n > g.cfg.SMSDailyMax {
+				return g.retryAfter(ctx, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+// retryAfter returns an AttemptsError lasting as long as key.
+func (g LoginGuard) retryAfter(ctx context.Context, key string) error {
+	ttl, err := g.redisConn.TTL(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to check SMS limit: %w", err)
+	}
+	return &AttemptsError{RetryAfter: ttl}
+}
+
+func codeFailKey(userID uint64, kind string) string {
+	return fmt.Sprintf("%s%s:%d", codeFailKeyPrefix, kind, userID)
+}
+
+// backoff is the delay imposed after the n-th consecutive failure: 1s, 2s,
+// 4s... up to maxBackoff.
+func backoff(n int64) time.Duration {
+	if n > 7 {
+		return maxBackoff
+	}
+	return min(time.Second<<(n-1), maxBackoff)
+}
+
+// lockDuration doubles the lockout at each level, up to limit.
+func lockDuration(base, limit time.Duration, level int64) time.Duration {
+	d := base
+	for i := int64(1); i < level && d < limit; i++ {
+		d *= 2
+	}
+	return min(d, limit)
+}
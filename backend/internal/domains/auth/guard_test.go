@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := map[int64]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		4:  8 * time.Second,
+		6:  32 * time.Second,
+		7:  maxBackoff,
+		40: maxBackoff,
+	}
+	for n, want := range tests {
+		if got := backoff(n); got != want {
+			t.Errorf("backoff(%d) = %s, expected %s", n, got, want)
+		}
+	}
+}
+
+func TestLockDuration(t *testing.T) {
+	tests := map[int64]time.Duration{
+		1:  15 * time.Minute,
+		2:  30 * time.Minute,
+		3:  time.Hour,
+		10: 24 * time.Hour,
+	}
+	for level, want := range tests {
+		if got := lockDuration(15*time.Minute, 24*time.Hour, level); got != want {
+			t.Errorf("lockDuration(%d) = %s, expected %s", level, got, want)
+		}
+	}
+}
+
+// retryAfter returns how long Check makes the client wait, zero when it
+// lets it through.
+func retryAfter(t *testing.T, g LoginGuard, userID uint64, ip string) time.Duration {
+	t.Helper()
+
+	err := g.Check(context.Background(), userID, ip)
+	if err == nil {
+		return 0
+	}
+	var ae *AttemptsError
+	if !errors.As(err, &ae) || !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("Expected an AttemptsError, got %v", err)
+	}
+	return ae.RetryAfter
+}
+
+func TestLoginGuardLockout(t *testing.T) {
+	uc, _, mr := newTestUseCase(t)
+	ctx := context.Background()
+	g := uc.guard
+
+	// Each failure below the limit delays the next attempt twice as long.
+	for n := int64(1); n < testLockout.MaxFailures; n++ {
+		locked, err := g.Fail(ctx, 7, "1.2.3.4")
+		if err != nil || locked != 0 {
+			t.Fatalf("Expected failure %d to only delay, got %s, %v", n, locked, err)
+		}
+		if got := retryAfter(t, g, 7, ""); got != backoff(n) {
+			t.Fatalf("Expected a backoff of %s after failure %d, got %s", backoff(n), n, got)
+		}
+		mr.FastForward(backoff(n))
+	}
+	if got := retryAfter(t, g, 7, ""); got != 0 {
+		t.Fatalf("Expected the backoff to be over, got %s", got)
+	}
+
+	// Reaching the limit locks the account, and the next lockout is longer.
+	// The client waits out every delay, as Check makes it.
+	for level, want := range []time.Duration{testLockout.LockDuration, 2 * testLockout.LockDuration} {
+		var locked time.Duration
+		for locked == 0 {
+			var err error
+			if locked, err = g.Fail(ctx, 7, ""); err != nil {
+				t.Fatalf("Fail failed: %v", err)
+			}
+			if locked == 0 {
+				mr.FastForward(retryAfter(t, g, 7, ""))
+			}
+		}
+		if locked != want {
+			t.Fatalf("Expected lockout %d to last %s, got %s", level+1, want, locked)
+		}
+		if got := retryAfter(t, g, 7, "5.6.7.8"); got != want {
+			t.Fatalf("Expected Check to wait %s, got %s", want, got)
+		}
+		if mr.Exists(fmt.Sprintf("%s%d", userFailKeyPrefix, 7)) {
+			t.Error("Expected the failures to restart after a lockout")
+		}
+		mr.FastForward(want)
+	}
+
+	// A success forgets the failures but not the lockout level.
+	if _, err := g.Fail(ctx, 7, ""); err != nil {
+		t.Fatalf("Fail failed: %v", err)
+	}
+	if err := g.Succeed(ctx, 7); err != nil {
+		t.Fatalf("Succeed failed: %v", err)
+	}
+	if mr.Exists(fmt.Sprintf("%s%d", userFailKeyPrefix, 7)) {
+		t.Error("Expected Succeed to forget the failures")
+	}
+	if got, _ := mr.Get(fmt.Sprintf("%s%d", lockLevelKeyPrefix, 7)); got != "2" {
+		t.Errorf("Expected the lockout level to be kept, got %q", got)
+	}
+
+	if got := retryAfter(t, g, 8, ""); got != 0 {
+		t.Errorf("Expected another account to be let through, got %s", got)
+	}
+}
+
+func TestLoginGuardLocksIP(t *testing.T) {
+	uc, _, _ := newTestUseCase(t)
+	ctx := context.Background()
+	g := uc.guard
+
+	for i := int64(0); i < testLockout.IPMaxFailures; i++ {
+		if _, err := g.Fail(ctx, 0, "1.2.3.4"); err != nil {
+			t.Fatalf("Fail failed: %v", err)
+		}
+	}
+
+	if got := retryAfter(t, g, 0, "1.2.3.4"); got != testLockout.LockDuration {
+		t.Errorf("Expected the IP to be locked for %s, got %s", testLockout.LockDuration, got)
+	}
+	if got := retryAfter(t, g, 7, "5.6.7.8"); got != 0 {
+		t.Errorf("Expected another IP to be let through, got %s", got)
+	}
+}
+
+func TestFailCode(t *testing.T) {
+	uc, _, _ := newTestUseCase(t)
+	ctx := context.Background()
+	g := uc.guard
+
+	for i := int64(1); i < testLockout.CodeMaxAttempts; i++ {
+		if exhausted, err := g.FailCode(ctx, 7, verifyCodeKind); err != nil || exhausted {
+			t.Fatalf("Expected attempt %d to be allowed, got %v, %v", i, exhausted, err)
+		}
+	}
+	if exhausted, err := g.FailCode(ctx, 7, twoFactorCodeKind); err != nil || exhausted {
+		t.Errorf("Expected the kinds of code to be counted apart, got %v, %v", exhausted, err)
+	}
+	if exhausted, err := g.FailCode(ctx, 7, verifyCodeKind); err != nil || !exhausted {
+		t.Fatalf("Expected the last attempt to use up the code, got %v, %v", exhausted, err)
+	}
+
+	// A new code starts over.
+	if exhausted, err := g.FailCode(ctx, 7, verifyCodeKind); err != nil || exhausted {
+		t.Errorf("Expected the attempts to restart, got %v, %v", exhausted, err)
+	}
+}
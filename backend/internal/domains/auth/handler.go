@@ -1,13 +1,20 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"social-app/api/auth"
 	"social-app/api/profile"
 	"social-app/pkg/middleware"
+	"social-app/pkg/rbac"
+	"social-app/pkg/sso"
 )
 
 type Handler struct {
@@ -22,24 +29,28 @@ func NewHandler(uc UseCase) Handler {
 
 // Register godoc
 // @Summary      Register a user
-// @Description  Register a new user
+// @Description  Register a new user. An invite code is required when registration is invite-only.
 // @Tags         users
 // @Accept       json
 // @Produce      json
 // @Param        input body auth.RegisterInput true "User registration input"
 // @Success      200 {object} map[string]string "registration successful"
-// @Failure      400 {object} map[string]string "Invalid input binding"
+// @Failure      400 {object} map[string]string "Invalid input binding or invite code"
+// @Failure      403 {object} map[string]string "Registration closed or invite required"
 // @Failure      500 {object} map[string]string "Failed to register user"
 // @Router       /register [post]
 func (h Handler) Register(c *gin.Context) {
 	input := auth.RegisterInput{}
-	if err := c.BindJSON(&input); err != nil {
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
 	}
 
 	_, err := h.usecase.Register(c.Request.Context(), input)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
+		if !writeRegistrationError(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
+		}
 		return
 	}
 
@@ -55,18 +66,37 @@ func (h Handler) Register(c *gin.Context) {
 // @Param        input body auth.LoginInput true "User login input"
 // @Success      200 {object} map[string]string "JWT token"
 // @Failure      400 {object} map[string]string "Invalid input binding"
+// @Failure      401 {object} map[string]string "Invalid credentials"
+// @Failure      429 {object} map[string]string "Too many attempts"
 // @Failure      500 {object} map[string]string "Failed to login user"
 // @Router       /login [post]
 func (h Handler) Login(c *gin.Context) {
 	input := auth.LoginInput{}
-	if err := c.BindJSON(&input); err != nil {
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
 	}
 
-	jwt, err := h.usecase.Login(c.Request.Context(), input)
+	client := clientInfo(c.Request, c.ClientIP())
+	client.Device = input.Device
+
+	jwt, err := h.usecase.Login(c.Request.Context(), input, client)
 	if err != nil {
-		fmt.Println("Error during login:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to login user"})
+		switch {
+		case errors.Is(err, ErrTooManyAttempts):
+			setRetryAfter(c.Writer.Header(), err)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, try again later"})
+		case errors.Is(err, ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		default:
+			fmt.Println("Error during login:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to login user"})
+		}
+		return
+	}
+
+	if jwt.TwoFactorToken != "" {
+		c.JSON(http.StatusAccepted, twoFactorResponse(jwt))
 		return
 	}
 
@@ -94,7 +124,12 @@ func (h Handler) Login(c *gin.Context) {
 // @Router       /logout [post]
 // @Security BearerAuth
 func (h Handler) Logout(c *middleware.Context) {
-	err := h.usecase.Logout(c.Request.Context(), c.User.ID)
+	err := h.usecase.Logout(c.Request.Context(), auth.LogoutInput{
+		UserID:    c.User.ID,
+		SessionID: c.Token.SessionID,
+		TokenID:   c.Token.ID,
+		ExpiresAt: c.Token.ExpiresAt,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout user"})
 		return
@@ -102,9 +137,66 @@ func (h Handler) Logout(c *middleware.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
 }
 
-func (h Handler) RefreshToken(c *middleware.Context) {
-	jwt, err := h.usecase.RefreshToken(c.Request.Context(), c.User.ID)
+// RevokeSessions godoc
+// @Summary      Revoke all sessions of a user
+// @Description  Deny every access token and refresh token issued to the user. Allowed for the user themselves or with the users:manage permission.
+// @Tags         users
+// @Produce      json
+// @Param        id   path      int  true  "User ID"
+// @Success      200 {object} map[string]string "sessions revoked"
+// @Failure      400 {object} map[string]string "Invalid user ID"
+// @Failure      403 {object} map[string]string "Forbidden"
+// @Failure      500 {object} map[string]string "Failed to revoke sessions"
+// @Router       /users/{id}/sessions/revoke [post]
+// @Security BearerAuth
+func (h Handler) RevokeSessions(c *middleware.Context) {
+	userID, err := c.GetUint64("id")
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if userID != c.User.ID && !rbac.Has(c.Permissions, rbac.UsersManage) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+		return
+	}
+
+	if err := h.usecase.RevokeAllSessions(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "sessions revoked"})
+}
+
+// RefreshToken godoc
+// @Summary      Refresh tokens
+// @Description  Rotate a refresh token and issue a new token set
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.RefreshInput false "Refresh token, when not sent as a bearer token"
+// @Success      200 {object} auth.JWTToken
+// @Failure      401 {object} map[string]string "Invalid refresh token"
+// @Failure      500 {object} map[string]string "Failed to refresh token"
+// @Router       /refresh [post]
+func (h Handler) RefreshToken(c *gin.Context) {
+	token := middleware.ExtractToken(c)
+	if token == "" {
+		var input auth.RefreshInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing refresh token"})
+			return
+		}
+		token = input.RefreshToken
+	}
+
+	jwt, err := h.usecase.RefreshToken(c.Request.Context(), token)
 	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
 		return
 	}
@@ -112,6 +204,60 @@ func (h Handler) RefreshToken(c *middleware.Context) {
 	c.JSON(http.StatusOK, jwt)
 }
 
+// ForgotPassword godoc
+// @Summary      Request a password reset
+// @Description  Email a single-use reset link. The response is the same whether or not the email belongs to an account.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.ForgotPasswordInput true "Account email"
+// @Success      202 {object} map[string]string "reset link sent if the account exists"
+// @Failure      400 {object} map[string]string "Invalid input binding"
+// @Router       /password/forgot [post]
+func (h Handler) ForgotPassword(c *gin.Context) {
+	var input auth.ForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
+	}
+
+	if err := h.usecase.ForgotPassword(c.Request.Context(), input.Email); err != nil {
+		log.Printf("[Auth] Failed to request password reset: %v", err)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an account exists for this email, a reset link has been sent"})
+}
+
+// ResetPassword godoc
+// @Summary      Reset a password
+// @Description  Set a new password with the token from the reset link and revoke every session
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.ResetPasswordInput true "Reset token and new password"
+// @Success      200 {object} map[string]string "password reset"
+// @Failure      400 {object} map[string]string "Invalid or expired reset token"
+// @Failure      500 {object} map[string]string "Failed to reset password"
+// @Router       /password/reset [post]
+func (h Handler) ResetPassword(c *gin.Context) {
+	var input auth.ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
+	}
+
+	if err := h.usecase.ResetPassword(c.Request.Context(), input); err != nil {
+		if errors.Is(err, ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset"})
+}
+
 func (h Handler) Verify(c *middleware.Context) {
 	var input profile.VerifyCodeInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -119,8 +265,17 @@ func (h Handler) Verify(c *middleware.Context) {
 		return
 	}
 
-	tk, err := h.usecase.Verify(c.Request.Context(), input.UserID, input.Code)
+	tk, err := h.usecase.Verify(c.Request.Context(), input.UserID, input.Type, input.Code, clientInfo(c.Request, c.ClientIP()))
 	if err != nil {
+		if errors.Is(err, ErrTooManyAttempts) {
+			setRetryAfter(c.Writer.Header(), err)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Trop de tentatives, réessayez plus tard"})
+			return
+		}
+		if errors.Is(err, ErrPhoneTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Ce numéro de téléphone est déjà utilisé"})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Échec de la vérification"})
 		return
 	}
@@ -135,31 +290,112 @@ func (h Handler) RequestVerification(c *middleware.Context) {
 		return
 	}
 
-	if input.Type == "email" {
-		err := h.usecase.SendEmailVerification(c.Request.Context(), input.UserID)
-		if err != nil {
+	switch input.Type {
+	case profile.ChannelEmail:
+		if err := h.usecase.SendEmailVerification(c.Request.Context(), input.UserID); err != nil {
+			if errors.Is(err, ErrNoEmail) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Aucune adresse email enregistrée"})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l’envoi du code email"})
 			return
 		}
-	}
-	if input.Type == "phone" {
-		err := h.usecase.SendPhoneVerification(c.Request.Context(), input.UserID)
-		if err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Code email envoyé"})
+	case profile.ChannelSMS:
+		if err := h.usecase.SendPhoneVerification(c.Request.Context(), input.UserID); err != nil {
+			if errors.Is(err, ErrNoPhone) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Aucun numéro de téléphone enregistré"})
+				return
+			}
+			if errors.Is(err, ErrTooManyAttempts) {
+				setRetryAfter(c.Writer.Header(), err)
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": "Trop de SMS envoyés, réessayez plus tard"})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l’envoi du code SMS"})
 			return
 		}
+		c.JSON(http.StatusOK, gin.H{"message": "Code SMS envoyé"})
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Code email envoyé"})
 }
 
+// Registration godoc
+// @Summary      Get the registration mode
+// @Description  Whether anyone can sign up (open), only with an invite code (invite), or nobody (closed)
+// @Tags         users
+// @Produce      json
+// @Success      200 {object} map[string]string "mode"
+// @Router       /registration [get]
+func (h Handler) Registration(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"mode": h.usecase.RegistrationMode()})
+}
+
+// OauthProviders godoc
+// @Summary      List login providers
+// @Description  Names of the configured SSO providers, usable in /oauth/{provider}/login
+// @Tags         users
+// @Produce      json
+// @Success      200 {object} map[string]interface{} "providers"
+// @Router       /oauth/providers [get]
+func (h Handler) OauthProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.usecase.OauthProviders()})
+}
+
+// OauthLogin godoc
+// @Summary      Start an SSO login
+// @Description  Return the authorization URL of the provider
+// @Tags         users
+// @Produce      json
+// @Param        provider path string true "Provider name (google, github, gitlab...)"
+// @Param        redirect query string false "Where to go after login: a relative path or an allowed origin"
+// @Param        invite   query string false "Invite code, used if the login signs up a new user"
+// @Success      200 {object} map[string]string "oauth_url"
+// @Failure      400 {object} map[string]string "Redirect target not allowed"
+// @Failure      404 {object} map[string]string "Unknown provider"
+// @Failure      502 {object} map[string]string "Provider unavailable"
+// @Router       /oauth/{provider}/login [get]
 func (h Handler) OauthLogin(context *gin.Context) {
-	resp := h.usecase.OauthLogin(context.Request.Context())
+	var input auth.OauthLoginInput
+	if err := context.ShouldBindQuery(&input); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OAuth input"})
+		return
+	}
+
+	resp, err := h.usecase.OauthLogin(context.Request.Context(), context.Param("provider"), input)
+	if err != nil {
+		if errors.Is(err, sso.ErrUnknownProvider) {
+			context.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+			return
+		}
+		if errors.Is(err, sso.ErrRedirectNotAllowed) {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "Redirect target not allowed"})
+			return
+		}
+		context.JSON(http.StatusBadGateway, gin.H{"error": "Login provider unavailable"})
+		return
+	}
 
 	context.JSON(http.StatusOK, gin.H{
 		"oauth_url": resp,
 	})
 }
 
+// OauthCallback godoc
+// @Summary      Complete an SSO login
+// @Description  Exchange the authorization code and log the user in
+// @Tags         users
+// @Produce      json
+// @Param        provider path string true "Provider name (google, github, gitlab...)"
+// @Param        code query string true "Authorization code"
+// @Param        state query string true "State returned by the provider"
+// @Success      200 {object} map[string]string "Tokens and redirect target"
+// @Success      202 {object} map[string]interface{} "Verification or second factor required"
+// @Failure      400 {object} map[string]string "Invalid OAuth input, state or invite code"
+// @Failure      403 {object} map[string]string "Registration closed or invite required"
+// @Failure      404 {object} map[string]string "Unknown provider"
+// @Failure      409 {object} map[string]string "Email used by another account"
+// @Failure      500 {object} map[string]string "Failed to complete OAuth login"
+// @Router       /oauth/{provider}/callback [get]
 func (h Handler) OauthCallback(context *gin.Context) {
 	var input auth.OauthInput
 	if err := context.ShouldBindQuery(&input); err != nil {
@@ -167,17 +403,44 @@ func (h Handler) OauthCallback(context *gin.Context) {
 		return
 	}
 
-	jwt, err := h.usecase.OauthCallback(context.Request.Context(), input)
+	jwt, err := h.usecase.OauthCallback(context.Request.Context(), context.Param("provider"), input, clientInfo(context.Request, context.ClientIP()))
 	if err != nil {
+		if errors.Is(err, sso.ErrUnknownProvider) {
+			context.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+			return
+		}
+		if errors.Is(err, ErrInvalidOAuthState) {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired OAuth state"})
+			return
+		}
+		if errors.Is(err, ErrMissingEmail) {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "The login provider did not share an email address"})
+			return
+		}
+		if errors.Is(err, ErrIdentityConflict) {
+			context.JSON(http.StatusConflict, gin.H{"error": "An account already uses this email: log in and link this provider from your settings"})
+			return
+		}
+		if writeRegistrationError(context, err) {
+			return
+		}
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete OAuth login"})
 		return
 	}
 
+	if jwt.TwoFactorToken != "" {
+		resp := twoFactorResponse(jwt)
+		resp["redirect"] = jwt.Redirect
+		context.JSON(http.StatusAccepted, resp)
+		return
+	}
+
 	if !jwt.VerifyResponse.IsEmpty() {
 		context.JSON(http.StatusAccepted, gin.H{
 			"verified": false,
 			"id":       jwt.VerifyResponse.ID,
 			"username": jwt.VerifyResponse.Username,
+			"redirect": jwt.Redirect,
 		})
 		return
 	}
@@ -186,15 +449,1024 @@ func (h Handler) OauthCallback(context *gin.Context) {
 		"access_token":  jwt.AccessToken,
 		"refresh_token": jwt.RefreshToken,
 		"id_token":      jwt.IDToken,
+		"redirect":      jwt.Redirect,
 	})
 }
 
-func (h Handler) IsUserOnline(context *middleware.Context) {
-	isOnline, err := h.usecase.IsUserOnline(context.Request.Context(), context.User.ID)
+// ListIdentities godoc
+// @Summary      List linked identities
+// @Description  List the login provider accounts linked to the current user
+// @Tags         identities
+// @Produce      json
+// @Success      200 {array}  map[string]interface{} "Identities"
+// @Failure      500 {object} map[string]string "Failed to list identities"
+// @Router       /identities [get]
+// @Security BearerAuth
+func (h Handler) ListIdentities(c *middleware.Context) {
+	identities, err := h.usecase.ListIdentities(c.Request.Context(), c.User.ID)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user online status"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list identities"})
 		return
 	}
 
-	context.JSON(http.StatusOK, gin.H{"is_online": isOnline})
+	c.JSON(http.StatusOK, identities)
+}
+
+// OauthLink godoc
+// @Summary      Start linking a provider account
+// @Description  Return the authorization URL to link a provider account to the current user
+// @Tags         identities
+// @Produce      json
+// @Param        provider path string true "Provider name (google, github, gitlab...)"
+// @Param        redirect query string false "Where to go once linked: a relative path or an allowed origin"
+// @Success      200 {object} map[string]string "oauth_url"
+// @Failure      400 {object} map[string]string "Redirect target not allowed"
+// @Failure      404 {object} map[string]string "Unknown provider"
+// @Failure      502 {object} map[string]string "Provider unavailable"
+// @Router       /oauth/{provider}/link [get]
+// @Security BearerAuth
+func (h Handler) OauthLink(c *middleware.Context) {
+	input := auth.OauthLoginInput{Redirect: c.Query("redirect")}
+
+	resp, err := h.usecase.OauthLink(c.Request.Context(), c.User.ID, c.Param("provider"), input)
+	if err != nil {
+		if errors.Is(err, sso.ErrUnknownProvider) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+			return
+		}
+		if errors.Is(err, sso.ErrRedirectNotAllowed) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Redirect target not allowed"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Login provider unavailable"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"oauth_url": resp})
+}
+
+// LinkIdentity godoc
+// @Summary      Link a provider account
+// @Description  Complete the link started with GET /oauth/{provider}/link
+// @Tags         identities
+// @Accept       json
+// @Produce      json
+// @Param        provider path string true "Provider name (google, github, gitlab...)"
+// @Param        input body auth.OauthInput true "Code and state returned by the provider"
+// @Success      201 {object} map[string]interface{} "Linked identity"
+// @Failure      400 {object} map[string]string "Invalid OAuth input or state"
+// @Failure      404 {object} map[string]string "Unknown provider"
+// @Failure      409 {object} map[string]string "Provider account linked to another user"
+// @Failure      500 {object} map[string]string "Failed to link identity"
+// @Router       /oauth/{provider}/link [post]
+// @Security BearerAuth
+func (h Handler) LinkIdentity(c *middleware.Context) {
+	var input auth.OauthInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OAuth input"})
+		return
+	}
+
+	identity, err := h.usecase.LinkIdentity(c.Request.Context(), c.User.ID, c.Param("provider"), input)
+	if err != nil {
+		if errors.Is(err, sso.ErrUnknownProvider) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+			return
+		}
+		if errors.Is(err, ErrInvalidOAuthState) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired OAuth state"})
+			return
+		}
+		if errors.Is(err, ErrIdentityConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "This provider account is linked to another user"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link identity"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, identity)
+}
+
+// UnlinkIdentity godoc
+// @Summary      Unlink a provider account
+// @Description  Remove a linked provider account. The last way to log in cannot be removed.
+// @Tags         identities
+// @Produce      json
+// @Param        id   path      int  true  "Identity ID"
+// @Success      200 {object} map[string]string "identity unlinked"
+// @Failure      400 {object} map[string]string "Invalid identity ID"
+// @Failure      404 {object} map[string]string "Identity not found"
+// @Failure      409 {object} map[string]string "Last login method"
+// @Failure      500 {object} map[string]string "Failed to unlink identity"
+// @Router       /identities/{id} [delete]
+// @Security BearerAuth
+func (h Handler) UnlinkIdentity(c *middleware.Context) {
+	id, err := c.GetUint64("id")
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid identity ID"})
+		return
+	}
+
+	if err := h.usecase.UnlinkIdentity(c.Request.Context(), c.User.ID, id); err != nil {
+		if errors.Is(err, ErrIdentityNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+			return
+		}
+		if errors.Is(err, ErrLastLoginMethod) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Set a password or link another account before unlinking this one"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink identity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "identity unlinked"})
+}
+
+// GetEmailChange godoc
+// @Summary      Get the pending email change
+// @Description  Return the email change waiting for its confirmation code
+// @Tags         users
+// @Produce      json
+// @Success      200 {object} map[string]interface{} "Pending email change"
+// @Failure      404 {object} map[string]string "No pending email change"
+// @Failure      500 {object} map[string]string "Failed to get email change"
+// @Router       /email/change [get]
+// @Security BearerAuth
+func (h Handler) GetEmailChange(c *middleware.Context) {
+	change, err := h.usecase.GetPendingEmailChange(c.Request.Context(), c.User.ID)
+	if err != nil {
+		writeEmailChangeError(c, err, "Failed to get email change")
+		return
+	}
+
+	c.JSON(http.StatusOK, change)
+}
+
+// RequestEmailChange godoc
+// @Summary      Request an email change
+// @Description  Send a code to the new address and a notice with a cancel link to the old one. The email only changes once the code is confirmed.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.EmailChangeInput true "New email and current password"
+// @Success      202 {object} map[string]interface{} "Pending email change"
+// @Failure      400 {object} map[string]string "Invalid input or same email"
+// @Failure      401 {object} map[string]string "Invalid password"
+// @Failure      409 {object} map[string]string "Email already in use"
+// @Failure      429 {object} map[string]string "Too many attempts"
+// @Failure      500 {object} map[string]string "Failed to request email change"
+// @Router       /email/change [post]
+// @Security BearerAuth
+func (h Handler) RequestEmailChange(c *middleware.Context) {
+	var input auth.EmailChangeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
+	}
+
+	change, err := h.usecase.RequestEmailChange(c.Request.Context(), c.User.ID, input, clientInfo(c.Request, c.ClientIP()))
+	if err != nil {
+		writeEmailChangeError(c, err, "Failed to request email change")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, change)
+}
+
+// ConfirmEmailChange godoc
+// @Summary      Confirm an email change
+// @Description  Apply the pending email change with the code sent to the new address
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.EmailChangeConfirmInput true "Code sent to the new address"
+// @Success      200 {object} models.User
+// @Failure      400 {object} map[string]string "Invalid code"
+// @Failure      404 {object} map[string]string "No pending email change"
+// @Failure      409 {object} map[string]string "Email already in use"
+// @Failure      429 {object} map[string]string "Too many attempts"
+// @Failure      500 {object} map[string]string "Failed to confirm email change"
+// @Router       /email/change/confirm [post]
+// @Security BearerAuth
+func (h Handler) ConfirmEmailChange(c *middleware.Context) {
+	var input auth.EmailChangeConfirmInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
+	}
+
+	user, err := h.usecase.ConfirmEmailChange(c.Request.Context(), c.User.ID, input.Code, clientInfo(c.Request, c.ClientIP()))
+	if err != nil {
+		writeEmailChangeError(c, err, "Failed to confirm email change")
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// CancelEmailChange godoc
+// @Summary      Cancel the pending email change
+// @Tags         users
+// @Produce      json
+// @Success      200 {object} map[string]string "email change canceled"
+// @Failure      404 {object} map[string]string "No pending email change"
+// @Failure      500 {object} map[string]string "Failed to cancel email change"
+// @Router       /email/change [delete]
+// @Security BearerAuth
+func (h Handler) CancelEmailChange(c *middleware.Context) {
+	if err := h.usecase.CancelEmailChange(c.Request.Context(), c.User.ID); err != nil {
+		writeEmailChangeError(c, err, "Failed to cancel email change")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email change canceled"})
+}
+
+// CancelEmailChangeByToken godoc
+// @Summary      Cancel an email change from the old address
+// @Description  Use the link sent to the old address. A change that was already confirmed is reverted and every session is revoked.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.EmailChangeCancelInput true "Token from the cancel link"
+// @Success      200 {object} map[string]string "email change canceled"
+// @Failure      400 {object} map[string]string "Invalid input binding"
+// @Failure      404 {object} map[string]string "Unknown or expired link"
+// @Failure      409 {object} map[string]string "Old email now in use"
+// @Failure      500 {object} map[string]string "Failed to cancel email change"
+// @Router       /email/change/cancel [post]
+func (h Handler) CancelEmailChangeByToken(c *gin.Context) {
+	var input auth.EmailChangeCancelInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
+	}
+
+	if err := h.usecase.CancelEmailChangeByToken(c.Request.Context(), input.Token); err != nil {
+		switch {
+		case errors.Is(err, ErrEmailChangeNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "This link is invalid or has expired"})
+		case errors.Is(err, ErrEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": "The previous email is now used by another account"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel email change"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email change canceled"})
+}
+
+func writeEmailChangeError(c *middleware.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, ErrTooManyAttempts):
+		setRetryAfter(c.Writer.Header(), err)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, try again later"})
+	case errors.Is(err, ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+	case errors.Is(err, ErrInvalidCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+	case errors.Is(err, ErrSameEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This is already your email"})
+	case errors.Is(err, ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
+	case errors.Is(err, ErrEmailChangeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending email change"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GetPhone godoc
+// @Summary      Get the phone number
+// @Tags         users
+// @Produce      json
+// @Success      200 {object} auth.PhoneOutput
+// @Failure      404 {object} map[string]string "No phone number"
+// @Failure      500 {object} map[string]string "Failed to get phone number"
+// @Router       /phone [get]
+// @Security BearerAuth
+func (h Handler) GetPhone(c *middleware.Context) {
+	phone, err := h.usecase.GetPhone(c.Request.Context(), c.User.ID)
+	if err != nil {
+		writePhoneError(c, err, "Failed to get phone number")
+		return
+	}
+
+	c.JSON(http.StatusOK, phone)
+}
+
+// SetPhone godoc
+// @Summary      Set the phone number
+// @Description  Save an E.164 phone number (e.g. +33612345678) and send it a code by SMS. It stays unverified until the code is confirmed. Codes are spaced by LOCKOUT_SMS_COOLDOWN and capped at LOCKOUT_SMS_DAILY_MAX a day, per account and per number.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.PhoneInput true "Phone number"
+// @Success      202 {object} auth.PhoneOutput
+// @Failure      400 {object} map[string]string "Invalid phone number"
+// @Failure      409 {object} map[string]string "Phone number already in use or verified"
+// @Failure      429 {object} map[string]string "Too many SMS sent"
+// @Failure      500 {object} map[string]string "Failed to set phone number"
+// @Router       /phone [put]
+// @Security BearerAuth
+func (h Handler) SetPhone(c *middleware.Context) {
+	var input auth.PhoneInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Phone number must be in E.164 format, e.g. +33612345678"})
+		return
+	}
+
+	phone, err := h.usecase.SetPhone(c.Request.Context(), c.User.ID, input.Phone)
+	if err != nil {
+		writePhoneError(c, err, "Failed to set phone number")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, phone)
+}
+
+// VerifyPhone godoc
+// @Summary      Verify the phone number
+// @Description  Confirm the phone number with the code sent to it by SMS
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.PhoneVerifyInput true "Code sent by SMS"
+// @Success      200 {object} auth.PhoneOutput
+// @Failure      400 {object} map[string]string "Invalid code"
+// @Failure      404 {object} map[string]string "No phone number"
+// @Failure      409 {object} map[string]string "Phone number already in use or verified"
+// @Failure      429 {object} map[string]string "Too many attempts"
+// @Failure      500 {object} map[string]string "Failed to verify phone number"
+// @Router       /phone/verify [post]
+// @Security BearerAuth
+func (h Handler) VerifyPhone(c *middleware.Context) {
+	var input auth.PhoneVerifyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
+	}
+
+	phone, err := h.usecase.VerifyPhone(c.Request.Context(), c.User.ID, input.Code, clientInfo(c.Request, c.ClientIP()))
+	if err != nil {
+		writePhoneError(c, err, "Failed to verify phone number")
+		return
+	}
+
+	c.JSON(http.StatusOK, phone)
+}
+
+// RemovePhone godoc
+// @Summary      Remove the phone number
+// @Tags         users
+// @Produce      json
+// @Success      200 {object} map[string]string "phone number removed"
+// @Failure      404 {object} map[string]string "No phone number"
+// @Failure      500 {object} map[string]string "Failed to remove phone number"
+// @Router       /phone [delete]
+// @Security BearerAuth
+func (h Handler) RemovePhone(c *middleware.Context) {
+	if err := h.usecase.RemovePhone(c.Request.Context(), c.User.ID); err != nil {
+		writePhoneError(c, err, "Failed to remove phone number")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "phone number removed"})
+}
+
+func writePhoneError(c *middleware.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, ErrTooManyAttempts):
+		setRetryAfter(c.Writer.Header(), err)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, try again later"})
+	case errors.Is(err, ErrInvalidCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+	case errors.Is(err, ErrNoPhone):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No phone number"})
+	case errors.Is(err, ErrPhoneTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Phone number already in use"})
+	case errors.Is(err, ErrPhoneAlreadyVerified):
+		c.JSON(http.StatusConflict, gin.H{"error": "Phone number already verified"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// ListPersonalTokens godoc
+// @Summary      List personal access tokens
+// @Description  Tokens for scripts and bots, newest first. The tokens themselves are never shown again after creation.
+// @Tags         tokens
+// @Produce      json
+// @Success      200 {array}  auth.PersonalToken
+// @Failure      500 {object} map[string]string "Failed to list tokens"
+// @Router       /tokens [get]
+// @Security BearerAuth
+func (h Handler) ListPersonalTokens(c *middleware.Context) {
+	pats, err := h.usecase.ListPersonalTokens(c.Request.Context(), c.User.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pats)
+}
+
+// CreatePersonalToken godoc
+// @Summary      Create a personal access token
+// @Description  Issue a token limited to the given scopes (e.g. posts:write, chat:read), to send as "Authorization: Bearer <token>". The token is only shown in this response.
+// @Tags         tokens
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.PersonalTokenInput true "Name, scopes and lifetime"
+// @Success      201 {object} auth.PersonalToken
+// @Failure      400 {object} map[string]string "Invalid input or unknown scope"
+// @Failure      403 {object} map[string]string "Scope not granted to the user"
+// @Failure      409 {object} map[string]string "Too many tokens"
+// @Failure      500 {object} map[string]string "Failed to create token"
+// @Router       /tokens [post]
+// @Security BearerAuth
+func (h Handler) CreatePersonalToken(c *middleware.Context) {
+	var input auth.PersonalTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
+	}
+
+	pat, err := h.usecase.CreatePersonalToken(c.Request.Context(), c.User.ID, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, rbac.ErrUnknownPermission):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrScopeNotGranted):
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot grant a token permissions you do not hold"})
+		case errors.Is(err, ErrTooManyPersonalTokens):
+			c.JSON(http.StatusConflict, gin.H{"error": "Too many tokens, revoke one first"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, pat)
+}
+
+// RevokePersonalToken godoc
+// @Summary      Revoke a personal access token
+// @Tags         tokens
+// @Produce      json
+// @Param        id path int true "Token ID"
+// @Success      200 {object} map[string]string "token revoked"
+// @Failure      400 {object} map[string]string "Invalid token ID"
+// @Failure      404 {object} map[string]string "Token not found"
+// @Failure      500 {object} map[string]string "Failed to revoke token"
+// @Router       /tokens/{id} [delete]
+// @Security BearerAuth
+func (h Handler) RevokePersonalToken(c *middleware.Context) {
+	id, err := c.GetUint64("id")
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	if err := h.usecase.RevokePersonalToken(c.Request.Context(), c.User.ID, id); err != nil {
+		if errors.Is(err, ErrPersonalTokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "token revoked"})
+}
+
+// ListInvites godoc
+// @Summary      List invite codes
+// @Description  Invites created by the user, newest first. all=true lists every invite and requires invites:manage.
+// @Tags         invites
+// @Produce      json
+// @Param        all query bool false "List the invites of every user"
+// @Success      200 {array}  models.Invite
+// @Failure      500 {object} map[string]string "Failed to list invites"
+// @Router       /invites [get]
+// @Security BearerAuth
+func (h Handler) ListInvites(c *middleware.Context) {
+	invites, err := h.usecase.ListInvites(c.Request.Context(), c.User.ID, c.Permissions, c.Query("all") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list invites"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// CreateInvite godoc
+// @Summary      Create an invite code
+// @Description  Requires invites:create. Without invites:manage, the number of uses and of active invites is limited.
+// @Tags         invites
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.InviteInput true "Uses, lifetime and note"
+// @Success      201 {object} models.Invite
+// @Failure      400 {object} map[string]string "Invalid input or too many uses"
+// @Failure      403 {object} map[string]string "Forbidden"
+// @Failure      409 {object} map[string]string "Too many active invites"
+// @Failure      500 {object} map[string]string "Failed to create invite"
+// @Router       /invites [post]
+// @Security BearerAuth
+func (h Handler) CreateInvite(c *middleware.Context) {
+	var input auth.InviteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
+	}
+
+	invite, err := h.usecase.CreateInvite(c.Request.Context(), c.User.ID, c.Permissions, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInviteUsesTooHigh):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invite allows too many uses"})
+		case errors.Is(err, ErrTooManyInvites):
+			c.JSON(http.StatusConflict, gin.H{"error": "Too many active invites, revoke one first"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, invite)
+}
+
+// RevokeInvite godoc
+// @Summary      Revoke an invite code
+// @Description  Revoke one of your invites, or any invite with invites:manage. Users who already signed up with it are kept.
+// @Tags         invites
+// @Produce      json
+// @Param        id path int true "Invite ID"
+// @Success      200 {object} map[string]string "invite revoked"
+// @Failure      400 {object} map[string]string "Invalid invite ID"
+// @Failure      404 {object} map[string]string "Invite not found"
+// @Failure      500 {object} map[string]string "Failed to revoke invite"
+// @Router       /invites/{id} [delete]
+// @Security BearerAuth
+func (h Handler) RevokeInvite(c *middleware.Context) {
+	id, err := c.GetUint64("id")
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite ID"})
+		return
+	}
+
+	if err := h.usecase.RevokeInvite(c.Request.Context(), c.User.ID, c.Permissions, id); err != nil {
+		if errors.Is(err, ErrInviteNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invite"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "invite revoked"})
+}
+
+// ListInvitees godoc
+// @Summary      List invited users
+// @Description  Users who signed up with one of your invite codes, newest first
+// @Tags         invites
+// @Produce      json
+// @Success      200 {array}  models.User
+// @Failure      500 {object} map[string]string "Failed to list invited users"
+// @Router       /invitees [get]
+// @Security BearerAuth
+func (h Handler) ListInvitees(c *middleware.Context) {
+	users, err := h.usecase.ListInvitees(c.Request.Context(), c.User.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list invited users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// SetupTOTP godoc
+// @Summary      Start TOTP enrollment
+// @Description  Generate a TOTP secret and its otpauth:// URI for QR codes
+// @Tags         2fa
+// @Produce      json
+// @Success      200 {object} auth.TOTPSetup
+// @Failure      409 {object} map[string]string "TOTP already enabled"
+// @Failure      500 {object} map[string]string "Failed to set up TOTP"
+// @Router       /2fa/totp/setup [post]
+// @Security BearerAuth
+func (h Handler) SetupTOTP(c *middleware.Context) {
+	setup, err := h.usecase.SetupTOTP(c.Request.Context(), c.User.ID)
+	if err != nil {
+		if errors.Is(err, ErrTOTPAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "TOTP already enabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up TOTP"})
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+// ConfirmTOTP godoc
+// @Summary      Confirm TOTP enrollment
+// @Description  Enable TOTP with a first valid code and return the recovery codes
+// @Tags         2fa
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.TwoFactorCodeInput true "TOTP code"
+// @Success      200 {object} auth.RecoveryCodes
+// @Failure      400 {object} map[string]string "Invalid code"
+// @Failure      409 {object} map[string]string "TOTP already enabled"
+// @Failure      429 {object} map[string]string "Too many attempts"
+// @Failure      500 {object} map[string]string "Failed to confirm TOTP"
+// @Router       /2fa/totp/confirm [post]
+// @Security BearerAuth
+func (h Handler) ConfirmTOTP(c *middleware.Context) {
+	var input auth.TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, err := h.usecase.ConfirmTOTP(c.Request.Context(), c.User.ID, input.Code, clientInfo(c.Request, c.ClientIP()))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTooManyAttempts):
+			setRetryAfter(c.Writer.Header(), err)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, try again later"})
+		case errors.Is(err, ErrInvalidTwoFactorCode), errors.Is(err, ErrTOTPNotEnrolled):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		case errors.Is(err, ErrTOTPAlreadyEnabled):
+			c.JSON(http.StatusConflict, gin.H{"error": "TOTP already enabled"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm TOTP"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, codes)
+}
+
+// DisableTOTP godoc
+// @Summary      Disable TOTP
+// @Description  Disable TOTP with a valid TOTP or recovery code, and the password for users who have one
+// @Tags         2fa
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.DisableTOTPInput true "TOTP or recovery code, and password"
+// @Success      200 {object} map[string]string "TOTP disabled"
+// @Failure      400 {object} map[string]string "Invalid code"
+// @Failure      401 {object} map[string]string "Invalid password"
+// @Failure      429 {object} map[string]string "Too many attempts"
+// @Failure      500 {object} map[string]string "Failed to disable TOTP"
+// @Router       /2fa/totp/disable [post]
+// @Security BearerAuth
+func (h Handler) DisableTOTP(c *middleware.Context) {
+	var input auth.DisableTOTPInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if err := h.usecase.DisableTOTP(c.Request.Context(), c.User.ID, input, clientInfo(c.Request, c.ClientIP())); err != nil {
+		switch {
+		case errors.Is(err, ErrTooManyAttempts):
+			setRetryAfter(c.Writer.Header(), err)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, try again later"})
+		case errors.Is(err, ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		case errors.Is(err, ErrInvalidTwoFactorCode), errors.Is(err, ErrTOTPNotEnrolled):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable TOTP"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "TOTP disabled"})
+}
+
+// VerifyTwoFactor godoc
+// @Summary      Complete a two-factor login
+// @Description  Exchange the need_2fa token returned by /login and a TOTP or recovery code for a session
+// @Tags         2fa
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.TwoFactorCodeInput true "TOTP or recovery code"
+// @Success      200 {object} auth.JWTToken
+// @Failure      400 {object} map[string]string "Invalid code"
+// @Failure      429 {object} map[string]string "Too many attempts"
+// @Failure      500 {object} map[string]string "Failed to verify code"
+// @Router       /2fa/verify [post]
+// @Security BearerAuth
+func (h Handler) VerifyTwoFactor(c *middleware.Context) {
+	var input auth.TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	tk, err := h.usecase.VerifyTwoFactor(c.Request.Context(), auth.TwoFactorInput{
+		UserID:    c.User.ID,
+		Code:      input.Code,
+		TokenID:   c.Token.ID,
+		ExpiresAt: c.Token.ExpiresAt,
+	}, clientInfo(c.Request, c.ClientIP()))
+	if err != nil {
+		if errors.Is(err, ErrTooManyAttempts) {
+			setRetryAfter(c.Writer.Header(), err)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, try again later"})
+			return
+		}
+		if errors.Is(err, ErrInvalidTwoFactorCode) || errors.Is(err, ErrTOTPNotEnrolled) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tk)
+}
+
+// ListSessions godoc
+// @Summary      List sessions
+// @Description  List the active sessions of the current user
+// @Tags         users
+// @Produce      json
+// @Success      200 {array}  models.Session
+// @Failure      500 {object} map[string]string "Failed to list sessions"
+// @Router       /sessions [get]
+// @Security BearerAuth
+func (h Handler) ListSessions(c *middleware.Context) {
+	sessions, err := h.usecase.ListSessions(c.Request.Context(), c.User.ID, c.Token.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession godoc
+// @Summary      Revoke a session
+// @Description  Sign out the device holding the given session
+// @Tags         users
+// @Produce      json
+// @Param        id   path      string  true  "Session UUID"
+// @Success      200 {object} map[string]string "session revoked"
+// @Failure      400 {object} map[string]string "Invalid session ID"
+// @Failure      404 {object} map[string]string "Session not found"
+// @Failure      500 {object} map[string]string "Failed to revoke session"
+// @Router       /sessions/{id} [delete]
+// @Security BearerAuth
+func (h Handler) RevokeSession(c *middleware.Context) {
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := h.usecase.RevokeSession(c.Request.Context(), c.User.ID, sessionID); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
+
+// JWKS godoc
+// @Summary      JSON Web Key Set
+// @Description  Public keys used to verify tokens issued by this service
+// @Tags         users
+// @Produce      json
+// @Success      200 {object} map[string]interface{} "JSON Web Key Set"
+// @Failure      500 {object} map[string]string "Failed to load signing keys"
+// @Router       /.well-known/jwks.json [get]
+func (h Handler) JWKS(c *gin.Context) {
+	set, err := h.usecase.JWKS(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load signing keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, set)
+}
+
+// BeginPasskeyRegistration godoc
+// @Summary      Start passkey registration
+// @Description  Return the options for navigator.credentials.create and the ceremony to finish
+// @Tags         passkeys
+// @Produce      json
+// @Success      200 {object} auth.PasskeyOptions
+// @Failure      500 {object} map[string]string "Failed to start passkey registration"
+// @Router       /webauthn/register/begin [post]
+// @Security BearerAuth
+func (h Handler) BeginPasskeyRegistration(c *middleware.Context) {
+	options, err := h.usecase.BeginPasskeyRegistration(c.Request.Context(), c.User.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishPasskeyRegistration godoc
+// @Summary      Finish passkey registration
+// @Description  Verify the attestation returned by the authenticator and store the passkey
+// @Tags         passkeys
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.PasskeyFinishInput true "Ceremony and attestation"
+// @Success      201 {object} map[string]interface{} "Registered passkey"
+// @Failure      400 {object} map[string]string "Invalid passkey"
+// @Failure      500 {object} map[string]string "Failed to register passkey"
+// @Router       /webauthn/register/finish [post]
+// @Security BearerAuth
+func (h Handler) FinishPasskeyRegistration(c *middleware.Context) {
+	var input auth.PasskeyFinishInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
+	}
+
+	credential, err := h.usecase.FinishPasskeyRegistration(c.Request.Context(), c.User.ID, input)
+	if err != nil {
+		if errors.Is(err, ErrInvalidPasskey) || errors.Is(err, ErrCeremonyNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register passkey"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, credential)
+}
+
+// ListPasskeys godoc
+// @Summary      List passkeys
+// @Description  List the passkeys registered by the current user
+// @Tags         passkeys
+// @Produce      json
+// @Success      200 {array}  map[string]interface{} "Passkeys"
+// @Failure      500 {object} map[string]string "Failed to list passkeys"
+// @Router       /webauthn/credentials [get]
+// @Security BearerAuth
+func (h Handler) ListPasskeys(c *middleware.Context) {
+	credentials, err := h.usecase.ListPasskeys(c.Request.Context(), c.User.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list passkeys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, credentials)
+}
+
+// DeletePasskey godoc
+// @Summary      Delete a passkey
+// @Description  Remove a passkey from the current user's account
+// @Tags         passkeys
+// @Produce      json
+// @Param        id   path      int  true  "Passkey ID"
+// @Success      200 {object} map[string]string "passkey deleted"
+// @Failure      400 {object} map[string]string "Invalid passkey ID"
+// @Failure      404 {object} map[string]string "Passkey not found"
+// @Failure      500 {object} map[string]string "Failed to delete passkey"
+// @Router       /webauthn/credentials/{id} [delete]
+// @Security BearerAuth
+func (h Handler) DeletePasskey(c *middleware.Context) {
+	id, err := c.GetUint64("id")
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return
+	}
+
+	if err := h.usecase.DeletePasskey(c.Request.Context(), c.User.ID, id); err != nil {
+		if errors.Is(err, ErrPasskeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "passkey deleted"})
+}
+
+// BeginPasskeyLogin godoc
+// @Summary      Start a passkey login
+// @Description  Return the options for navigator.credentials.get and the ceremony to finish
+// @Tags         passkeys
+// @Produce      json
+// @Success      200 {object} auth.PasskeyOptions
+// @Failure      500 {object} map[string]string "Failed to start passkey login"
+// @Router       /webauthn/login/begin [post]
+func (h Handler) BeginPasskeyLogin(c *gin.Context) {
+	options, err := h.usecase.BeginPasskeyLogin(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishPasskeyLogin godoc
+// @Summary      Finish a passkey login
+// @Description  Verify the assertion returned by the authenticator and issue a token set. The authenticator must verify the user (PIN or biometrics). An unverified account gets a new verification code instead, as with a password login.
+// @Tags         passkeys
+// @Accept       json
+// @Produce      json
+// @Param        input body auth.PasskeyFinishInput true "Ceremony and assertion"
+// @Success      200 {object} auth.JWTToken
+// @Failure      400 {object} map[string]string "Invalid input binding"
+// @Failure      401 {object} map[string]string "Invalid passkey"
+// @Failure      429 {object} map[string]string "Too many attempts"
+// @Failure      500 {object} map[string]string "Failed to login with passkey"
+// @Router       /webauthn/login/finish [post]
+func (h Handler) FinishPasskeyLogin(c *gin.Context) {
+	var input auth.PasskeyFinishInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input binding"})
+		return
+	}
+
+	jwt, err := h.usecase.FinishPasskeyLogin(c.Request.Context(), input, clientInfo(c.Request, c.ClientIP()))
+	if err != nil {
+		if errors.Is(err, ErrTooManyAttempts) {
+			setRetryAfter(c.Writer.Header(), err)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, try again later"})
+			return
+		}
+		if errors.Is(err, ErrInvalidPasskey) || errors.Is(err, ErrCeremonyNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid passkey"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to login with passkey"})
+		return
+	}
+
+	c.JSON(http.StatusOK, jwt)
+}
+
+func (h Handler) IsUserOnline(context *middleware.Context) {
+	isOnline, err := h.usecase.IsUserOnline(context.Request.Context(), context.User.ID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user online status"})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"is_online": isOnline})
+}
+
+func twoFactorResponse(jwt auth.JWTToken) gin.H {
+	return gin.H{
+		"verified":         true,
+		"need_2fa":         true,
+		"two_factor_token": jwt.TwoFactorToken,
+		"id":               jwt.VerifyResponse.ID,
+		"username":         jwt.VerifyResponse.Username,
+	}
+}
+
+func setRetryAfter(header http.Header, err error) {
+	var attempts *AttemptsError
+	if errors.As(err, &attempts) {
+		header.Set("Retry-After", strconv.Itoa(int(math.Ceil(attempts.RetryAfter.Seconds()))))
+	}
+}
+
+func clientInfo(r *http.Request, ip string) auth.ClientInfo {
+	return auth.ClientInfo{
+		UserAgent: r.UserAgent(),
+		IP:        ip,
+	}
+}
+
+// writeRegistrationError answers the errors of a sign-up refused by the
+// registration mode, and reports whether err was one of them.
+func writeRegistrationError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, ErrRegistrationClosed):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is closed"})
+	case errors.Is(err, ErrInviteRequired):
+		c.JSON(http.StatusForbidden, gin.H{"error": "An invite code is required to register"})
+	case errors.Is(err, ErrInvalidInvite):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invite code"})
+	default:
+		return false
+	}
+	return true
 }
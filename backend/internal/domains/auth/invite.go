@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"time"
+
+	"social-app/api/auth"
+	"social-app/internal/config"
+	"social-app/internal/models"
+	"social-app/pkg/rbac"
+)
+
+var (
+	ErrRegistrationClosed = errors.New("registration is closed")
+	ErrInviteRequired     = errors.New("an invite code is required")
+	ErrInvalidInvite      = errors.New("invalid or used up invite code")
+	ErrInviteNotFound     = errors.New("invite not found")
+	ErrTooManyInvites     = errors.New("too many active invites")
+	ErrInviteUsesTooHigh  = errors.New("invite allows too many uses")
+)
+
+var inviteEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func (u UseCase) RegistrationMode() string {
+	return u.authCfg.Registration.Mode
+}
+
+// checkRegistration tells whether someone may sign up with the invite code,
+// before the code itself is checked. Outside invite-only mode a code is
+// optional and only records who invited the user.
+func (u UseCase) checkRegistration(invite string) error {
+	switch u.authCfg.Registration.Mode {
+	case config.RegistrationClosed:
+		return ErrRegistrationClosed
+	case config.RegistrationInvite:
+		if invite == "" {
+			return ErrInviteRequired
+		}
+	}
+	return nil
+}
+
+// CreateInvite issues an invite code. Users holding invites:manage are not
+// bound by the per-user limits.
+func (u UseCase) CreateInvite(ctx context.Context, userID uint64, perms []string, input auth.InviteInput) (models.Invite, error) {
+	cfg := u.authCfg.Registration
+	manager := rbac.Has(perms, rbac.InvitesManage)
+
+	maxUses := input.MaxUses
+	if maxUses == 0 {
+		maxUses = cfg.InviteMaxUses
+	}
+	if !manager {
+		if maxUses > cfg.InviteMaxUses {
+			return models.Invite{}, ErrInviteUsesTooHigh
+		}
+
+		count, err := u.repo.CountUsableInvites(ctx, userID)
+		if err != nil {
+			return models.Invite{}, err
+		}
+		if count >= int64(cfg.InvitesPerUser) {
+			return models.Invite{}, ErrTooManyInvites
+		}
+	}
+
+	expiresIn := cfg.InviteExpDuration
+	if input.ExpiresInHours > 0 {
+		expiresIn = time.Duration(input.ExpiresInHours) * time.Hour
+	}
+	expiresAt := time.Now().Add(expiresIn)
+
+	code, err := randomInviteCode()
+	if err != nil {
+		return models.Invite{}, err
+	}
+
+	return u.repo.CreateInvite(ctx, models.Invite{
+		ExpiresAt:   &expiresAt,
+		Code:        code,
+		Note:        input.Note,
+		CreatedByID: userID,
+		MaxUses:     maxUses,
+	})
+}
+
+// ListInvites returns the invites of the user, or every invite when all is
+// set by a user holding invites:manage.
+func (u UseCase) ListInvites(ctx context.Context, userID uint64, perms []string, all bool) ([]models.Invite, error) {
+	if all && rbac.Has(perms, rbac.InvitesManage) {
+		userID = 0
+	}
+	return u.repo.GetInvites(ctx, userID)
+}
+
+// RevokeInvite deletes an invite of the user, or any invite for users
+// holding invites:manage. Users who signed up with it stay linked to the
+// inviter.
+func (u UseCase) RevokeInvite(ctx context.Context, userID uint64, perms []string, id uint64) error {
+	invite, err := u.repo.GetInvite(ctx, id)
+	if err != nil {
+		return err
+	}
+	if invite.ID == 0 || (invite.CreatedByID != userID && !rbac.Has(perms, rbac.InvitesManage)) {
+		return ErrInviteNotFound
+	}
+	return u.repo.DeleteInvite(ctx, id)
+}
+
+// ListInvitees returns the users who signed up with an invite of the user.
+func (u UseCase) ListInvitees(ctx context.Context, userID uint64) ([]models.User, error) {
+	return u.repo.GetInvitees(ctx, userID)
+}
+
+func randomInviteCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate invite code: %w", err)
+	}
+	return inviteEncoding.EncodeToString(b), nil
+}
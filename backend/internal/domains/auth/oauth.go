@@ -0,0 +1,330 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/oauth2"
+	"social-app/api/auth"
+	"social-app/internal/models"
+	"social-app/pkg/rbac"
+	"social-app/pkg/sso"
+)
+
+var (
+	ErrMissingEmail      = errors.New("login provider returned no email")
+	ErrInvalidOAuthState = errors.New("invalid oauth state")
+	ErrIdentityConflict  = errors.New("identity conflicts with another account")
+	ErrIdentityNotFound  = errors.New("identity not found")
+	ErrLastLoginMethod   = errors.New("cannot remove the last login method")
+)
+
+// oauthState is what a login attempt started with, kept in Redis under its
+// random state until the provider redirects back. UserID is set when a
+// logged-in user links a provider account instead of logging in, Invite when
+// the login may sign up a new user.
+type oauthState struct {
+	Provider string `json:"provider"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect"`
+	Invite   string `json:"invite,omitempty"`
+	UserID   uint64 `json:"user_id,omitempty"`
+}
+
+func (u UseCase) OauthProviders() []string {
+	return u.providers.Names()
+}
+
+// OauthLogin starts a login with a random state and a PKCE verifier, both
+// checked on the callback. The redirect target must pass the allowlist.
+func (u UseCase) OauthLogin(ctx context.Context, provider string, input auth.OauthLoginInput) (string, error) {
+	return u.startOAuth(ctx, provider, input, 0)
+}
+
+// OauthCallback redeems the state of the login attempt before exchanging the
+// code, so a callback is only accepted once and only for the provider it
+// was started with. The token carries the validated redirect target.
+func (u UseCase) OauthCallback(ctx context.Context, provider string, input auth.OauthInput, client auth.ClientInfo) (auth.JWTToken, error) {
+	info, state, err := u.finishOAuth(ctx, provider, input, 0)
+	if err != nil {
+		return auth.JWTToken{}, err
+	}
+
+	user, err := u.userFromIdentity(ctx, info, state.Invite)
+	if err != nil {
+		return auth.JWTToken{}, err
+	}
+
+	jwt, err := u.oauthSession(ctx, user, client)
+	if err != nil {
+		return auth.JWTToken{}, err
+	}
+	jwt.Redirect = state.Redirect
+	return jwt, nil
+}
+
+// OauthLink starts linking a provider account to the logged-in user.
+func (u UseCase) OauthLink(ctx context.Context, userID uint64, provider string, input auth.OauthLoginInput) (string, error) {
+	return u.startOAuth(ctx, provider, auth.OauthLoginInput{Redirect: input.Redirect}, userID)
+}
+
+// LinkIdentity completes OauthLink. The state must have been issued to the
+// same user, so that nobody can get their provider account linked to
+// someone else's session.
+func (u UseCase) LinkIdentity(ctx context.Context, userID uint64, provider string, input auth.OauthInput) (models.Identity, error) {
+	info, _, err := u.finishOAuth(ctx, provider, input, userID)
+	if err != nil {
+		return models.Identity{}, err
+	}
+
+	identity, err := u.repo.GetIdentity(ctx, info.Provider, info.Subject)
+	if err != nil {
+		return models.Identity{}, err
+	}
+	if identity.ID != 0 {
+		if identity.UserID != userID {
+			return models.Identity{}, ErrIdentityConflict
+		}
+		return identity, nil
+	}
+
+	return u.repo.CreateIdentity(ctx, models.Identity{
+		Provider: info.Provider,
+		Subject:  info.Subject,
+		Email:    info.Email,
+		UserID:   userID,
+	})
+}
+
+func (u UseCase) ListIdentities(ctx context.Context, userID uint64) ([]models.Identity, error) {
+	return u.repo.GetIdentities(ctx, userID)
+}
+
+// UnlinkIdentity removes a linked provider account, unless the user would be
+// left without any way to log in.
+func (u UseCase) UnlinkIdentity(ctx context.Context, userID, id uint64) error {
+	user, err := u.repo.Get(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	identities, err := u.repo.GetIdentities(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	passkeys, err := u.repo.GetWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.Password == "" && len(passkeys) == 0 && len(identities) <= 1 {
+		return ErrLastLoginMethod
+	}
+
+	deleted, err := u.repo.DeleteIdentity(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
+
+func (u UseCase) startOAuth(ctx context.Context, provider string, input auth.OauthLoginInput, userID uint64) (string, error) {
+	p, err := u.providers.Get(provider)
+	if err != nil {
+		return "", err
+	}
+
+	redirect, err := sso.CheckRedirect(input.Redirect, u.authCfg.Sso.GetRedirectAllowlist())
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomState()
+	if err != nil {
+		return "", err
+	}
+
+	saved := oauthState{
+		Provider: provider,
+		Verifier: oauth2.GenerateVerifier(),
+		Redirect: redirect,
+		Invite:   input.Invite,
+		UserID:   userID,
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode oauth state: %w", err)
+	}
+	if err := u.tokens.SaveOAuthState(ctx, state, data, u.authCfg.Sso.StateDuration); err != nil {
+		return "", err
+	}
+
+	url, err := p.AuthCodeURL(ctx, state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(saved.Verifier))
+	if err != nil {
+		return "", fmt.Errorf("failed to build %s login URL: %w", provider, err)
+	}
+	return url, nil
+}
+
+// finishOAuth checks the state was issued for this provider and this user (0
+// for a login) and exchanges the code.
+func (u UseCase) finishOAuth(ctx context.Context, provider string, input auth.OauthInput, userID uint64) (sso.Identity, oauthState, error) {
+	p, err := u.providers.Get(provider)
+	if err != nil {
+		return sso.Identity{}, oauthState{}, err
+	}
+
+	state, err := u.takeOAuthState(ctx, input.State)
+	if err != nil {
+		return sso.Identity{}, oauthState{}, err
+	}
+	if state.Provider != provider || state.UserID != userID {
+		return sso.Identity{}, oauthState{}, ErrInvalidOAuthState
+	}
+
+	info, err := p.Exchange(ctx, input.Code, oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		return sso.Identity{}, oauthState{}, fmt.Errorf("failed to complete %s login: %w", provider, err)
+	}
+	return info, state, nil
+}
+
+func (u UseCase) oauthSession(ctx context.Context, user models.User, client auth.ClientInfo) (auth.JWTToken, error) {
+	pendingToken, pending, err := u.maybeReturnPendingVerification(ctx, user)
+	if err != nil {
+		return auth.JWTToken{}, err
+	}
+	if pending {
+		return pendingToken, nil
+	}
+
+	if user.TOTPEnabled {
+		return u.issueTwoFactorToken(ctx, user)
+	}
+
+	return u.startSession(ctx, user, client)
+}
+
+func (u UseCase) takeOAuthState(ctx context.Context, state string) (oauthState, error) {
+	data, err := u.tokens.TakeOAuthState(ctx, state)
+	if err != nil {
+		if errors.Is(err, ErrOAuthStateNotFound) {
+			return oauthState{}, ErrInvalidOAuthState
+		}
+		return oauthState{}, err
+	}
+
+	var s oauthState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return oauthState{}, fmt.Errorf("failed to decode oauth state: %w", err)
+	}
+	return s, nil
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate oauth state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// userFromIdentity finds the user a provider account is linked to, or signs
+// up a new user. A provider account whose email belongs to an existing user
+// is never merged into it: the user has to log in and link it explicitly.
+// Signing up follows the registration mode, with the invite code the login
+// was started with.
+func (u UseCase) userFromIdentity(ctx context.Context, info sso.Identity, invite string) (models.User, error) {
+	identity, err := u.repo.GetIdentity(ctx, info.Provider, info.Subject)
+	if err != nil {
+		return models.User{}, err
+	}
+	if identity.ID != 0 {
+		user, err := u.repo.Get(ctx, identity.UserID)
+		if err != nil {
+			return models.User{}, fmt.Errorf("failed to get user: %w", err)
+		}
+		if err := u.repo.TouchIdentity(ctx, identity.ID); err != nil {
+			return models.User{}, err
+		}
+		return user, nil
+	}
+
+	if info.Email == "" {
+		return models.User{}, ErrMissingEmail
+	}
+
+	newIdentity := models.Identity{
+		Provider: info.Provider,
+		Subject:  info.Subject,
+		Email:    info.Email,
+	}
+
+	user, err := u.repo.GetByEmail(ctx, info.Email)
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to login user: %w", err)
+	}
+	if user.IsZero() {
+		if err := u.checkRegistration(invite); err != nil {
+			return models.User{}, err
+		}
+		user = models.User{
+			Username:   displayName(info),
+			Email:      info.Email,
+			Avatar:     info.Picture,
+			Role:       rbac.RoleUser,
+			SignupType: info.Provider,
+		}
+		user, err = u.repo.RegisterWithIdentity(ctx, user, newIdentity, invite)
+		if err != nil {
+			return models.User{}, fmt.Errorf("failed to register user: %w", err)
+		}
+		return user, nil
+	}
+
+	adopt, err := u.isLegacyGoogleAccount(ctx, user, info)
+	if err != nil {
+		return models.User{}, err
+	}
+	if !adopt {
+		return models.User{}, ErrIdentityConflict
+	}
+
+	newIdentity.UserID = user.ID
+	if _, err := u.repo.CreateIdentity(ctx, newIdentity); err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// isLegacyGoogleAccount reports whether user was created by the Google login
+// before identities were recorded: no password and no identity. Such an
+// account is adopted by the Google account with the same verified email.
+func (u UseCase) isLegacyGoogleAccount(ctx context.Context, user models.User, info sso.Identity) (bool, error) {
+	if info.Provider != "google" || !info.EmailVerified || user.Password != "" {
+		return false, nil
+	}
+
+	identities, err := u.repo.GetIdentities(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return len(identities) == 0, nil
+}
+
+// displayName prefers the provider handle (GitHub login, Keycloak
+// preferred_username) and falls back to the full name.
+func displayName(info sso.Identity) string {
+	if info.Username != "" {
+		return info.Username
+	}
+	return info.Name
+}
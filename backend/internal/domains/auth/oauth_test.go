@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"social-app/pkg/sso"
+)
+
+func TestUserFromIdentity(t *testing.T) {
+	google := sso.Identity{Provider: "google", Subject: "g-1", Email: "alice@example.com", EmailVerified: true}
+	github := sso.Identity{Provider: "github", Subject: "gh-1", Email: "alice@example.com", EmailVerified: true}
+	unverified := google
+	unverified.EmailVerified = false
+
+	noIdentity := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(`SELECT \* FROM "identities"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	}
+	emailUser := func(password string) func(sqlmock.Sqlmock) {
+		return func(mock sqlmock.Sqlmock) {
+			rows := sqlmock.NewRows([]string{"id", "username", "email", "password"}).AddRow(7, "alice", "alice@example.com", password)
+			mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(rows)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		info    sso.Identity
+		expect  []func(sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "linked identity",
+			info: github,
+			expect: []func(sqlmock.Sqlmock){
+				func(mock sqlmock.Sqlmock) {
+					rows := sqlmock.NewRows([]string{"id", "user_id", "provider", "subject"}).AddRow(3, 7, "github", "gh-1")
+					mock.ExpectQuery(`SELECT \* FROM "identities"`).WillReturnRows(rows)
+				},
+				emailUser(""),
+				func(mock sqlmock.Sqlmock) {
+					mock.ExpectExec(`UPDATE "identities"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				},
+			},
+		},
+		{
+			name:    "no email",
+			info:    sso.Identity{Provider: "github", Subject: "gh-1"},
+			expect:  []func(sqlmock.Sqlmock){noIdentity},
+			wantErr: ErrMissingEmail,
+		},
+		{
+			name:    "email of an account with a password",
+			info:    google,
+			expect:  []func(sqlmock.Sqlmock){noIdentity, emailUser("hash")},
+			wantErr: ErrIdentityConflict,
+		},
+		{
+			name:    "email of a passwordless account from another provider",
+			info:    github,
+			expect:  []func(sqlmock.Sqlmock){noIdentity, emailUser("")},
+			wantErr: ErrIdentityConflict,
+		},
+		{
+			name:    "unverified google email",
+			info:    unverified,
+			expect:  []func(sqlmock.Sqlmock){noIdentity, emailUser("")},
+			wantErr: ErrIdentityConflict,
+		},
+		{
+			name: "passwordless account already linked elsewhere",
+			info: google,
+			expect: []func(sqlmock.Sqlmock){noIdentity, emailUser(""), func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "user_id", "provider"}).AddRow(4, 7, "github")
+				mock.ExpectQuery(`SELECT \* FROM "identities"`).WillReturnRows(rows)
+			}},
+			wantErr: ErrIdentityConflict,
+		},
+		{
+			name: "legacy google account",
+			info: google,
+			expect: []func(sqlmock.Sqlmock){noIdentity, emailUser(""), noIdentity, func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`INSERT INTO "identities"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, mock, _ := newTestUseCase(t)
+			for _, expect := range tt.expect {
+				expect(mock)
+			}
+
+			user, err := uc.userFromIdentity(context.Background(), tt.info, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && user.ID != 7 {
+				t.Errorf("Expected user 7, got %+v", user)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"social-app/api/auth"
+	"social-app/internal/models"
+	"social-app/pkg/passkey"
+)
+
+const (
+	passkeyCeremonyTTL  = 5 * time.Minute
+	defaultPasskeyName  = "Passkey"
+	passkeyNameMaxRunes = 100
+)
+
+var (
+	ErrPasskeyNotFound = errors.New("passkey not found")
+	ErrInvalidPasskey  = errors.New("invalid passkey")
+)
+
+// BeginPasskeyRegistration starts adding a passkey to the user's account.
+func (u UseCase) BeginPasskeyRegistration(ctx context.Context, userID uint64) (auth.PasskeyOptions, error) {
+	user, err := u.repo.Get(ctx, userID)
+	if err != nil {
+		return auth.PasskeyOptions{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	credentials, err := u.repo.GetWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return auth.PasskeyOptions{}, err
+	}
+
+	creation, state, err := u.passkeys.BeginRegistration(passkeyUser(user, credentials))
+	if err != nil {
+		return auth.PasskeyOptions{}, err
+	}
+
+	return u.saveCeremony(ctx, creation, state)
+}
+
+func (u UseCase) FinishPasskeyRegistration(ctx context.Context, userID uint64, input auth.PasskeyFinishInput) (models.WebAuthnCredential, error) {
+	state, err := u.tokens.TakeCeremony(ctx, input.CeremonyID)
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+
+	user, err := u.repo.Get(ctx, userID)
+	if err != nil {
+		return models.WebAuthnCredential{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	credentials, err := u.repo.GetWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+
+	credential, err := u.passkeys.FinishRegistration(passkeyUser(user, credentials), state, input.Credential)
+	if err != nil {
+		return models.WebAuthnCredential{}, fmt.Errorf("%w: %w", ErrInvalidPasskey, err)
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = defaultPasskeyName
+	}
+	if r := []rune(name); len(r) > passkeyNameMaxRunes {
+		name = string(r[:passkeyNameMaxRunes])
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+
+	return u.repo.CreateWebAuthnCredential(ctx, models.WebAuthnCredential{
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	})
+}
+
+func (u UseCase) ListPasskeys(ctx context.Context, userID uint64) ([]models.WebAuthnCredential, error) {
+	return u.repo.GetWebAuthnCredentials(ctx, userID)
+}
+
+func (u UseCase) DeletePasskey(ctx context.Context, userID, id uint64) error {
+	deleted, err := u.repo.DeleteWebAuthnCredential(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// BeginPasskeyLogin starts a usernameless login with any passkey registered
+// on this site.
+func (u UseCase) BeginPasskeyLogin(ctx context.Context) (auth.PasskeyOptions, error) {
+	assertion, state, err := u.passkeys.BeginLogin()
+	if err != nil {
+		return auth.PasskeyOptions{}, err
+	}
+
+	return u.saveCeremony(ctx, assertion, state)
+}
+
+// FinishPasskeyLogin verifies the assertion and opens a session, with the
+// lockout and verification checks of a password login. The ceremony requires
+// user verification, so a passkey is both factors and no TOTP code is asked.
+func (u UseCase) FinishPasskeyLogin(ctx context.Context, input auth.PasskeyFinishInput, client auth.ClientInfo) (auth.JWTToken, error) {
+	if err := u.guard.Check(ctx, 0, client.IP); err != nil {
+		return auth.JWTToken{}, err
+	}
+
+	state, err := u.tokens.TakeCeremony(ctx, input.CeremonyID)
+	if err != nil {
+		return auth.JWTToken{}, err
+	}
+
+	var (
+		user        models.User
+		credentials []models.WebAuthnCredential
+	)
+	lookup := func(userID uint64, _ []byte) (passkey.User, error) {
+		found, err := u.repo.Get(ctx, userID)
+		if err != nil {
+			return passkey.User{}, fmt.Errorf("failed to get user: %w", err)
+		}
+		stored, err := u.repo.GetWebAuthnCredentials(ctx, userID)
+		if err != nil {
+			return passkey.User{}, err
+		}
+
+		user, credentials = found, stored
+		return passkeyUser(user, credentials), nil
+	}
+
+	_, credential, err := u.passkeys.FinishLogin(state, input.Credential, lookup)
+	if err != nil {
+		if err := u.loginFailed(ctx, user, client.IP); err != nil {
+			return auth.JWTToken{}, err
+		}
+		return auth.JWTToken{}, fmt.Errorf("%w: %w", ErrInvalidPasskey, err)
+	}
+
+	if err := u.guard.Check(ctx, user.ID, ""); err != nil {
+		return auth.JWTToken{}, err
+	}
+	if err := u.guard.Succeed(ctx, user.ID); err != nil {
+		return auth.JWTToken{}, err
+	}
+
+	for _, stored := range credentials {
+		if !bytes.Equal(stored.CredentialID, credential.ID) {
+			continue
+		}
+
+		now := time.Now()
+		stored.SignCount = credential.Authenticator.SignCount
+		stored.BackupState = credential.Flags.BackupState
+		stored.LastUsedAt = &now
+		if err := u.repo.UpdateWebAuthnCredential(ctx, stored); err != nil {
+			return auth.JWTToken{}, err
+		}
+		break
+	}
+
+	pendingToken, pending, err := u.maybeReturnPendingVerification(ctx, user)
+	if err != nil {
+		return auth.JWTToken{}, err
+	}
+	if pending {
+		return pendingToken, nil
+	}
+
+	token, err := u.startSession(ctx, user, client)
+	if err != nil {
+		return auth.JWTToken{}, err
+	}
+
+	token.VerifyResponse = auth.VerifyResponse{
+		ID:       user.ID,
+		Username: user.Username,
+		Verified: user.Verified,
+	}
+
+	return token, nil
+}
+
+func (u UseCase) saveCeremony(ctx context.Context, options interface{}, state []byte) (auth.PasskeyOptions, error) {
+	ceremonyID := uuid.NewString()
+	if err := u.tokens.SaveCeremony(ctx, ceremonyID, state, passkeyCeremonyTTL); err != nil {
+		return auth.PasskeyOptions{}, err
+	}
+
+	return auth.PasskeyOptions{
+		CeremonyID: ceremonyID,
+		Options:    options,
+	}, nil
+}
+
+func passkeyUser(user models.User, credentials []models.WebAuthnCredential) passkey.User {
+	pu := passkey.User{
+		ID:          user.ID,
+		Name:        user.Username,
+		Credentials: make([]webauthn.Credential, 0, len(credentials)),
+	}
+
+	for _, c := range credentials {
+		var transports []protocol.AuthenticatorTransport
+		for _, t := range strings.Split(c.Transports, ",") {
+			if t != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(t))
+			}
+		}
+
+		pu.Credentials = append(pu.Credentials, webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		})
+	}
+
+	return pu
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+	"social-app/api/auth"
+	"social-app/internal/models"
+)
+
+const passwordResetTokenType = "password_reset"
+
+var ErrInvalidResetToken = errors.New("invalid password reset token")
+
+// ForgotPassword emails a reset link when the address belongs to an account.
+// It behaves the same whether or not it does, and the email is sent in the
+// background so that response times do not tell either.
+func (u UseCase) ForgotPassword(ctx context.Context, email string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil
+	}
+
+	user, err := u.repo.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user.IsZero() || user.Email == "" {
+		return nil
+	}
+
+	tk, err := u.generateToken(ctx, user, u.authCfg.PasswordResetDuration, map[string]any{
+		"typ": passwordResetTokenType,
+		"pwd": passwordFingerprint(user.Password),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate password reset token: %w", err)
+	}
+
+	link := u.authCfg.PasswordResetURL + "?token=" + url.QueryEscape(tk)
+	go func(to string) {
+		if err := u.mailer.SendPasswordReset(to, link); err != nil {
+			log.Printf("[Auth] Failed to send password reset email: %v", err)
+		}
+	}(user.Email)
+
+	return nil
+}
+
+// ResetPassword sets a new password from a reset token and signs the user out
+// everywhere. A token is only accepted once, and never after the password it
+// was issued for has changed.
+func (u UseCase) ResetPassword(ctx context.Context, input auth.ResetPasswordInput) error {
+	userID, tokenID, fingerprint, err := u.parseResetToken(input.Token)
+	if err != nil {
+		return err
+	}
+
+	user, err := u.repo.Get(ctx, userID)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	if subtle.ConstantTimeCompare([]byte(fingerprint), []byte(passwordFingerprint(user.Password))) != 1 {
+		return ErrInvalidResetToken
+	}
+
+	fresh, err := u.tokens.UseResetToken(ctx, tokenID, u.authCfg.PasswordResetDuration)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidResetToken
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), 14)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := u.repo.UpdatePassword(ctx, user.ID, string(hashedPassword)); err != nil {
+		return err
+	}
+
+	return u.RevokeAllSessions(ctx, user.ID)
+}
+
+// Reauthenticate asks for the password again before a sensitive change. Wrong
+// passwords count towards the lockout like failed logins. Users who have no
+// password, having signed up through a provider, pass.
+func (u UseCase) Reauthenticate(ctx context.Context, user models.User, password string, client auth.ClientInfo) error {
+	if user.Password == "" {
+		return nil
+	}
+
+	if err := u.guard.Check(ctx, user.ID, client.IP); err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		if err := u.loginFailed(ctx, user, client.IP); err != nil {
+			return err
+		}
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (u UseCase) parseResetToken(resetToken string) (uint64, string, string, error) {
+	tok, err := jwt.Parse(resetToken, u.keys.Keyfunc)
+	if err != nil || !tok.Valid {
+		return 0, "", "", ErrInvalidResetToken
+	}
+
+	claims, ok := tok.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != passwordResetTokenType {
+		return 0, "", "", ErrInvalidResetToken
+	}
+
+	sub, ok := claims["sub"].(float64)
+	if !ok {
+		return 0, "", "", ErrInvalidResetToken
+	}
+
+	jti, _ := claims["jti"].(string)
+	pwd, _ := claims["pwd"].(string)
+	if jti == "" || pwd == "" {
+		return 0, "", "", ErrInvalidResetToken
+	}
+
+	return uint64(sub), jti, pwd, nil
+}
+
+// passwordFingerprint ties a reset token to the password hash it was issued
+// for without exposing the hash itself.
+func passwordFingerprint(hash string) string {
+	return hashToken(hash)[:16]
+}
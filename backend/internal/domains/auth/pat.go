@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"social-app/api/auth"
+	"social-app/internal/models"
+	"social-app/pkg/middleware"
+	"social-app/pkg/rbac"
+	"social-app/pkg/token"
+)
+
+const (
+	maxPersonalTokens = 20
+
+	// personalTokenTouchInterval is how often the last use of a token is
+	// written down.
+	personalTokenTouchInterval = time.Minute
+)
+
+var (
+	ErrInvalidPAT            = errors.New("invalid personal access token")
+	ErrPersonalTokenNotFound = errors.New("personal access token not found")
+	ErrTooManyPersonalTokens = errors.New("too many personal access tokens")
+	ErrScopeNotGranted       = errors.New("scope not granted to the user")
+)
+
+// CreatePersonalToken issues a token limited to scopes the user holds. The
+// token is only returned here; afterwards only its prefix is shown.
+func (u UseCase) CreatePersonalToken(ctx context.Context, userID uint64, input auth.PersonalTokenInput) (auth.PersonalToken, error) {
+	user, err := u.repo.Get(ctx, userID)
+	if err != nil {
+		return auth.PersonalToken{}, err
+	}
+
+	scopes, err := rbac.Normalize(input.Scopes)
+	if err != nil {
+		return auth.PersonalToken{}, err
+	}
+	perms, err := u.permissions(ctx, user.Role)
+	if err != nil {
+		return auth.PersonalToken{}, err
+	}
+	if !rbac.Has(perms, scopes...) {
+		return auth.PersonalToken{}, ErrScopeNotGranted
+	}
+
+	count, err := u.repo.CountPersonalTokens(ctx, userID)
+	if err != nil {
+		return auth.PersonalToken{}, err
+	}
+	if count >= maxPersonalTokens {
+		return auth.PersonalToken{}, ErrTooManyPersonalTokens
+	}
+
+	raw, hash, err := token.NewPAT()
+	if err != nil {
+		return auth.PersonalToken{}, err
+	}
+
+	pat := models.PersonalAccessToken{
+		Name:      input.Name,
+		Prefix:    token.PATDisplay(raw),
+		TokenHash: hash,
+		UserID:    userID,
+	}
+	pat.SetScopes(scopes)
+	if input.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		pat.ExpiresAt = &expiresAt
+	}
+
+	pat, err = u.repo.CreatePersonalToken(ctx, pat)
+	if err != nil {
+		return auth.PersonalToken{}, err
+	}
+
+	out := personalToken(pat)
+	out.Token = raw
+	return out, nil
+}
+
+func (u UseCase) ListPersonalTokens(ctx context.Context, userID uint64) ([]auth.PersonalToken, error) {
+	pats, err := u.repo.GetPersonalTokens(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]auth.PersonalToken, 0, len(pats))
+	for _, pat := range pats {
+		out = append(out, personalToken(pat))
+	}
+	return out, nil
+}
+
+func (u UseCase) RevokePersonalToken(ctx context.Context, userID, id uint64) error {
+	deleted, err := u.repo.DeletePersonalToken(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrPersonalTokenNotFound
+	}
+	return nil
+}
+
+// ResolvePAT authenticates a personal access token for middleware.Auth. The
+// token only grants the scopes its user still holds, so that a role change
+// narrows existing tokens too.
+func (u UseCase) ResolvePAT(ctx context.Context, raw, ip string) (middleware.PAT, error) {
+	pat, err := u.repo.GetPersonalTokenByHash(ctx, token.HashPAT(raw))
+	if err != nil {
+		return middleware.PAT{}, err
+	}
+	if pat.ID == 0 || pat.Expired(time.Now()) {
+		return middleware.PAT{}, ErrInvalidPAT
+	}
+
+	user, err := u.repo.Get(ctx, pat.UserID)
+	if err != nil {
+		return middleware.PAT{}, ErrInvalidPAT
+	}
+
+	perms, err := u.permissions(ctx, user.Role)
+	if err != nil {
+		return middleware.PAT{}, err
+	}
+	scopes := make([]string, 0, len(pat.GetScopes()))
+	for _, scope := range pat.GetScopes() {
+		if rbac.Has(perms, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if err := u.repo.TouchPersonalToken(ctx, pat.ID, ip, time.Now().Add(-personalTokenTouchInterval)); err != nil {
+		log.Printf("[Auth] Failed to record use of personal access token %d: %v", pat.ID, err)
+	}
+
+	return middleware.PAT{
+		Scopes:   scopes,
+		Username: user.Username,
+		Role:     user.Role,
+		ID:       pat.ID,
+		UserID:   user.ID,
+		Verified: user.Verified,
+	}, nil
+}
+
+func personalToken(pat models.PersonalAccessToken) auth.PersonalToken {
+	return auth.PersonalToken{
+		CreatedAt:  pat.CreatedAt,
+		ExpiresAt:  pat.ExpiresAt,
+		LastUsedAt: pat.LastUsedAt,
+		Name:       pat.Name,
+		Prefix:     pat.Prefix,
+		LastUsedIP: pat.LastUsedIP,
+		Scopes:     pat.GetScopes(),
+		ID:         pat.ID,
+	}
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"social-app/api/auth"
+	"social-app/api/profile"
+)
+
+var (
+	ErrNoPhone              = errors.New("no phone number")
+	ErrPhoneTaken           = errors.New("phone number already in use")
+	ErrPhoneAlreadyVerified = errors.New("phone number already verified")
+)
+
+// GetPhone returns the phone number of the user and whether it is verified.
+func (u UseCase) GetPhone(ctx context.Context, userID uint64) (auth.PhoneOutput, error) {
+	user, err := u.repo.Get(ctx, userID)
+	if err != nil {
+		return auth.PhoneOutput{}, err
+	}
+	if user.Phone == "" {
+		return auth.PhoneOutput{}, ErrNoPhone
+	}
+	return auth.PhoneOutput{Phone: user.Phone, Verified: user.PhoneVerified}, nil
+}
+
+// SetPhone replaces the phone number of the user and sends it a code by SMS.
+// The number stays unverified until the code comes back through VerifyPhone.
+// Setting the same unverified number again sends a new code.
+func (u UseCase) SetPhone(ctx context.Context, userID uint64, phone string) (auth.PhoneOutput, error) {
+	user, err := u.repo.Get(ctx, userID)
+	if err != nil {
+		return auth.PhoneOutput{}, err
+	}
+	if user.Phone == phone && user.PhoneVerified {
+		return auth.PhoneOutput{}, ErrPhoneAlreadyVerified
+	}
+
+	if err := u.checkPhoneFree(ctx, user.ID, phone); err != nil {
+		return auth.PhoneOutput{}, err
+	}
+
+	if err := u.guard.AllowSMS(ctx, user.ID, phone); err != nil {
+		return auth.PhoneOutput{}, err
+	}
+
+	code, err := newVerificationCode()
+	if err != nil {
+		return auth.PhoneOutput{}, err
+	}
+
+	user.Phone = phone
+	user.PhoneCode = code
+	user.PhoneVerified = false
+	if err := u.repo.UpdatePhone(ctx, user); err != nil {
+		return auth.PhoneOutput{}, err
+	}
+
+	if err := u.sms.SendPhoneVerification(phone, code); err != nil {
+		return auth.PhoneOutput{}, fmt.Errorf("failed to send phone verification: %w", err)
+	}
+
+	return auth.PhoneOutput{Phone: user.Phone}, nil
+}
+
+// VerifyPhone checks the code sent by SMS to the phone number of the user.
+func (u UseCase) VerifyPhone(ctx context.Context, userID uint64, code string, client auth.ClientInfo) (auth.PhoneOutput, error) {
+	user, err := u.repo.Get(ctx, userID)
+	if err != nil {
+		return auth.PhoneOutput{}, err
+	}
+	if user.Phone == "" {
+		return auth.PhoneOutput{}, ErrNoPhone
+	}
+	if user.PhoneVerified {
+		return auth.PhoneOutput{}, ErrPhoneAlreadyVerified
+	}
+
+	if err := u.guard.Check(ctx, user.ID, client.IP); err != nil {
+		return auth.PhoneOutput{}, err
+	}
+
+	if user.PhoneCode == "" || subtle.ConstantTimeCompare([]byte(user.PhoneCode), []byte(code)) != 1 {
+		if err := u.codeFailed(ctx, user, profile.ChannelSMS, client.IP); err != nil {
+			return auth.PhoneOutput{}, err
+		}
+		return auth.PhoneOutput{}, ErrInvalidCode
+	}
+
+	if err := u.guard.Succeed(ctx, user.ID); err != nil {
+		return auth.PhoneOutput{}, err
+	}
+
+	// Someone else may have verified the number in the meantime.
+	if err := u.checkPhoneFree(ctx, user.ID, user.Phone); err != nil {
+		return auth.PhoneOutput{}, err
+	}
+
+	user.PhoneCode = ""
+	user.PhoneVerified = true
+	if err := u.repo.UpdatePhone(ctx, user); err != nil {
+		return auth.PhoneOutput{}, err
+	}
+
+	return auth.PhoneOutput{Phone: user.Phone, Verified: true}, nil
+}
+
+func (u UseCase) RemovePhone(ctx context.Context, userID uint64) error {
+	user, err := u.repo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Phone == "" {
+		return ErrNoPhone
+	}
+
+	user.Phone = ""
+	user.PhoneCode = ""
+	user.PhoneVerified = false
+	return u.repo.UpdatePhone(ctx, user)
+}
+
+// checkPhoneFree returns ErrPhoneTaken when another account has verified the
+// phone number.
+func (u UseCase) checkPhoneFree(ctx context.Context, userID uint64, phone string) error {
+	owner, err := u.repo.GetByVerifiedPhone(ctx, phone)
+	if err != nil {
+		return err
+	}
+	if !owner.IsZero() && owner.ID != userID {
+		return ErrPhoneTaken
+	}
+	return nil
+}
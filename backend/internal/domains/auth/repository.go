@@ -4,14 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"social-app/internal/connector"
 	"social-app/internal/models"
 )
 
 type AuthRepository interface {
-	Register(ctx context.Context, user models.User) (models.User, error)
+	Register(ctx context.Context, user models.User, invite string) (models.User, error)
 	Login(ctx context.Context, username string) (models.User, error)
 	GetProfile(ctx context.Context, id string) (models.User, error)
 	Update(ctx context.Context, user models.User) error
@@ -19,6 +21,46 @@ type AuthRepository interface {
 	Get(ctx context.Context, id uint64) (models.User, error)
 	Update2FA(ctx context.Context, user models.User) error
 	GetByEmail(ctx context.Context, email string) (models.User, error)
+	GetByVerifiedPhone(ctx context.Context, phone string) (models.User, error)
+	UpdatePhone(ctx context.Context, user models.User) error
+	CreateSession(ctx context.Context, session models.Session) (models.Session, error)
+	TouchSession(ctx context.Context, sessionID uuid.UUID) error
+	GetSession(ctx context.Context, sessionID uuid.UUID, userID uint64) (models.Session, error)
+	GetActiveSessions(ctx context.Context, userID uint64, since time.Time) ([]models.Session, error)
+	RevokeSession(ctx context.Context, sessionID uuid.UUID) error
+	RevokeUserSessions(ctx context.Context, userID uint64) error
+	UpdateTOTP(ctx context.Context, user models.User) error
+	UpdatePassword(ctx context.Context, userID uint64, hash string) error
+	ReplaceRecoveryCodes(ctx context.Context, userID uint64, hashes []string) error
+	UseRecoveryCode(ctx context.Context, userID uint64, hash string) (bool, error)
+	CreateWebAuthnCredential(ctx context.Context, credential models.WebAuthnCredential) (models.WebAuthnCredential, error)
+	GetWebAuthnCredentials(ctx context.Context, userID uint64) ([]models.WebAuthnCredential, error)
+	UpdateWebAuthnCredential(ctx context.Context, credential models.WebAuthnCredential) error
+	DeleteWebAuthnCredential(ctx context.Context, id, userID uint64) (bool, error)
+	GetIdentity(ctx context.Context, provider, subject string) (models.Identity, error)
+	GetIdentities(ctx context.Context, userID uint64) ([]models.Identity, error)
+	CreateIdentity(ctx context.Context, identity models.Identity) (models.Identity, error)
+	RegisterWithIdentity(ctx context.Context, user models.User, identity models.Identity, invite string) (models.User, error)
+	TouchIdentity(ctx context.Context, id uint64) error
+	DeleteIdentity(ctx context.Context, id, userID uint64) (bool, error)
+	GetRole(ctx context.Context, name string) (models.Role, error)
+	CreateEmailChange(ctx context.Context, change models.EmailChange) (models.EmailChange, error)
+	GetPendingEmailChange(ctx context.Context, userID uint64) (models.EmailChange, error)
+	GetEmailChangeByCancelToken(ctx context.Context, hash string) (models.EmailChange, error)
+	ConfirmEmailChange(ctx context.Context, change models.EmailChange) error
+	CancelEmailChange(ctx context.Context, change models.EmailChange, restore bool) error
+	CreatePersonalToken(ctx context.Context, pat models.PersonalAccessToken) (models.PersonalAccessToken, error)
+	CountPersonalTokens(ctx context.Context, userID uint64) (int64, error)
+	GetPersonalTokens(ctx context.Context, userID uint64) ([]models.PersonalAccessToken, error)
+	GetPersonalTokenByHash(ctx context.Context, hash string) (models.PersonalAccessToken, error)
+	TouchPersonalToken(ctx context.Context, id uint64, ip string, since time.Time) error
+	DeletePersonalToken(ctx context.Context, userID, id uint64) (bool, error)
+	CreateInvite(ctx context.Context, invite models.Invite) (models.Invite, error)
+	GetInvites(ctx context.Context, createdByID uint64) ([]models.Invite, error)
+	GetInvite(ctx context.Context, id uint64) (models.Invite, error)
+	CountUsableInvites(ctx context.Context, createdByID uint64) (int64, error)
+	DeleteInvite(ctx context.Context, id uint64) error
+	GetInvitees(ctx context.Context, inviterID uint64) ([]models.User, error)
 }
 
 type Repository struct {
@@ -54,15 +96,49 @@ func (r Repository) Update(ctx context.Context, user models.User) error {
 	return r.conn.DB.Save(&user).Error
 }
 
-func (r Repository) Register(ctx context.Context, user models.User) (models.User, error) {
-	result := r.conn.DB.
-		Create(&user)
-	if result.Error != nil {
-		return user, fmt.Errorf("failed to create user: %w", result.Error)
+// Register creates the user, spending one use of the invite code when one is
+// given.
+func (r Repository) Register(ctx context.Context, user models.User, invite string) (models.User, error) {
+	err := r.conn.DB.Transaction(func(tx *gorm.DB) error {
+		if err := useInvite(tx, &user, invite); err != nil {
+			return err
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return user, err
 	}
 	return user, nil
 }
 
+// useInvite spends one use of the invite code and records its creator as
+// the inviter of user. An empty code is no invite at all.
+func useInvite(tx *gorm.DB, user *models.User, code string) error {
+	if code == "" {
+		return nil
+	}
+
+	result := tx.Model(&models.Invite{}).
+		Where("code = ? AND uses < max_uses AND (expires_at IS NULL OR expires_at > ?)", code, time.Now()).
+		Update("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("failed to use invite: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidInvite
+	}
+
+	var invite models.Invite
+	if err := tx.Where("code = ?", code).First(&invite).Error; err != nil {
+		return fmt.Errorf("failed to get invite: %w", err)
+	}
+	user.InvitedByID = &invite.CreatedByID
+	return nil
+}
+
 func (r Repository) Login(ctx context.Context, username string) (models.User, error) {
 	var user models.User
 	result := r.conn.DB.Where("username = ?", username).First(&user)
@@ -87,6 +163,7 @@ func (r Repository) Update2FA(ctx context.Context, user models.User) error {
 	return r.conn.DB.Model(&user).
 		Updates(map[string]interface{}{
 			"verified_code":    user.VerifiedCode,
+			"phone_code":       user.PhoneCode,
 			"verified_expires": user.VerifiedExpires,
 		}).Error
 }
@@ -103,3 +180,476 @@ func (r Repository) GetByEmail(ctx context.Context, email string) (models.User,
 
 	return user, nil
 }
+
+// GetByVerifiedPhone returns a zero User when no account has verified the
+// phone number.
+func (r Repository) GetByVerifiedPhone(ctx context.Context, phone string) (models.User, error) {
+	var user models.User
+	if err := r.conn.DB.Where("phone = ? AND phone_verified = ?", phone, true).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.User{}, nil
+		}
+		return models.User{}, fmt.Errorf("failed to find user by phone: %w", err)
+	}
+	return user, nil
+}
+
+func (r Repository) UpdatePhone(ctx context.Context, user models.User) error {
+	err := r.conn.DB.Model(&user).
+		Updates(map[string]interface{}{
+			"phone":          user.Phone,
+			"phone_code":     user.PhoneCode,
+			"phone_verified": user.PhoneVerified,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update phone of user %d: %w", user.ID, err)
+	}
+	return nil
+}
+
+func (r Repository) CreateSession(ctx context.Context, session models.Session) (models.Session, error) {
+	if err := r.conn.DB.Create(&session).Error; err != nil {
+		return models.Session{}, fmt.Errorf("failed to create session: %w", err)
+	}
+	return session, nil
+}
+
+func (r Repository) TouchSession(ctx context.Context, sessionID uuid.UUID) error {
+	err := r.conn.DB.Model(&models.Session{}).
+		Where("uuid = ?", sessionID).
+		Update("last_seen_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to touch session %s: %w", sessionID, err)
+	}
+	return nil
+}
+
+func (r Repository) GetSession(ctx context.Context, sessionID uuid.UUID, userID uint64) (models.Session, error) {
+	var session models.Session
+	result := r.conn.DB.
+		Where("uuid = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		First(&session)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return models.Session{}, nil
+		}
+		return models.Session{}, fmt.Errorf("failed to get session %s: %w", sessionID, result.Error)
+	}
+	return session, nil
+}
+
+func (r Repository) GetActiveSessions(ctx context.Context, userID uint64, since time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.conn.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND last_seen_at > ?", userID, since).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions of user %d: %w", userID, err)
+	}
+	return sessions, nil
+}
+
+func (r Repository) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	err := r.conn.DB.Model(&models.Session{}).
+		Where("uuid = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke session %s: %w", sessionID, err)
+	}
+	return nil
+}
+
+func (r Repository) RevokeUserSessions(ctx context.Context, userID uint64) error {
+	err := r.conn.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+func (r Repository) UpdateTOTP(ctx context.Context, user models.User) error {
+	err := r.conn.DB.Model(&user).
+		Updates(map[string]interface{}{
+			"totp_secret":  user.TOTPSecret,
+			"totp_enabled": user.TOTPEnabled,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update TOTP of user %d: %w", user.ID, err)
+	}
+	return nil
+}
+
+func (r Repository) UpdatePassword(ctx context.Context, userID uint64, hash string) error {
+	err := r.conn.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("password", hash).Error
+	if err != nil {
+		return fmt.Errorf("failed to update password of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+func (r Repository) ReplaceRecoveryCodes(ctx context.Context, userID uint64, hashes []string) error {
+	return r.conn.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("failed to delete recovery codes of user %d: %w", userID, err)
+		}
+		if len(hashes) == 0 {
+			return nil
+		}
+
+		codes := make([]models.RecoveryCode, 0, len(hashes))
+		for _, h := range hashes {
+			codes = append(codes, models.RecoveryCode{UserID: userID, Hash: h})
+		}
+		if err := tx.Create(&codes).Error; err != nil {
+			return fmt.Errorf("failed to create recovery codes of user %d: %w", userID, err)
+		}
+		return nil
+	})
+}
+
+func (r Repository) UseRecoveryCode(ctx context.Context, userID uint64, hash string) (bool, error) {
+	result := r.conn.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to use recovery code of user %d: %w", userID, result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r Repository) CreateWebAuthnCredential(ctx context.Context, credential models.WebAuthnCredential) (models.WebAuthnCredential, error) {
+	if err := r.conn.DB.Create(&credential).Error; err != nil {
+		return models.WebAuthnCredential{}, fmt.Errorf("failed to create passkey: %w", err)
+	}
+	return credential, nil
+}
+
+func (r Repository) GetWebAuthnCredentials(ctx context.Context, userID uint64) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	err := r.conn.DB.
+		Where("user_id = ?", userID).
+		Order("created_at ASC").
+		Find(&credentials).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get passkeys of user %d: %w", userID, err)
+	}
+	return credentials, nil
+}
+
+func (r Repository) UpdateWebAuthnCredential(ctx context.Context, credential models.WebAuthnCredential) error {
+	err := r.conn.DB.Model(&credential).
+		Updates(map[string]interface{}{
+			"sign_count":   credential.SignCount,
+			"backup_state": credential.BackupState,
+			"last_used_at": credential.LastUsedAt,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update passkey %d: %w", credential.ID, err)
+	}
+	return nil
+}
+
+func (r Repository) DeleteWebAuthnCredential(ctx context.Context, id, userID uint64) (bool, error) {
+	result := r.conn.DB.Unscoped().
+		Where("id = ? AND user_id = ?", id, userID).
+		Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete passkey %d: %w", id, result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// GetIdentity returns a zero Identity when the provider account is not linked.
+func (r Repository) GetIdentity(ctx context.Context, provider, subject string) (models.Identity, error) {
+	var identity models.Identity
+	err := r.conn.DB.
+		Where("provider = ? AND subject = ?", provider, subject).
+		First(&identity).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Identity{}, nil
+		}
+		return models.Identity{}, fmt.Errorf("failed to get %s identity: %w", provider, err)
+	}
+	return identity, nil
+}
+
+func (r Repository) GetIdentities(ctx context.Context, userID uint64) ([]models.Identity, error) {
+	var identities []models.Identity
+	err := r.conn.DB.
+		Where("user_id = ?", userID).
+		Order("created_at ASC").
+		Find(&identities).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identities of user %d: %w", userID, err)
+	}
+	return identities, nil
+}
+
+func (r Repository) CreateIdentity(ctx context.Context, identity models.Identity) (models.Identity, error) {
+	if err := r.conn.DB.Create(&identity).Error; err != nil {
+		return models.Identity{}, fmt.Errorf("failed to create %s identity: %w", identity.Provider, err)
+	}
+	return identity, nil
+}
+
+// RegisterWithIdentity creates a user signing up through a login provider
+// together with its identity.
+func (r Repository) RegisterWithIdentity(ctx context.Context, user models.User, identity models.Identity, invite string) (models.User, error) {
+	err := r.conn.DB.Transaction(func(tx *gorm.DB) error {
+		if err := useInvite(tx, &user, invite); err != nil {
+			return err
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		identity.UserID = user.ID
+		if err := tx.Create(&identity).Error; err != nil {
+			return fmt.Errorf("failed to create %s identity: %w", identity.Provider, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (r Repository) TouchIdentity(ctx context.Context, id uint64) error {
+	err := r.conn.DB.Model(&models.Identity{}).
+		Where("id = ?", id).
+		Update("last_login_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to touch identity %d: %w", id, err)
+	}
+	return nil
+}
+
+func (r Repository) DeleteIdentity(ctx context.Context, id, userID uint64) (bool, error) {
+	result := r.conn.DB.Unscoped().
+		Where("id = ? AND user_id = ?", id, userID).
+		Delete(&models.Identity{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete identity %d: %w", id, result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// GetRole returns a zero Role when no custom role has the name.
+func (r Repository) GetRole(ctx context.Context, name string) (models.Role, error) {
+	var role models.Role
+	if err := r.conn.DB.Where("name = ?", name).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Role{}, nil
+		}
+		return models.Role{}, fmt.Errorf("failed to get role %s: %w", name, err)
+	}
+	return role, nil
+}
+
+// CreateEmailChange saves a new email change and cancels the pending one of
+// the user, if any.
+func (r Repository) CreateEmailChange(ctx context.Context, change models.EmailChange) (models.EmailChange, error) {
+	err := r.conn.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.EmailChange{}).
+			Where("user_id = ? AND confirmed_at IS NULL AND canceled_at IS NULL", change.UserID).
+			Update("canceled_at", time.Now()).Error
+		if err != nil {
+			return fmt.Errorf("failed to cancel pending email change: %w", err)
+		}
+		if err := tx.Create(&change).Error; err != nil {
+			return fmt.Errorf("failed to create email change: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.EmailChange{}, err
+	}
+	return change, nil
+}
+
+// GetPendingEmailChange returns a zero EmailChange when the user has no
+// unconfirmed, uncanceled change.
+func (r Repository) GetPendingEmailChange(ctx context.Context, userID uint64) (models.EmailChange, error) {
+	var change models.EmailChange
+	err := r.conn.DB.
+		Where("user_id = ? AND confirmed_at IS NULL AND canceled_at IS NULL", userID).
+		Order("created_at DESC").
+		First(&change).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.EmailChange{}, nil
+		}
+		return models.EmailChange{}, fmt.Errorf("failed to get pending email change: %w", err)
+	}
+	return change, nil
+}
+
+// GetEmailChangeByCancelToken returns a zero EmailChange when no change has
+// the token.
+func (r Repository) GetEmailChangeByCancelToken(ctx context.Context, hash string) (models.EmailChange, error) {
+	var change models.EmailChange
+	if err := r.conn.DB.Where("cancel_token_hash = ?", hash).First(&change).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.EmailChange{}, nil
+		}
+		return models.EmailChange{}, fmt.Errorf("failed to get email change: %w", err)
+	}
+	return change, nil
+}
+
+// ConfirmEmailChange moves the user to the new address.
+func (r Repository) ConfirmEmailChange(ctx context.Context, change models.EmailChange) error {
+	return r.conn.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).
+			Where("id = ?", change.UserID).
+			Update("email", change.NewEmail).Error
+		if err != nil {
+			return fmt.Errorf("failed to update email of user %d: %w", change.UserID, err)
+		}
+		if err := tx.Model(&change).Update("confirmed_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to confirm email change %d: %w", change.ID, err)
+		}
+		return nil
+	})
+}
+
+// CancelEmailChange cancels a change and, when restore is set, moves the user
+// back to the old address.
+func (r Repository) CancelEmailChange(ctx context.Context, change models.EmailChange, restore bool) error {
+	return r.conn.DB.Transaction(func(tx *gorm.DB) error {
+		if restore {
+			err := tx.Model(&models.User{}).
+				Where("id = ?", change.UserID).
+				Update("email", change.OldEmail).Error
+			if err != nil {
+				return fmt.Errorf("failed to restore email of user %d: %w", change.UserID, err)
+			}
+		}
+		if err := tx.Model(&change).Update("canceled_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to cancel email change %d: %w", change.ID, err)
+		}
+		return nil
+	})
+}
+
+func (r Repository) CreatePersonalToken(ctx context.Context, pat models.PersonalAccessToken) (models.PersonalAccessToken, error) {
+	if err := r.conn.DB.Create(&pat).Error; err != nil {
+		return models.PersonalAccessToken{}, fmt.Errorf("failed to create personal access token: %w", err)
+	}
+	return pat, nil
+}
+
+func (r Repository) CountPersonalTokens(ctx context.Context, userID uint64) (int64, error) {
+	var count int64
+	if err := r.conn.DB.Model(&models.PersonalAccessToken{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count personal access tokens: %w", err)
+	}
+	return count, nil
+}
+
+func (r Repository) GetPersonalTokens(ctx context.Context, userID uint64) ([]models.PersonalAccessToken, error) {
+	var pats []models.PersonalAccessToken
+	if err := r.conn.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&pats).Error; err != nil {
+		return nil, fmt.Errorf("failed to get personal access tokens: %w", err)
+	}
+	return pats, nil
+}
+
+// GetPersonalTokenByHash returns a zero PersonalAccessToken when none has the
+// hash.
+func (r Repository) GetPersonalTokenByHash(ctx context.Context, hash string) (models.PersonalAccessToken, error) {
+	var pat models.PersonalAccessToken
+	if err := r.conn.DB.Where("token_hash = ?", hash).First(&pat).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.PersonalAccessToken{}, nil
+		}
+		return models.PersonalAccessToken{}, fmt.Errorf("failed to get personal access token: %w", err)
+	}
+	return pat, nil
+}
+
+// TouchPersonalToken records a use of the token, unless one was already
+// recorded after since, so that busy tokens do not write on every request.
+func (r Repository) TouchPersonalToken(ctx context.Context, id uint64, ip string, since time.Time) error {
+	err := r.conn.DB.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, since).
+		Updates(map[string]interface{}{"last_used_at": time.Now(), "last_used_ip": ip}).Error
+	if err != nil {
+		return fmt.Errorf("failed to touch personal access token %d: %w", id, err)
+	}
+	return nil
+}
+
+// DeletePersonalToken reports false when the user has no token with the ID.
+func (r Repository) DeletePersonalToken(ctx context.Context, userID, id uint64) (bool, error) {
+	result := r.conn.DB.Unscoped().Where("id = ? AND user_id = ?", id, userID).Delete(&models.PersonalAccessToken{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete personal access token %d: %w", id, result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r Repository) CreateInvite(ctx context.Context, invite models.Invite) (models.Invite, error) {
+	if err := r.conn.DB.Create(&invite).Error; err != nil {
+		return models.Invite{}, fmt.Errorf("failed to create invite: %w", err)
+	}
+	return invite, nil
+}
+
+// GetInvites returns the invites created by a user, or every invite when
+// createdByID is 0.
+func (r Repository) GetInvites(ctx context.Context, createdByID uint64) ([]models.Invite, error) {
+	var invites []models.Invite
+	db := r.conn.DB.Order("created_at DESC")
+	if createdByID != 0 {
+		db = db.Where("created_by_id = ?", createdByID)
+	}
+	if err := db.Find(&invites).Error; err != nil {
+		return nil, fmt.Errorf("failed to get invites: %w", err)
+	}
+	return invites, nil
+}
+
+// GetInvite returns a zero Invite when there is none with the ID.
+func (r Repository) GetInvite(ctx context.Context, id uint64) (models.Invite, error) {
+	var invite models.Invite
+	if err := r.conn.DB.First(&invite, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Invite{}, nil
+		}
+		return models.Invite{}, fmt.Errorf("failed to get invite %d: %w", id, err)
+	}
+	return invite, nil
+}
+
+func (r Repository) CountUsableInvites(ctx context.Context, createdByID uint64) (int64, error) {
+	var count int64
+	err := r.conn.DB.Model(&models.Invite{}).
+		Where("created_by_id = ? AND uses < max_uses AND (expires_at IS NULL OR expires_at > ?)", createdByID, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count invites: %w", err)
+	}
+	return count, nil
+}
+
+func (r Repository) DeleteInvite(ctx context.Context, id uint64) error {
+	if err := r.conn.DB.Unscoped().Delete(&models.Invite{}, id).Error; err != nil {
+		return fmt.Errorf("failed to delete invite %d: %w", id, err)
+	}
+	return nil
+}
+
+func (r Repository) GetInvitees(ctx context.Context, inviterID uint64) ([]models.User, error) {
+	var users []models.User
+	if err := r.conn.DB.Where("invited_by_id = ?", inviterID).Order("created_at DESC").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to get invitees: %w", err)
+	}
+	return users, nil
+}
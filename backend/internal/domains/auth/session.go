@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"social-app/api/auth"
+	"social-app/internal/models"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// startSession opens a new session for the user, which is also the refresh
+// token family of the issued tokens.
+func (u UseCase) startSession(ctx context.Context, user models.User, client auth.ClientInfo) (auth.JWTToken, error) {
+	sessionID := uuid.New()
+
+	device := client.Device
+	if device == "" {
+		device = deviceFromUserAgent(client.UserAgent)
+	}
+
+	_, err := u.repo.CreateSession(ctx, models.Session{
+		Model: models.Model{
+			UUID: uuid.NullUUID{UUID: sessionID, Valid: true},
+		},
+		UserID:     user.ID,
+		Device:     device,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		LastSeenAt: time.Now(),
+	})
+	if err != nil {
+		return auth.JWTToken{}, fmt.Errorf("failed to start session: %w", err)
+	}
+
+	tk, err := u.generateJWT(ctx, user, sessionID.String())
+	if err != nil {
+		return auth.JWTToken{}, fmt.Errorf("failed to generate JWT token: %w", err)
+	}
+
+	return tk, nil
+}
+
+func (u UseCase) ListSessions(ctx context.Context, userID uint64, currentID string) ([]models.Session, error) {
+	sessions, err := u.repo.GetActiveSessions(ctx, userID, time.Now().Add(-u.authCfg.RefreshExpDuration))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].UUID.Valid && sessions[i].UUID.UUID.String() == currentID
+	}
+
+	return sessions, nil
+}
+
+func (u UseCase) RevokeSession(ctx context.Context, userID uint64, sessionID uuid.UUID) error {
+	session, err := u.repo.GetSession(ctx, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	if session.ID == 0 {
+		return ErrSessionNotFound
+	}
+
+	return u.revokeSession(ctx, userID, sessionID.String())
+}
+
+// revokeSession invalidates the refresh token family and the access tokens of
+// a session, then closes the websocket it opened.
+func (u UseCase) revokeSession(ctx context.Context, userID uint64, sessionID string) error {
+	if err := u.tokens.RevokeFamily(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := u.denylist.RevokeSession(ctx, sessionID, u.authCfg.JWTExpDuration); err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+
+	if id, err := uuid.Parse(sessionID); err == nil {
+		if err := u.repo.RevokeSession(ctx, id); err != nil {
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
+	}
+
+	if err := u.conn.CloseSession(ctx, userID, sessionID); err != nil {
+		return fmt.Errorf("failed to close websocket connection: %w", err)
+	}
+
+	return nil
+}
+
+func deviceFromUserAgent(ua string) string {
+	switch {
+	case ua == "":
+		return "Unknown"
+	case strings.Contains(ua, "iPhone"):
+		return "iPhone"
+	case strings.Contains(ua, "iPad"):
+		return "iPad"
+	case strings.Contains(ua, "Android"):
+		return "Android"
+	case strings.Contains(ua, "Windows"):
+		return "Windows"
+	case strings.Contains(ua, "Macintosh"), strings.Contains(ua, "Mac OS X"):
+		return "macOS"
+	case strings.Contains(ua, "Linux"):
+		return "Linux"
+	default:
+		return "Unknown"
+	}
+}
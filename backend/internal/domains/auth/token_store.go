@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"social-app/internal/connector"
+)
+
+const (
+	refreshKeyPrefix      = "auth:refresh:"
+	refreshUsedKeyPrefix  = "auth:refresh:used:"
+	familyKeyPrefix       = "auth:family:"
+	userFamiliesKeyPrefix = "auth:user:families:"
+	totpUsedKeyPrefix     = "auth:totp:used:"
+	ceremonyKeyPrefix     = "auth:webauthn:"
+	resetUsedKeyPrefix    = "auth:reset:used:"
+	oauthStateKeyPrefix   = "auth:oauth:state:"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrCeremonyNotFound    = errors.New("passkey ceremony not found")
+	ErrOAuthStateNotFound  = errors.New("oauth state not found")
+)
+
+// TokenStore keeps track of issued refresh tokens. Only a SHA-256 hash of each
+// token is persisted, grouped by family (one family per login) so that a
+// replayed token can revoke every token derived from the same login.
+type TokenStore struct {
+	redisConn *connector.RedisConnector
+}
+
+func NewTokenStore(r *connector.RedisConnector) TokenStore {
+	return TokenStore{
+		redisConn: r,
+	}
+}
+
+func (s TokenStore) SaveRefresh(ctx context.Context, token, familyID string, userID uint64, ttl time.Duration) error {
+	if err := s.redisConn.Set(ctx, familyKeyPrefix+familyID, strconv.FormatUint(userID, 10), ttl); err != nil {
+		return fmt.Errorf("failed to save token family: %w", err)
+	}
+
+	userKey := userFamiliesKey(userID)
+	if err := s.redisConn.SAdd(ctx, userKey, familyID); err != nil {
+		return fmt.Errorf("failed to index token family: %w", err)
+	}
+	if err := s.redisConn.Expire(ctx, userKey, ttl); err != nil {
+		return fmt.Errorf("failed to index token family: %w", err)
+	}
+
+	if err := s.redisConn.Set(ctx, refreshKeyPrefix+hashToken(token), familyID, ttl); err != nil {
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeRefresh invalidates the given refresh token and returns its family.
+// Presenting a token that was already consumed revokes the whole family.
+func (s TokenStore) ConsumeRefresh(ctx context.Context, token string, ttl time.Duration) (string, error) {
+	hash := hashToken(token)
+
+	familyID, ok, err := s.redisConn.DeleteIfExists(ctx, refreshKeyPrefix+hash)
+	if err != nil {
+		return "", fmt.Errorf("failed to consume refresh token: %w", err)
+	}
+
+	if !ok {
+		usedFamilyID, err := s.redisConn.Get(ctx, refreshUsedKeyPrefix+hash)
+		if err != nil {
+			return "", fmt.Errorf("failed to check refresh token reuse: %w", err)
+		}
+		if usedFamilyID == "" {
+			return "", ErrInvalidRefreshToken
+		}
+
+		if err := s.RevokeFamily(ctx, usedFamilyID); err != nil {
+			return "", err
+		}
+		return "", ErrRefreshTokenReused
+	}
+
+	if err := s.redisConn.Set(ctx, refreshUsedKeyPrefix+hash, familyID, ttl); err != nil {
+		return "", fmt.Errorf("failed to mark refresh token as used: %w", err)
+	}
+
+	active, err := s.redisConn.IsExists(ctx, familyKeyPrefix+familyID)
+	if err != nil {
+		return "", fmt.Errorf("failed to check token family: %w", err)
+	}
+	if !active {
+		return "", ErrInvalidRefreshToken
+	}
+
+	return familyID, nil
+}
+
+func (s TokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	uid, _, err := s.redisConn.DeleteIfExists(ctx, familyKeyPrefix+familyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token family %s: %w", familyID, err)
+	}
+	if uid == "" {
+		return nil
+	}
+
+	userID, err := strconv.ParseUint(uid, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid user id for token family %s: %w", familyID, err)
+	}
+
+	if err := s.redisConn.SRem(ctx, userFamiliesKey(userID), familyID); err != nil {
+		return fmt.Errorf("failed to unindex token family %s: %w", familyID, err)
+	}
+
+	return nil
+}
+
+func (s TokenStore) RevokeUser(ctx context.Context, userID uint64) error {
+	families, err := s.redisConn.SMembers(ctx, userFamiliesKey(userID))
+	if err != nil {
+		return fmt.Errorf("failed to list token families of user %d: %w", userID, err)
+	}
+
+	for _, familyID := range families {
+		if err := s.RevokeFamily(ctx, familyID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UseTOTPStep records that the user consumed the given TOTP time step and
+// reports false when it was already used, preventing code replay.
+func (s TokenStore) UseTOTPStep(ctx context.Context, userID, step uint64, ttl time.Duration) (bool, error) {
+	ok, err := s.redisConn.SetNX(ctx, fmt.Sprintf("%s%d:%d", totpUsedKeyPrefix, userID, step), "1", ttl)
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP step: %w", err)
+	}
+	return ok, nil
+}
+
+// UseResetToken records that a password reset token was redeemed and reports
+// false when it already was.
+func (s TokenStore) UseResetToken(ctx context.Context, tokenID string, ttl time.Duration) (bool, error) {
+	ok, err := s.redisConn.SetNX(ctx, resetUsedKeyPrefix+tokenID, "1", ttl)
+	if err != nil {
+		return false, fmt.Errorf("failed to record password reset token: %w", err)
+	}
+	return ok, nil
+}
+
+// SaveCeremony keeps the state of a WebAuthn ceremony until the browser
+// answers it.
+func (s TokenStore) SaveCeremony(ctx context.Context, ceremonyID string, state []byte, ttl time.Duration) error {
+	if err := s.redisConn.Set(ctx, ceremonyKeyPrefix+ceremonyID, string(state), ttl); err != nil {
+		return fmt.Errorf("failed to save passkey ceremony: %w", err)
+	}
+	return nil
+}
+
+// TakeCeremony returns the state of a WebAuthn ceremony and forgets it, so a
+// challenge can only be answered once.
+func (s TokenStore) TakeCeremony(ctx context.Context, ceremonyID string) ([]byte, error) {
+	state, ok, err := s.redisConn.DeleteIfExists(ctx, ceremonyKeyPrefix+ceremonyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get passkey ceremony: %w", err)
+	}
+	if !ok {
+		return nil, ErrCeremonyNotFound
+	}
+	return []byte(state), nil
+}
+
+// SaveOAuthState keeps what an SSO login started with until the provider
+// redirects back with the state.
+func (s TokenStore) SaveOAuthState(ctx context.Context, state string, data []byte, ttl time.Duration) error {
+	if err := s.redisConn.Set(ctx, oauthStateKeyPrefix+hashToken(state), string(data), ttl); err != nil {
+		return fmt.Errorf("failed to save oauth state: %w", err)
+	}
+	return nil
+}
+
+// TakeOAuthState returns the data saved for a state and forgets it, so a
+// callback cannot be replayed.
+func (s TokenStore) TakeOAuthState(ctx context.Context, state string) ([]byte, error) {
+	data, ok, err := s.redisConn.DeleteIfExists(ctx, oauthStateKeyPrefix+hashToken(state))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth state: %w", err)
+	}
+	if !ok {
+		return nil, ErrOAuthStateNotFound
+	}
+	return []byte(data), nil
+}
+
+func userFamiliesKey(userID uint64) string {
+	return fmt.Sprintf("%s%d", userFamiliesKeyPrefix, userID)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConsumeRefreshReuse(t *testing.T) {
+	uc, _, mr := newTestUseCase(t)
+	ctx := context.Background()
+	tokens := uc.tokens
+
+	if err := tokens.SaveRefresh(ctx, "first", "family", 7, time.Hour); err != nil {
+		t.Fatalf("SaveRefresh failed: %v", err)
+	}
+	familyID, err := tokens.ConsumeRefresh(ctx, "first", time.Hour)
+	if err != nil || familyID != "family" {
+		t.Fatalf("Expected the family of the token, got %q, %v", familyID, err)
+	}
+
+	// The rotation issues the next token of the family.
+	if err := tokens.SaveRefresh(ctx, "second", "family", 7, time.Hour); err != nil {
+		t.Fatalf("SaveRefresh failed: %v", err)
+	}
+
+	// Replaying the consumed token revokes the whole family, so the token
+	// that replaced it is refused as well.
+	if _, err := tokens.ConsumeRefresh(ctx, "first", time.Hour); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Expected ErrRefreshTokenReused, got %v", err)
+	}
+	if mr.Exists(familyKeyPrefix + "family") {
+		t.Error("Expected the family to be revoked")
+	}
+	if ok, _ := mr.SIsMember(userFamiliesKey(7), "family"); ok {
+		t.Error("Expected the family to leave the index of the user")
+	}
+	if _, err := tokens.ConsumeRefresh(ctx, "second", time.Hour); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Expected the rest of the family to be refused, got %v", err)
+	}
+
+	if _, err := tokens.ConsumeRefresh(ctx, "unknown", time.Hour); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Expected ErrInvalidRefreshToken for an unknown token, got %v", err)
+	}
+}
+
+func TestRevokeFamilyKeepsOtherFamilies(t *testing.T) {
+	uc, _, _ := newTestUseCase(t)
+	ctx := context.Background()
+	tokens := uc.tokens
+
+	for _, family := range []string{"laptop", "phone"} {
+		if err := tokens.SaveRefresh(ctx, family+"-token", family, 7, time.Hour); err != nil {
+			t.Fatalf("SaveRefresh failed: %v", err)
+		}
+	}
+
+	if err := tokens.RevokeFamily(ctx, "laptop"); err != nil {
+		t.Fatalf("RevokeFamily failed: %v", err)
+	}
+	if _, err := tokens.ConsumeRefresh(ctx, "laptop-token", time.Hour); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Expected the revoked family to be refused, got %v", err)
+	}
+	if familyID, err := tokens.ConsumeRefresh(ctx, "phone-token", time.Hour); err != nil || familyID != "phone" {
+		t.Errorf("Expected the other family to stay valid, got %q, %v", familyID, err)
+	}
+
+	// Revoking a family twice is harmless.
+	if err := tokens.RevokeFamily(ctx, "laptop"); err != nil {
+		t.Errorf("Expected a second revocation to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-app/api/auth"
+	"social-app/internal/models"
+	"social-app/pkg/totp"
+)
+
+const (
+	twoFactorTTL         = 5 * time.Minute
+	totpSkew             = 1
+	recoveryCodeCount    = 10
+	recoveryCodeLength   = 10
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var (
+	ErrTOTPAlreadyEnabled   = errors.New("TOTP already enabled")
+	ErrTOTPNotEnrolled      = errors.New("TOTP not enrolled")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+)
+
+// SetupTOTP generates a new secret for the user. It only becomes active once
+// confirmed with a valid code through ConfirmTOTP.
+func (u UseCase) SetupTOTP(ctx context.Context, userID uint64) (auth.TOTPSetup, error) {
+	user, err := u.repo.Get(ctx, userID)
+	if err != nil {
+		return auth.TOTPSetup{}, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.TOTPEnabled {
+		return auth.TOTPSetup{}, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return auth.TOTPSetup{}, err
+	}
+
+	sealed, err := u.secrets.Seal(totpSecretOwner(user.ID), []byte(secret))
+	if err != nil {
+		return auth.TOTPSetup{}, fmt.Errorf("failed to seal TOTP secret: %w", err)
+	}
+
+	user.TOTPSecret = sealed
+	if err := u.repo.UpdateTOTP(ctx, user); err != nil {
+		return auth.TOTPSetup{}, err
+	}
+
+	return auth.TOTPSetup{
+		Secret: secret,
+		URI:    totp.URI(u.authCfg.TOTPIssuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables TOTP for the user and returns fresh recovery codes,
+// which are only ever shown here. Once the code has used up its attempts the
+// pending secret is discarded and enrollment starts over.
+func (u UseCase) ConfirmTOTP(ctx context.Context, userID uint64, code string, client auth.ClientInfo) (auth.RecoveryCodes, error) {
+	user, err := u.repo.Get(ctx, userID)
+	if err != nil {
+		return auth.RecoveryCodes{}, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.TOTPEnabled {
+		return auth.RecoveryCodes{}, ErrTOTPAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return auth.RecoveryCodes{}, ErrTOTPNotEnrolled
+	}
+
+	discard := func() error {
+		user.TOTPSecret = ""
+		return u.repo.UpdateTOTP(ctx, user)
+	}
+	if err := u.guardSecondFactor(ctx, user, client.IP, discard, func() error {
+		return u.checkTOTP(ctx, user, code)
+	}); err != nil {
+		return auth.RecoveryCodes{}, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return auth.RecoveryCodes{}, err
+	}
+	if err := u.repo.ReplaceRecoveryCodes(ctx, user.ID, hashes); err != nil {
+		return auth.RecoveryCodes{}, err
+	}
+
+	user.TOTPEnabled = true
+	if err := u.repo.UpdateTOTP(ctx, user); err != nil {
+		return auth.RecoveryCodes{}, err
+	}
+
+	return auth.RecoveryCodes{Codes: codes}, nil
+}
+
+// DisableTOTP turns TOTP off with the password, when the user has one, and
+// a TOTP or recovery code.
+func (u UseCase) DisableTOTP(ctx context.Context, userID uint64, input auth.DisableTOTPInput, client auth.ClientInfo) error {
+	user, err := u.repo.Get(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.TOTPEnabled {
+		return ErrTOTPNotEnrolled
+	}
+
+	if err := u.Reauthenticate(ctx, user, input.Password, client); err != nil {
+		return err
+	}
+	if err := u.guardSecondFactor(ctx, user, client.IP, nil, func() error {
+		return u.checkSecondFactor(ctx, user, input.Code)
+	}); err != nil {
+		return err
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	if err := u.repo.UpdateTOTP(ctx, user); err != nil {
+		return err
+	}
+
+	return u.repo.ReplaceRecoveryCodes(ctx, user.ID, nil)
+}
+
+// VerifyTwoFactor exchanges a need_2fa token and a TOTP or recovery code for
+// a regular session. The need_2fa token cannot be used twice.
+func (u UseCase) VerifyTwoFactor(ctx context.Context, input auth.TwoFactorInput, client auth.ClientInfo) (auth.JWTToken, error) {
+	user, err := u.repo.Get(ctx, input.UserID)
+	if err != nil {
+		return auth.JWTToken{}, fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.TOTPEnabled {
+		return auth.JWTToken{}, ErrTOTPNotEnrolled
+	}
+
+	if err := u.guard.Check(ctx, user.ID, client.IP); err != nil {
+		return auth.JWTToken{}, err
+	}
+
+	if err := u.checkSecondFactor(ctx, user, input.Code); err != nil {
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			return auth.JWTToken{}, err
+		}
+		if err := u.twoFactorFailed(ctx, user, input, client.IP); err != nil {
+			return auth.JWTToken{}, err
+		}
+		return auth.JWTToken{}, err
+	}
+
+	if err := u.guard.Succeed(ctx, user.ID); err != nil {
+		return auth.JWTToken{}, err
+	}
+	if err := u.guard.ResetCode(ctx, user.ID, twoFactorCodeKind); err != nil {
+		return auth.JWTToken{}, err
+	}
+
+	if err := u.denylist.Revoke(ctx, input.TokenID, input.ExpiresAt); err != nil {
+		return auth.JWTToken{}, fmt.Errorf("failed to revoke two-factor token: %w", err)
+	}
+
+	return u.startSession(ctx, user, client)
+}
+
+// twoFactorFailed counts a wrong second factor. Once the need_2fa token has
+// used up its attempts it is revoked and the user has to log in again.
+func (u UseCase) twoFactorFailed(ctx context.Context, user models.User, input auth.TwoFactorInput, ip string) error {
+	if err := u.loginFailed(ctx, user, ip); err != nil {
+		return err
+	}
+
+	exhausted, err := u.guard.FailCode(ctx, user.ID, twoFactorCodeKind)
+	if err != nil {
+		return err
+	}
+	if !exhausted {
+		return nil
+	}
+
+	if err := u.denylist.Revoke(ctx, input.TokenID, input.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to revoke two-factor token: %w", err)
+	}
+	return nil
+}
+
+// guardSecondFactor runs check under the limits of a two-factor login: a
+// wrong code counts as a failed login and against the attempts of the code.
+// discard, when set, is called once those attempts are used up.
+func (u UseCase) guardSecondFactor(ctx context.Context, user models.User, ip string, discard func() error, check func() error) error {
+	if err := u.guard.Check(ctx, user.ID, ip); err != nil {
+		return err
+	}
+
+	if checkErr := check(); checkErr != nil {
+		if !errors.Is(checkErr, ErrInvalidTwoFactorCode) {
+			return checkErr
+		}
+		if err := u.loginFailed(ctx, user, ip); err != nil {
+			return err
+		}
+		exhausted, err := u.guard.FailCode(ctx, user.ID, twoFactorCodeKind)
+		if err != nil {
+			return err
+		}
+		if exhausted && discard != nil {
+			if err := discard(); err != nil {
+				return fmt.Errorf("failed to discard two-factor secret: %w", err)
+			}
+		}
+		return checkErr
+	}
+
+	if err := u.guard.Succeed(ctx, user.ID); err != nil {
+		return err
+	}
+	return u.guard.ResetCode(ctx, user.ID, twoFactorCodeKind)
+}
+
+func (u UseCase) issueTwoFactorToken(ctx context.Context, user models.User) (auth.JWTToken, error) {
+	if err := u.guard.ResetCode(ctx, user.ID, twoFactorCodeKind); err != nil {
+		return auth.JWTToken{}, err
+	}
+
+	tk, err := u.generateToken(ctx, user, twoFactorTTL, map[string]any{
+		"typ":      "2fa",
+		"need_2fa": true,
+	})
+	if err != nil {
+		return auth.JWTToken{}, fmt.Errorf("failed to generate two-factor token: %w", err)
+	}
+
+	return auth.JWTToken{
+		TwoFactorToken: tk,
+		VerifyResponse: auth.VerifyResponse{
+			ID:       user.ID,
+			Username: user.Username,
+			Verified: user.Verified,
+		},
+	}, nil
+}
+
+func (u UseCase) checkSecondFactor(ctx context.Context, user models.User, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return u.checkTOTP(ctx, user, code)
+	}
+
+	used, err := u.repo.UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (u UseCase) checkTOTP(ctx context.Context, user models.User, code string) error {
+	secret, err := u.secrets.Open(totpSecretOwner(user.ID), user.TOTPSecret)
+	if err != nil {
+		return fmt.Errorf("failed to open TOTP secret of user %d: %w", user.ID, err)
+	}
+
+	step, ok := totp.Validate(string(secret), strings.TrimSpace(code), time.Now(), totpSkew)
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	fresh, err := u.tokens.UseTOTPStep(ctx, user.ID, step, time.Duration(2*totpSkew+1)*totp.Period)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// totpSecretOwner binds a sealed TOTP secret to its user, so that it cannot
+// be copied to another account.
+func totpSecretOwner(userID uint64) string {
+	return "totp:" + strconv.FormatUint(userID, 10)
+}
+
+func generateRecoveryCodes() (codes, hashes []string, err error) {
+	codes = make([]string, 0, recoveryCodeCount)
+	hashes = make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, recoveryCodeLength)
+		for j := range raw {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+			}
+			raw[j] = recoveryCodeAlphabet[n.Int64()]
+		}
+
+		code := string(raw)
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+		hashes = append(hashes, hashToken(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -2,69 +2,79 @@ package auth
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/subtle"
+	"errors"
 	"fmt"
-	"net/http"
+	"log"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 	"social-app/api/auth"
+	"social-app/api/profile"
 	"social-app/internal/config"
 	"social-app/internal/models"
 	"social-app/internal/utils"
 	"social-app/pkg/notifier"
+	"social-app/pkg/passkey"
+	"social-app/pkg/rbac"
+	"social-app/pkg/sso"
+	"social-app/pkg/token"
 	"social-app/pkg/ws"
 )
 
-type googleUserInfo struct {
-	ID      string `json:"id"`
-	Email   string `json:"email"`
-	Name    string `json:"name"`
-	Picture string `json:"picture"`
-}
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidCode        = errors.New("invalid verification code")
+)
 
 type UseCase struct {
-	mailer            notifier.Mailerx
-	sms               notifier.SMSNotifier
-	repo              Repository
-	conn              *ws.Connector
-	googleOAuthConfig *oauth2.Config
-	jwtKey            []byte
-	authCfg           config.Auth
+	mailer    notifier.Mailerx
+	sms       notifier.SMSNotifier
+	repo      Repository
+	tokens    TokenStore
+	guard     LoginGuard
+	denylist  *token.Denylist
+	conn      *ws.Connector
+	providers *sso.Registry
+	keys      *token.KeyManager
+	secrets   *token.Sealer
+	passkeys  *passkey.RelyingParty
+	authCfg   config.Auth
 }
 
-func NewUseCase(r Repository, cfg config.Auth, c *ws.Connector, s notifier.SMSNotifier, m notifier.Mailerx) UseCase {
-	googleOAuthConfig := &oauth2.Config{
-		ClientID:     cfg.Sso.Google.ClientID,
-		ClientSecret: cfg.Sso.Google.ClientSecret,
-		RedirectURL:  cfg.Sso.Google.RedirectURL,
-		Scopes:       cfg.Sso.Google.GetScopes(),
-		Endpoint:     google.Endpoint,
-	}
+func NewUseCase(r Repository, ts TokenStore, g LoginGuard, dl *token.Denylist, km *token.KeyManager, ss *token.Sealer, rp *passkey.RelyingParty, sr *sso.Registry, cfg config.Auth, c *ws.Connector, s notifier.SMSNotifier, m notifier.Mailerx) UseCase {
 	return UseCase{
-		repo:              r,
-		jwtKey:            []byte(cfg.JWTSecret),
-		conn:              c,
-		mailer:            m,
-		sms:               s,
-		authCfg:           cfg,
-		googleOAuthConfig: googleOAuthConfig,
+		repo:      r,
+		tokens:    ts,
+		guard:     g,
+		denylist:  dl,
+		keys:      km,
+		secrets:   ss,
+		passkeys:  rp,
+		conn:      c,
+		mailer:    m,
+		sms:       s,
+		authCfg:   cfg,
+		providers: sr,
 	}
 }
 
 func (u UseCase) Register(ctx context.Context, input auth.RegisterInput) (models.User, error) {
+	if err := u.checkRegistration(input.Invite); err != nil {
+		return models.User{}, err
+	}
+
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(input.Password), 14)
 	user := models.User{
 		Username: input.Username,
 		Email:    input.Email,
 		Password: string(hashedPassword),
-		Role:     "user",
+		Role:     rbac.RoleUser,
 	}
 
-	user, err := u.repo.Register(ctx, user)
+	user, err := u.repo.Register(ctx, user, input.Invite)
 	if err != nil {
 		return user, fmt.Errorf("failed to register user: %w", err)
 	}
@@ -72,14 +82,32 @@ func (u UseCase) Register(ctx context.Context, input auth.RegisterInput) (models
 	return user, nil
 }
 
-func (u UseCase) Login(ctx context.Context, input auth.LoginInput) (auth.JWTToken, error) {
+func (u UseCase) Login(ctx context.Context, input auth.LoginInput, client auth.ClientInfo) (auth.JWTToken, error) {
+	if err := u.guard.Check(ctx, 0, client.IP); err != nil {
+		return auth.JWTToken{}, err
+	}
+
 	user, err := u.repo.Login(ctx, input.Username)
 	if err != nil {
-		return auth.JWTToken{}, fmt.Errorf("failed to login user: %w", err)
+		if err := u.loginFailed(ctx, models.User{}, client.IP); err != nil {
+			return auth.JWTToken{}, err
+		}
+		return auth.JWTToken{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	if err := u.guard.Check(ctx, user.ID, ""); err != nil {
+		return auth.JWTToken{}, err
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		return auth.JWTToken{}, fmt.Errorf("invalid credentials: %w", err)
+		if err := u.loginFailed(ctx, user, client.IP); err != nil {
+			return auth.JWTToken{}, err
+		}
+		return auth.JWTToken{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	if err := u.guard.Succeed(ctx, user.ID); err != nil {
+		return auth.JWTToken{}, err
 	}
 
 	if !user.Verified || user.VerifiedExpires.Before(time.Now()) {
@@ -95,9 +123,13 @@ func (u UseCase) Login(ctx context.Context, input auth.LoginInput) (auth.JWTToke
 		}, nil
 	}
 
-	token, err := u.generateJWT(user)
+	if user.TOTPEnabled {
+		return u.issueTwoFactorToken(ctx, user)
+	}
+
+	token, err := u.startSession(ctx, user, client)
 	if err != nil {
-		return auth.JWTToken{}, fmt.Errorf("failed to generate JWT token: %w", err)
+		return auth.JWTToken{}, err
 	}
 
 	token.VerifyResponse = auth.VerifyResponse{
@@ -109,26 +141,99 @@ func (u UseCase) Login(ctx context.Context, input auth.LoginInput) (auth.JWTToke
 	return token, nil
 }
 
-func (u UseCase) handleVerificationPending(ctx context.Context, user models.User) error {
-	code, err := utils.GenerateCode(6)
+// loginFailed records a failed attempt and tells the user by email when it
+// locked their account.
+func (u UseCase) loginFailed(ctx context.Context, user models.User, ip string) error {
+	locked, err := u.guard.Fail(ctx, user.ID, ip)
 	if err != nil {
-		return fmt.Errorf("failed to generate verification code: %w", err)
+		return err
 	}
-	user.VerifiedCode = code
+
+	if locked > 0 && user.Email != "" {
+		until := time.Now().Add(locked)
+		go func(to string) {
+			if err := u.mailer.SendAccountLocked(to, until); err != nil {
+				log.Printf("[Auth] Failed to send account locked email: %v", err)
+			}
+		}(user.Email)
+	}
+
+	return nil
+}
+
+// codeFailed counts a wrong verification code on a channel. Once the code has
+// used up its attempts it is discarded and the user has to request a new one.
+func (u UseCase) codeFailed(ctx context.Context, user models.User, channel, ip string) error {
+	if err := u.loginFailed(ctx, user, ip); err != nil {
+		return err
+	}
+
+	exhausted, err := u.guard.FailCode(ctx, user.ID, channelCodeKind(channel))
+	if err != nil {
+		return err
+	}
+	if !exhausted {
+		return nil
+	}
+
+	if channel == profile.ChannelSMS {
+		user.PhoneCode = ""
+	} else {
+		user.VerifiedCode = ""
+	}
+	if err := u.repo.Update2FA(ctx, user); err != nil {
+		return fmt.Errorf("failed to discard verification code: %w", err)
+	}
+	return nil
+}
+
+func channelCodeKind(channel string) string {
+	if channel == profile.ChannelSMS {
+		return phoneCodeKind
+	}
+	return verifyCodeKind
+}
+
+// handleVerificationPending sends a fresh code on every channel the user has,
+// each with its own code.
+func (u UseCase) handleVerificationPending(ctx context.Context, user models.User) error {
 	user.VerifiedAt = time.Now()
 	user.VerifiedExpires = time.Now().Add(15 * 24 * time.Hour)
 
+	var emailCode, phoneCode string
+	if user.Email != "" {
+		code, err := newVerificationCode()
+		if err != nil {
+			return err
+		}
+		emailCode, user.VerifiedCode = code, code
+	}
+	if user.Phone != "" {
+		// Past the SMS limits no SMS goes out: the code sent last stays valid.
+		err := u.guard.AllowSMS(ctx, user.ID, user.Phone)
+		if err != nil && !errors.Is(err, ErrTooManyAttempts) {
+			return err
+		}
+		if err == nil {
+			code, err := newVerificationCode()
+			if err != nil {
+				return err
+			}
+			phoneCode, user.PhoneCode = code, code
+		}
+	}
+
 	if err := u.repo.Update2FA(ctx, user); err != nil {
 		return fmt.Errorf("failed to save 2FA: %w", err)
 	}
 
-	if user.Phone != "" {
-		if err := u.sms.SendPhoneVerification(user.Phone, code); err != nil {
+	if phoneCode != "" {
+		if err := u.sms.SendPhoneVerification(user.Phone, phoneCode); err != nil {
 			return fmt.Errorf("failed to send SMS verification: %w", err)
 		}
 	}
-	if user.Email != "" {
-		if err := u.mailer.SendEmailVerification(user.Email, code); err != nil {
+	if emailCode != "" {
+		if err := u.mailer.SendEmailVerification(user.Email, emailCode); err != nil {
 			return fmt.Errorf("failed to send email verification: %w", err)
 		}
 	}
@@ -136,7 +241,47 @@ func (u UseCase) handleVerificationPending(ctx context.Context, user models.User
 	return nil
 }
 
-func (u UseCase) Logout(ctx context.Context, userID uint64) error {
+// newVerificationCode generates a verification code. The wrong codes entered
+// for the previous one still count against it, so asking for a new code does
+// not give more attempts.
+func newVerificationCode() (string, error) {
+	code, err := utils.GenerateCode(6)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate verification code: %w", err)
+	}
+	return code, nil
+}
+
+func (u UseCase) Logout(ctx context.Context, input auth.LogoutInput) error {
+	if err := u.denylist.Revoke(ctx, input.TokenID, input.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+
+	if input.SessionID == "" {
+		if err := u.conn.CloseClient(ctx, input.UserID); err != nil {
+			return fmt.Errorf("failed to close websocket connection: %w", err)
+		}
+		return nil
+	}
+
+	return u.revokeSession(ctx, input.UserID, input.SessionID)
+}
+
+// RevokeAllSessions signs the user out everywhere: every access token issued
+// so far is denied and every refresh token family is revoked.
+func (u UseCase) RevokeAllSessions(ctx context.Context, userID uint64) error {
+	if err := u.denylist.RevokeUser(ctx, userID, u.authCfg.JWTExpDuration); err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+
+	if err := u.tokens.RevokeUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := u.repo.RevokeUserSessions(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
 	if err := u.conn.CloseClient(ctx, userID); err != nil {
 		return fmt.Errorf("failed to close websocket connection: %w", err)
 	}
@@ -144,13 +289,35 @@ func (u UseCase) Logout(ctx context.Context, userID uint64) error {
 	return nil
 }
 
-func (u UseCase) RefreshToken(ctx context.Context, userID uint64) (auth.JWTToken, error) {
+func (u UseCase) RefreshToken(ctx context.Context, refreshToken string) (auth.JWTToken, error) {
+	userID, familyID, err := u.parseRefreshToken(refreshToken)
+	if err != nil {
+		return auth.JWTToken{}, err
+	}
+
+	storedFamilyID, err := u.tokens.ConsumeRefresh(ctx, refreshToken, u.authCfg.RefreshExpDuration)
+	if err != nil {
+		return auth.JWTToken{}, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if storedFamilyID != familyID {
+		if err := u.tokens.RevokeFamily(ctx, storedFamilyID); err != nil {
+			return auth.JWTToken{}, err
+		}
+		return auth.JWTToken{}, ErrInvalidRefreshToken
+	}
+
 	refreshedUser, err := u.repo.Get(ctx, userID)
 	if err != nil {
 		return auth.JWTToken{}, fmt.Errorf("failed to refresh token: %w", err)
 	}
 
-	token, err := u.generateJWT(refreshedUser)
+	if sessionID, err := uuid.Parse(familyID); err == nil {
+		if err := u.repo.TouchSession(ctx, sessionID); err != nil {
+			return auth.JWTToken{}, fmt.Errorf("failed to refresh token: %w", err)
+		}
+	}
+
+	token, err := u.generateJWT(ctx, refreshedUser, familyID)
 	if err != nil {
 		return auth.JWTToken{}, fmt.Errorf("failed to generate JWT token: %w", err)
 	}
@@ -158,27 +325,83 @@ func (u UseCase) RefreshToken(ctx context.Context, userID uint64) (auth.JWTToken
 	return token, nil
 }
 
-func (u UseCase) generateJWT(user models.User) (auth.JWTToken, error) {
-	at, err := generateToken(user, u.authCfg.JWTExpDuration, map[string]any{}, u.jwtKey)
+// permissions resolves the role of a user for its access token. Role changes
+// apply from the next refresh; an unknown role grants nothing.
+func (u UseCase) permissions(ctx context.Context, role string) ([]string, error) {
+	if perms, ok := rbac.Builtin(role); ok {
+		return perms, nil
+	}
+
+	r, err := u.repo.GetRole(ctx, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve permissions: %w", err)
+	}
+	return r.GetPermissions(), nil
+}
+
+func (u UseCase) parseRefreshToken(refreshToken string) (uint64, string, error) {
+	tok, err := jwt.Parse(refreshToken, u.keys.Keyfunc)
+	if err != nil || !tok.Valid {
+		return 0, "", ErrInvalidRefreshToken
+	}
+
+	claims, ok := tok.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != "refresh" {
+		return 0, "", ErrInvalidRefreshToken
+	}
+
+	sub, ok := claims["sub"].(float64)
+	if !ok {
+		return 0, "", ErrInvalidRefreshToken
+	}
+
+	familyID, ok := claims["sid"].(string)
+	if !ok || familyID == "" {
+		return 0, "", ErrInvalidRefreshToken
+	}
+
+	return uint64(sub), familyID, nil
+}
+
+// generateJWT issues a new token set for the given refresh token family and
+// records the refresh token so that it can be rotated exactly once.
+func (u UseCase) generateJWT(ctx context.Context, user models.User, familyID string) (auth.JWTToken, error) {
+	perms, err := u.permissions(ctx, user.Role)
+	if err != nil {
+		return auth.JWTToken{}, err
+	}
+
+	at, err := u.generateToken(ctx, user, u.authCfg.JWTExpDuration, map[string]any{
+		"sid":   familyID,
+		"role":  user.Role,
+		"perms": perms,
+	})
 	if err != nil {
 		return auth.JWTToken{}, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
-	rt, err := generateToken(user, u.authCfg.RefreshExpDuration, map[string]any{
+	rt, err := u.generateToken(ctx, user, u.authCfg.RefreshExpDuration, map[string]any{
 		"typ": "refresh",
-	}, u.jwtKey)
+		"sid": familyID,
+	})
 	if err != nil {
 		return auth.JWTToken{}, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
-	id, err := generateToken(user, u.authCfg.JWTExpDuration, map[string]any{
+	id, err := u.generateToken(ctx, user, u.authCfg.JWTExpDuration, map[string]any{
+		"typ":   "id",
+		"sid":   familyID,
 		"role":  user.Role,
 		"email": user.Email,
-	}, u.jwtKey)
+	})
 	if err != nil {
 		return auth.JWTToken{}, fmt.Errorf("failed to generate ID token: %w", err)
 	}
 
+	if err := u.tokens.SaveRefresh(ctx, rt, familyID, user.ID, u.authCfg.RefreshExpDuration); err != nil {
+		return auth.JWTToken{}, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
 	return auth.JWTToken{
 		AccessToken:  at,
 		RefreshToken: rt,
@@ -186,7 +409,7 @@ func (u UseCase) generateJWT(user models.User) (auth.JWTToken, error) {
 	}, nil
 }
 
-func generateToken(user models.User, ttl time.Duration, extra map[string]any, key []byte) (string, error) {
+func (u UseCase) generateToken(ctx context.Context, user models.User, ttl time.Duration, extra map[string]any) (string, error) {
 	now := time.Now()
 	claims := jwt.MapClaims{
 		"sub":      user.ID,
@@ -194,18 +417,18 @@ func generateToken(user models.User, ttl time.Duration, extra map[string]any, ke
 		"verified": user.Verified,
 		"exp":      now.Add(ttl).Unix(),
 		"iat":      now.Unix(),
+		"iat_ms":   now.UnixMilli(),
 		"nbf":      now.Unix(),
 		"iss":      "social-app",
 		"aud":      "social-app",
-		"jti":      fmt.Sprintf("%d-%d", user.ID, now.Unix()),
+		"jti":      uuid.NewString(),
 	}
 
 	for k, v := range extra {
 		claims[k] = v
 	}
 
-	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	ts, err := tok.SignedString(key)
+	ts, err := u.keys.Sign(ctx, claims)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -213,30 +436,60 @@ func generateToken(user models.User, ttl time.Duration, extra map[string]any, ke
 	return ts, nil
 }
 
-func (u UseCase) Verify(ctx context.Context, userID uint64, code string) (auth.JWTToken, error) {
+// Verify checks the code sent on a channel. A code is only accepted on the
+// channel it was sent to, and an SMS code also verifies the phone number
+// unless another account has verified it first.
+// Users with TOTP get a need_2fa token rather than a session.
+func (u UseCase) Verify(ctx context.Context, userID uint64, channel, code string, client auth.ClientInfo) (auth.JWTToken, error) {
 	user, err := u.repo.GetProfile(ctx, fmt.Sprint(userID))
 	if err != nil {
 		return auth.JWTToken{}, fmt.Errorf("failed to get user profile: %w", err)
 	}
 
-	if user.VerifiedCode != code {
-		return auth.JWTToken{}, fmt.Errorf("invalid code")
+	if err := u.guard.Check(ctx, user.ID, client.IP); err != nil {
+		return auth.JWTToken{}, err
 	}
 
+	expected := user.VerifiedCode
+	if channel == profile.ChannelSMS {
+		expected = user.PhoneCode
+	}
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+		if err := u.codeFailed(ctx, user, channel, client.IP); err != nil {
+			return auth.JWTToken{}, err
+		}
+		return auth.JWTToken{}, ErrInvalidCode
+	}
+
+	if err := u.guard.Succeed(ctx, user.ID); err != nil {
+		return auth.JWTToken{}, err
+	}
+
+	if channel == profile.ChannelSMS {
+		// As with VerifyPhone, another account may have verified the number
+		// since the code was sent.
+		if err := u.checkPhoneFree(ctx, user.ID, user.Phone); err != nil {
+			return auth.JWTToken{}, err
+		}
+		user.PhoneCode = ""
+		user.PhoneVerified = true
+	} else {
+		user.VerifiedCode = ""
+	}
 	user.Verified = true
-	user.VerifiedCode = ""
 	user.VerifiedValidateAt = time.Now().Add(30 * 24 * time.Hour)
 
 	if err := u.repo.Update(ctx, user); err != nil {
 		return auth.JWTToken{}, fmt.Errorf("failed to update user profile: %w", err)
 	}
 
-	tk, err := u.generateJWT(user)
-	if err != nil {
-		return auth.JWTToken{}, fmt.Errorf("failed to generate JWT token: %w", err)
+	// A code only proves the channel: it stands in for the password, never
+	// for the second factor.
+	if user.TOTPEnabled {
+		return u.issueTwoFactorToken(ctx, user)
 	}
 
-	return tk, nil
+	return u.startSession(ctx, user, client)
 }
 
 func (u UseCase) SendEmailVerification(ctx context.Context, userID uint64) error {
@@ -244,10 +497,13 @@ func (u UseCase) SendEmailVerification(ctx context.Context, userID uint64) error
 	if err != nil {
 		return fmt.Errorf("failed to get user profile: %w", err)
 	}
+	if user.Email == "" {
+		return ErrNoEmail
+	}
 
-	code, err := utils.GenerateCode(6)
+	code, err := newVerificationCode()
 	if err != nil {
-		return fmt.Errorf("failed to generate verification code: %w", err)
+		return err
 	}
 	user.VerifiedCode = code
 
@@ -263,12 +519,18 @@ func (u UseCase) SendPhoneVerification(ctx context.Context, userID uint64) error
 	if err != nil {
 		return fmt.Errorf("failed to get user profile: %w", err)
 	}
+	if user.Phone == "" {
+		return ErrNoPhone
+	}
+	if err := u.guard.AllowSMS(ctx, user.ID, user.Phone); err != nil {
+		return err
+	}
 
-	code, err := utils.GenerateCode(6)
+	code, err := newVerificationCode()
 	if err != nil {
-		return fmt.Errorf("failed to generate verification code: %w", err)
+		return err
 	}
-	user.VerifiedCode = code
+	user.PhoneCode = code
 
 	if err := u.sms.SendPhoneVerification(user.Phone, code); err != nil {
 		return fmt.Errorf("failed to send phone verification: %w", err)
@@ -277,92 +539,20 @@ func (u UseCase) SendPhoneVerification(ctx context.Context, userID uint64) error
 	return u.repo.Update(ctx, user)
 }
 
-func (u UseCase) IsUserOnline(ctx context.Context, id uint64) (bool, error) {
-	exists, err := u.conn.IsUserOnline(ctx, id)
-	if err != nil {
-		return false, fmt.Errorf("failed to check if user is online: %w", err)
-	}
-	return exists, nil
-}
-
-func (u UseCase) OauthCallback(ctx context.Context, input auth.OauthInput) (auth.JWTToken, error) {
-	info, err := u.exchangeGoogleUserInfo(ctx, input.Code)
+func (u UseCase) JWKS(ctx context.Context) (token.JWKSet, error) {
+	set, err := u.keys.JWKS(ctx)
 	if err != nil {
-		return auth.JWTToken{}, err
-	}
-
-	user, err := u.getOrCreateUserFromGoogle(ctx, info)
-	if err != nil {
-		return auth.JWTToken{}, err
-	}
-
-	pendingToken, pending, err := u.maybeReturnPendingVerification(ctx, user)
-	if err != nil {
-		return auth.JWTToken{}, err
+		return token.JWKSet{}, fmt.Errorf("failed to load signing keys: %w", err)
 	}
-	if pending {
-		return pendingToken, nil
-	}
-
-	if err := u.syncUserFromGoogle(ctx, user, info); err != nil {
-		return auth.JWTToken{}, err
-	}
-
-	tk, err := u.generateJWT(user)
-	if err != nil {
-		return auth.JWTToken{}, fmt.Errorf("failed to generate JWT token: %w", err)
-	}
-
-	return tk, nil
+	return set, nil
 }
 
-func (u UseCase) OauthLogin(ctx context.Context) string {
-	return u.googleOAuthConfig.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-}
-
-func (u UseCase) exchangeGoogleUserInfo(ctx context.Context, code string) (googleUserInfo, error) {
-	token, err := u.googleOAuthConfig.Exchange(ctx, code)
-	if err != nil {
-		return googleUserInfo{}, fmt.Errorf("failed to exchange OAuth code: %w", err)
-	}
-
-	client := u.googleOAuthConfig.Client(ctx, token)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://www.googleapis.com/oauth2/v2/userinfo", http.NoBody)
-	if err != nil {
-		return googleUserInfo{}, fmt.Errorf("creating request: %w", err)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return googleUserInfo{}, fmt.Errorf("making request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	var info googleUserInfo
-	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
-		return googleUserInfo{}, fmt.Errorf("failed to decode user info: %w", err)
-	}
-	return info, nil
-}
-
-func (u UseCase) getOrCreateUserFromGoogle(ctx context.Context, info googleUserInfo) (models.User, error) {
-	user, err := u.repo.GetByEmail(ctx, info.Email)
+func (u UseCase) IsUserOnline(ctx context.Context, id uint64) (bool, error) {
+	exists, err := u.conn.IsUserOnline(ctx, id)
 	if err != nil {
-		return models.User{}, fmt.Errorf("failed to login user: %w", err)
-	}
-	if user.IsZero() {
-		user = models.User{
-			Username: info.Name,
-			Email:    info.Email,
-			Avatar:   info.Picture,
-			Role:     "user",
-		}
-		user, err = u.repo.Register(ctx, user)
-		if err != nil {
-			return models.User{}, fmt.Errorf("failed to register user: %w", err)
-		}
+		return false, fmt.Errorf("failed to check if user is online: %w", err)
 	}
-	return user, nil
+	return exists, nil
 }
 
 func (u UseCase) maybeReturnPendingVerification(ctx context.Context, user models.User) (auth.JWTToken, bool, error) {
@@ -380,12 +570,3 @@ func (u UseCase) maybeReturnPendingVerification(ctx context.Context, user models
 	}
 	return auth.JWTToken{}, false, nil
 }
-
-func (u UseCase) syncUserFromGoogle(ctx context.Context, user models.User, info googleUserInfo) error {
-	user.Username = info.Name
-	user.Avatar = info.Picture
-	if err := u.repo.Update(ctx, user); err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
-	}
-	return nil
-}
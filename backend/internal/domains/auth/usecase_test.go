@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"social-app/api/auth"
+	"social-app/api/profile"
+	"social-app/internal/config"
+	"social-app/internal/connector"
+	"social-app/internal/models"
+	"social-app/pkg/passkey"
+	"social-app/pkg/token"
+	"social-app/pkg/totp"
+	"social-app/pkg/ws"
+)
+
+var testLockout = config.Lockout{
+	MaxFailures:         5,
+	IPMaxFailures:       50,
+	CodeMaxAttempts:     5,
+	SMSDailyMax:         3,
+	WindowDuration:      15 * time.Minute,
+	LockDuration:        15 * time.Minute,
+	MaxLockDuration:     24 * time.Hour,
+	SMSCooldownDuration: time.Minute,
+}
+
+type fakeSMS struct {
+	sent []string
+}
+
+func (f *fakeSMS) SendPhoneVerification(to, code string) error {
+	f.sent = append(f.sent, to)
+	return nil
+}
+
+// newTestUseCase returns a UseCase on a miniredis and a mocked database.
+func newTestUseCase(t *testing.T) (UseCase, sqlmock.Sqlmock, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	host, port, _ := net.SplitHostPort(mr.Addr())
+	p, _ := strconv.Atoi(port)
+	rc := connector.NewRedisConnector(config.Redis{Host: host, Port: p})
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("gorm: %v", err)
+	}
+
+	cfg := config.Auth{JWTAlg: token.AlgHS256, JWTSecret: "secret", Lockout: testLockout}
+	keys, err := token.NewKeyManager(cfg, rc)
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	secrets, err := token.NewSecretSealer(cfg)
+	if err != nil {
+		t.Fatalf("NewSecretSealer: %v", err)
+	}
+
+	uc := UseCase{
+		repo:     NewRepository(connector.DBConn{DB: db}),
+		tokens:   NewTokenStore(rc),
+		guard:    NewLoginGuard(rc, cfg),
+		denylist: token.NewDenylist(rc),
+		keys:     keys,
+		secrets:  secrets,
+		conn:     ws.NewConnector(rc),
+		sms:      &fakeSMS{},
+		authCfg:  cfg,
+	}
+	return uc, mock, mr
+}
+
+func TestVerifyRequiresSecondFactor(t *testing.T) {
+	for _, channel := range []string{profile.ChannelEmail, profile.ChannelSMS} {
+		t.Run(channel, func(t *testing.T) {
+			uc, mock, _ := newTestUseCase(t)
+
+			rows := sqlmock.NewRows([]string{"id", "username", "verified_code", "phone_code", "phone", "totp_enabled", "totp_secret"}).
+				AddRow(7, "alice", "123456", "123456", "+33600000000", true, "SECRET")
+			mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(rows)
+			if channel == profile.ChannelSMS {
+				mock.ExpectQuery(`SELECT \* FROM "users" WHERE \(phone`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			}
+			mock.ExpectExec(`UPDATE "users"`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			jwt, err := uc.Verify(context.Background(), 7, channel, "123456", auth.ClientInfo{IP: "1.2.3.4"})
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if jwt.AccessToken != "" || jwt.RefreshToken != "" {
+				t.Error("Expected no session for a user with TOTP")
+			}
+			if jwt.TwoFactorToken == "" {
+				t.Error("Expected a need_2fa token")
+			}
+		})
+	}
+}
+
+func TestVerifyWrongCode(t *testing.T) {
+	uc, mock, _ := newTestUseCase(t)
+
+	rows := sqlmock.NewRows([]string{"id", "username", "verified_code"}).AddRow(7, "alice", "123456")
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(rows)
+
+	_, err := uc.Verify(context.Background(), 7, profile.ChannelEmail, "654321", auth.ClientInfo{IP: "1.2.3.4"})
+	if !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("Expected ErrInvalidCode, got %v", err)
+	}
+}
+
+func TestVerifySMSPhoneTaken(t *testing.T) {
+	uc, mock, _ := newTestUseCase(t)
+
+	rows := sqlmock.NewRows([]string{"id", "username", "phone_code", "phone"}).AddRow(7, "alice", "123456", "+33600000000")
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(rows)
+	owner := sqlmock.NewRows([]string{"id", "username", "phone", "phone_verified"}).AddRow(8, "bob", "+33600000000", true)
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE \(phone`).WillReturnRows(owner)
+
+	_, err := uc.Verify(context.Background(), 7, profile.ChannelSMS, "123456", auth.ClientInfo{IP: "1.2.3.4"})
+	if !errors.Is(err, ErrPhoneTaken) {
+		t.Fatalf("Expected ErrPhoneTaken, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDisableTOTPIsRateLimited(t *testing.T) {
+	uc, mock, _ := newTestUseCase(t)
+	ctx := context.Background()
+	client := auth.ClientInfo{IP: "1.2.3.4"}
+	input := auth.DisableTOTPInput{Code: "abcde-fghjk"}
+
+	user := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "username", "totp_enabled", "totp_secret"}).AddRow(7, "alice", true, "SECRET")
+	}
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(user())
+	mock.ExpectExec(`UPDATE "recovery_codes"`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := uc.DisableTOTP(ctx, 7, input, client); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("Expected ErrInvalidTwoFactorCode, got %v", err)
+	}
+
+	// The failure delays the next attempt, before any code is checked.
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(user())
+	if err := uc.DisableTOTP(ctx, 7, input, client); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("Expected ErrTooManyAttempts, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDisableTOTPNeedsPassword(t *testing.T) {
+	uc, mock, _ := newTestUseCase(t)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	rows := sqlmock.NewRows([]string{"id", "username", "password", "totp_enabled", "totp_secret"}).AddRow(7, "alice", string(hash), true, "SECRET")
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(rows)
+
+	err := uc.DisableTOTP(context.Background(), 7, auth.DisableTOTPInput{Code: "123456", Password: "wrong"}, auth.ClientInfo{IP: "1.2.3.4"})
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+	}
+}
+
+func TestSendPhoneVerificationIsLimited(t *testing.T) {
+	uc, mock, mr := newTestUseCase(t)
+	ctx := context.Background()
+
+	send := func(allowed bool) error {
+		rows := sqlmock.NewRows([]string{"id", "username", "phone"}).AddRow(7, "alice", "+33600000000")
+		mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(rows)
+		if allowed {
+			mock.ExpectExec(`UPDATE "users"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		return uc.SendPhoneVerification(ctx, 7)
+	}
+
+	// A failed attempt at the previous code is not forgotten by a resend.
+	if err := mr.Set(codeFailKey(7, phoneCodeKind), "3"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	for i := 0; i < int(testLockout.SMSDailyMax); i++ {
+		if i > 0 {
+			if err := send(false); !errors.Is(err, ErrTooManyAttempts) {
+				t.Fatalf("Expected a resend within the cooldown to be refused, got %v", err)
+			}
+			mr.FastForward(testLockout.SMSCooldownDuration)
+		}
+		if err := send(true); err != nil {
+			t.Fatalf("SendPhoneVerification %d failed: %v", i, err)
+		}
+	}
+
+	mr.FastForward(testLockout.SMSCooldownDuration)
+	err := send(false)
+	var attempts *AttemptsError
+	if !errors.As(err, &attempts) || attempts.RetryAfter < 23*time.Hour {
+		t.Fatalf("Expected the daily cap to refuse the code for about a day, got %v", err)
+	}
+	if sent := len(uc.sms.(*fakeSMS).sent); sent != int(testLockout.SMSDailyMax) {
+		t.Errorf("Expected %d SMS, got %d", testLockout.SMSDailyMax, sent)
+	}
+	if n, _ := mr.Get(codeFailKey(7, phoneCodeKind)); n != "3" {
+		t.Errorf("Expected the failed attempts to be kept, got %q", n)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAllowSMSPerNumber(t *testing.T) {
+	uc, _, _ := newTestUseCase(t)
+	ctx := context.Background()
+
+	if err := uc.guard.AllowSMS(ctx, 7, "+33600000000"); err != nil {
+		t.Fatalf("AllowSMS failed: %v", err)
+	}
+	if err := uc.guard.AllowSMS(ctx, 8, "+33600000000"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("Expected another account to wait for the same number, got %v", err)
+	}
+	if err := uc.guard.AllowSMS(ctx, 9, "+33611111111"); err != nil {
+		t.Errorf("Expected another number to get its code, got %v", err)
+	}
+}
+
+func TestFinishPasskeyLoginCountsFailures(t *testing.T) {
+	uc, _, mr := newTestUseCase(t)
+	ctx := context.Background()
+	client := auth.ClientInfo{IP: "1.2.3.4"}
+
+	rp, err := passkey.NewRelyingParty(config.Auth{WebAuthn: config.WebAuthn{RPID: "localhost", RPDisplayName: "Social App", RPOriginsRaw: "http://localhost:5173"}})
+	if err != nil {
+		t.Fatalf("NewRelyingParty failed: %v", err)
+	}
+	uc.passkeys = rp
+
+	options, err := uc.BeginPasskeyLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginPasskeyLogin failed: %v", err)
+	}
+	input := auth.PasskeyFinishInput{CeremonyID: options.CeremonyID, Credential: []byte(`{}`)}
+	if _, err := uc.FinishPasskeyLogin(ctx, input, client); !errors.Is(err, ErrInvalidPasskey) {
+		t.Fatalf("Expected ErrInvalidPasskey, got %v", err)
+	}
+	if n, _ := mr.Get(ipFailKeyPrefix + client.IP); n != "1" {
+		t.Errorf("Expected the failure to be counted for the IP, got %q", n)
+	}
+
+	// A locked out IP is refused before any ceremony is read.
+	if err := mr.Set(ipLockKeyPrefix+client.IP, "locked"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	mr.SetTTL(ipLockKeyPrefix+client.IP, time.Minute)
+	if _, err := uc.FinishPasskeyLogin(ctx, input, client); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("Expected ErrTooManyAttempts, got %v", err)
+	}
+}
+
+// capture is an sqlmock argument that matches anything and keeps the
+// strings it saw.
+type capture struct {
+	values *[]string
+}
+
+func (c capture) Match(v driver.Value) bool {
+	if s, ok := v.(string); ok {
+		*c.values = append(*c.values, s)
+	}
+	return true
+}
+
+func TestSetupTOTPSealsSecret(t *testing.T) {
+	uc, mock, _ := newTestUseCase(t)
+	ctx := context.Background()
+
+	var stored []string
+	rows := sqlmock.NewRows([]string{"id", "username", "totp_enabled"}).AddRow(7, "alice", false)
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(rows)
+	mock.ExpectExec(`UPDATE "users"`).
+		WithArgs(capture{&stored}, capture{&stored}, capture{&stored}, capture{&stored}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	setup, err := uc.SetupTOTP(ctx, 7)
+	if err != nil {
+		t.Fatalf("SetupTOTP failed: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || strings.Contains(stored[0], setup.Secret) {
+		t.Fatalf("Expected the secret to be stored sealed, got %v", stored)
+	}
+
+	code, err := totp.Code(setup.Secret, time.Now())
+	if err != nil {
+		t.Fatalf("Code failed: %v", err)
+	}
+	if err := uc.checkTOTP(ctx, models.User{ID: 8, TOTPSecret: stored[0]}, code); err == nil {
+		t.Error("Expected the sealed secret not to open for another user")
+	}
+	if err := uc.checkTOTP(ctx, models.User{ID: 7, TOTPSecret: stored[0]}, code); err != nil {
+		t.Errorf("Expected the code to match the sealed secret, got %v", err)
+	}
+}
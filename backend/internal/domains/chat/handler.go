@@ -2,7 +2,7 @@ package chat
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -26,23 +26,50 @@ func NewHandler(uc UseCase, n notif.UseCase) Handler {
 	}
 }
 
+// CreatMessage godoc
+// @Summary      Send a message
+// @Description  Store a message and deliver it to the receiver. Retrying with the same idempotency key (or Idempotency-Key header) returns the stored message; reusing a key for another message is a conflict.
+// @Tags         chat
+// @Accept       json
+// @Produce      json
+// @Param        input           body   chat.CreateMessageInput true  "Message"
+// @Param        Idempotency-Key header string                  false "Key identifying this send"
+// @Success      200 {object} models.Message
+// @Failure      400 {object} map[string]string
+// @Failure      409 {object} map[string]string
+// @Failure      500 {object} map[string]string
+// @Router       /messages [post]
+// @Security     BearerAuth
 func (h Handler) CreatMessage(c *middleware.Context) {
-	msg := chat.CreateMessageInput{UserID: c.User.ID}
-	if err := c.BindJSON(&msg); err != nil {
+	var msg chat.CreateMessageInput
+	if err := c.ShouldBindJSON(&msg); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message binding"})
 		return
 	}
+	msg.UserID = c.User.ID
+	if msg.IdempotencyKey == "" {
+		msg.IdempotencyKey = c.Request.Header.Get("Idempotency-Key")
+	}
+	if len(msg.IdempotencyKey) > 64 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency key is too long"})
+		return
+	}
 
 	newMsg, err := h.usecase.CreateMessage(c.Request.Context(), msg)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create message"})
+		switch {
+		case errors.Is(err, ErrEmptyMessage):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Message is empty"})
+		case errors.Is(err, ErrInvalidReceiver):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid receiver"})
+		case errors.Is(err, ErrKeyConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": "Idempotency key already used for another message"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create message"})
+		}
 		return
 	}
 
-	if err := h.notifyNewMessage(c.Request.Context(), newMsg, msg.ReceiverID); err != nil {
-		fmt.Println("Error notifying new message:", err)
-	}
-
 	c.JSON(http.StatusOK, newMsg)
 }
 
@@ -150,25 +177,3 @@ func (h Handler) notifySeenMessage(ctx context.Context, userID, receiverID uint6
 
 	return nil
 }
-
-func (h Handler) notifyNewMessage(ctx context.Context, newMsg models.Message, userID uint64) error {
-	pl, err := json.Marshal(newMsg)
-	if err != nil {
-		return fmt.Errorf("error marshalling message payload: %w", err)
-	}
-	notification := models.Notification{
-		UserID:     newMsg.ReceiverID,
-		Type:       models.NotificationTypeMessage,
-		Content:    newMsg.Content,
-		Link:       fmt.Sprintf("/chat/%d", userID),
-		Payload:    string(pl),
-		TypeID:     newMsg.ID,
-		ReceiverID: newMsg.ReceiverID,
-	}
-
-	if err = h.notif.SendNotification(ctx, notification); err != nil {
-		return fmt.Errorf("error sending notification: %w", err)
-	}
-
-	return nil
-}
@@ -2,8 +2,11 @@ package chat
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"social-app/internal/connector"
 	"social-app/internal/models"
 	"social-app/pkg/pagination"
@@ -13,6 +16,7 @@ const limit = 10
 
 type ChatRepository interface {
 	CreateMessage(ctx context.Context, msg models.Message) (models.Message, error)
+	GetMessageByKey(ctx context.Context, senderID uint64, key string) (models.Message, error)
 	GetChatList(ctx context.Context, senderID uint64) ([]models.Message, error)
 	GetMessages(ctx context.Context, cursor string, userID, otherID uint64) (models.MessageList, error)
 	MarkMessagesAsRead(ctx context.Context, userID, otherID uint64) (int64, error)
@@ -28,15 +32,43 @@ func NewRepository(con connector.DBConn) Repository {
 	}
 }
 
+// CreateMessage stores the message. When the sender already used its
+// idempotency key, nothing is written and the message stored first is
+// returned instead.
 func (r Repository) CreateMessage(ctx context.Context, c models.Message) (models.Message, error) {
-	r.conn.DB.Create(&c)
-	if r.conn.DB.Error != nil {
-		return models.Message{}, fmt.Errorf("error creating message: %w", r.conn.DB.Error)
+	if c.IdempotencyKey == nil {
+		if err := r.conn.DB.Create(&c).Error; err != nil {
+			return models.Message{}, fmt.Errorf("error creating message: %w", err)
+		}
+		return c, nil
+	}
+
+	result := r.conn.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sender_id"}, {Name: "idempotency_key"}},
+		DoNothing: true,
+	}).Create(&c)
+	if result.Error != nil {
+		return models.Message{}, fmt.Errorf("error creating message: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return r.GetMessageByKey(ctx, c.SenderID, *c.IdempotencyKey)
 	}
 
 	return c, nil
 }
 
+// GetMessageByKey returns a zero Message when the sender never used the key.
+func (r Repository) GetMessageByKey(ctx context.Context, senderID uint64, key string) (models.Message, error) {
+	var m models.Message
+	if err := r.conn.DB.Where("sender_id = ? AND idempotency_key = ?", senderID, key).First(&m).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Message{}, nil
+		}
+		return models.Message{}, fmt.Errorf("error getting message: %w", err)
+	}
+	return m, nil
+}
+
 func (r Repository) GetChatList(ctx context.Context, userID uint64) ([]models.Message, error) {
 	var messages []models.Message
 
@@ -2,23 +2,51 @@ package chat
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 
 	"social-app/api/chat"
+	notif "social-app/internal/domains/notification"
 	"social-app/internal/models"
+	"social-app/pkg/ws"
+)
+
+var (
+	ErrEmptyMessage    = errors.New("message is empty")
+	ErrInvalidReceiver = errors.New("invalid receiver")
+	ErrKeyConflict     = errors.New("idempotency key already used for another message")
 )
 
 type UseCase struct {
-	repo Repository
+	bc    ws.Broadcaster
+	repo  Repository
+	notif notif.UseCase
 }
 
-func NewUseCase(r Repository) UseCase {
+func NewUseCase(r Repository, n notif.UseCase, bc ws.Broadcaster) UseCase {
 	return UseCase{
-		repo: r,
+		repo:  r,
+		notif: n,
+		bc:    bc,
 	}
 }
 
+// CreateMessage stores the message and delivers it to the receiver. When the
+// sender already used the idempotency key, the stored message is returned
+// and not delivered again, so retries after a reconnect are harmless; a key
+// reused for another receiver or content is refused with ErrKeyConflict. The
+// message is also published to the conversation topic.
 func (u UseCase) CreateMessage(ctx context.Context, msg chat.CreateMessageInput) (models.Message, error) {
+	if strings.TrimSpace(msg.Content) == "" {
+		return models.Message{}, ErrEmptyMessage
+	}
+	if msg.ReceiverID == 0 || msg.ReceiverID == msg.UserID {
+		return models.Message{}, ErrInvalidReceiver
+	}
+
 	newMsg := models.Message{
 		UserID:     msg.UserID,
 		SenderID:   msg.UserID,
@@ -26,14 +54,65 @@ func (u UseCase) CreateMessage(ctx context.Context, msg chat.CreateMessageInput)
 		Content:    msg.Content,
 	}
 
+	if msg.IdempotencyKey != "" {
+		existing, err := u.repo.GetMessageByKey(ctx, msg.UserID, msg.IdempotencyKey)
+		if err != nil {
+			return models.Message{}, fmt.Errorf("failed to create message: %w", err)
+		}
+		if existing.ID != 0 {
+			return replayed(existing, newMsg)
+		}
+		newMsg.IdempotencyKey = &msg.IdempotencyKey
+	}
+
 	m, err := u.repo.CreateMessage(ctx, newMsg)
 	if err != nil {
 		return models.Message{}, fmt.Errorf("failed to create message: %w", err)
 	}
+	if _, err := replayed(m, newMsg); err != nil {
+		// A concurrent send stored another message under the key first.
+		return models.Message{}, err
+	}
+
+	if err := u.notifyNewMessage(ctx, m); err != nil {
+		log.Printf("[Chat] Failed to deliver message %d to user %d: %v", m.ID, m.ReceiverID, err)
+	}
+	u.bc.Publish(ws.ChatTopic(m.SenderID, m.ReceiverID), ws.EventMessageCreated, m)
 
 	return m, nil
 }
 
+// replayed returns the message stored under an idempotency key when the
+// retry is for the same message.
+func replayed(stored, retry models.Message) (models.Message, error) {
+	if stored.ReceiverID != retry.ReceiverID || stored.Content != retry.Content {
+		return models.Message{}, ErrKeyConflict
+	}
+	return stored, nil
+}
+
+func (u UseCase) notifyNewMessage(ctx context.Context, newMsg models.Message) error {
+	pl, err := json.Marshal(newMsg)
+	if err != nil {
+		return fmt.Errorf("error marshalling message payload: %w", err)
+	}
+	notification := models.Notification{
+		UserID:     newMsg.ReceiverID,
+		Type:       models.NotificationTypeMessage,
+		Content:    newMsg.Content,
+		Link:       fmt.Sprintf("/chat/%d", newMsg.SenderID),
+		Payload:    string(pl),
+		TypeID:     newMsg.ID,
+		ReceiverID: newMsg.ReceiverID,
+	}
+
+	if err = u.notif.SendNotification(ctx, notification); err != nil {
+		return fmt.Errorf("error sending notification: %w", err)
+	}
+
+	return nil
+}
+
 func (u UseCase) GetChatList(ctx context.Context, userID uint64) ([]models.Message, error) {
 	m, err := u.repo.GetChatList(ctx, userID)
 	if err != nil {
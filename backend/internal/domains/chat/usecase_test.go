@@ -0,0 +1,85 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"social-app/api/chat"
+	"social-app/internal/connector"
+	"social-app/pkg/ws"
+)
+
+// newTestUseCase returns a UseCase on a mocked database.
+func newTestUseCase(t *testing.T) (UseCase, sqlmock.Sqlmock) {
+	t.Helper()
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("gorm: %v", err)
+	}
+
+	return UseCase{repo: NewRepository(connector.DBConn{DB: db})}, mock
+}
+
+func TestCreateMessageReusedKey(t *testing.T) {
+	input := chat.CreateMessageInput{UserID: 1, ReceiverID: 2, Content: "hi", IdempotencyKey: "key"}
+
+	tests := []struct {
+		name    string
+		change  func(*chat.CreateMessageInput)
+		wantErr error
+	}{
+		{"same message", func(*chat.CreateMessageInput) {}, nil},
+		{"other content", func(in *chat.CreateMessageInput) { in.Content = "bye" }, ErrKeyConflict},
+		{"other receiver", func(in *chat.CreateMessageInput) { in.ReceiverID = 3 }, ErrKeyConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, mock := newTestUseCase(t)
+
+			rows := sqlmock.NewRows([]string{"id", "sender_id", "receiver_id", "content", "idempotency_key"}).
+				AddRow(9, 1, 2, "hi", "key")
+			mock.ExpectQuery(`SELECT \* FROM "messages"`).WillReturnRows(rows)
+
+			retry := input
+			tt.change(&retry)
+			m, err := uc.CreateMessage(context.Background(), retry)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && m.ID != 9 {
+				t.Errorf("Expected the stored message, got %+v", m)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSendChatMessageReusedKey(t *testing.T) {
+	uc, mock := newTestUseCase(t)
+
+	rows := sqlmock.NewRows([]string{"id", "sender_id", "receiver_id", "content", "idempotency_key"}).
+		AddRow(9, 1, 2, "hi", "frame-1")
+	mock.ExpectQuery(`SELECT \* FROM "messages"`).WillReturnRows(rows)
+
+	_, err := uc.SendChatMessage(context.Background(), 1, ws.ChatMessage{ReceiverID: 2, Content: "bye", IdempotencyKey: "frame-1"})
+	if !errors.Is(err, ws.ErrInvalidMessage) || !errors.Is(err, ErrKeyConflict) {
+		t.Errorf("Expected an invalid message conflict, got %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"social-app/api/chat"
+	"social-app/pkg/ws"
+)
+
+// SendChatMessage implements ws.ChatSender for message frames.
+func (u UseCase) SendChatMessage(ctx context.Context, senderID uint64, msg ws.ChatMessage) (uint64, error) {
+	m, err := u.CreateMessage(ctx, chat.CreateMessageInput{
+		Content:        msg.Content,
+		IdempotencyKey: msg.IdempotencyKey,
+		ReceiverID:     msg.ReceiverID,
+		UserID:         senderID,
+	})
+	if err != nil {
+		if errors.Is(err, ErrEmptyMessage) || errors.Is(err, ErrInvalidReceiver) || errors.Is(err, ErrKeyConflict) {
+			return 0, fmt.Errorf("%w: %w", ws.ErrInvalidMessage, err)
+		}
+		return 0, err
+	}
+	return m.ID, nil
+}
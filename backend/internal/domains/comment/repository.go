@@ -34,11 +34,14 @@ func (r Repository) CreateComment(ctx context.Context, cm models.Comment) (model
 	}
 
 	if result := r.conn.DB.
-		Preload("User").
 		Create(&cm); result.Error != nil {
 		return cm, result.Error
 	}
 
+	if err := r.conn.DB.First(&cm.User, cm.UserID).Error; err != nil {
+		return models.Comment{}, fmt.Errorf("failed to load author of comment %d: %w", cm.ID, err)
+	}
+
 	return cm, nil
 }
 
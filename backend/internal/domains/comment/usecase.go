@@ -35,7 +35,7 @@ func (u UseCase) CreateComment(ctx context.Context, c comment.CreateCommentInput
 		return models.Comment{}, fmt.Errorf("error creating comment: %w", err)
 	}
 
-	u.bc.NotifyAll("New comment added!")
+	u.bc.Publish(ws.PostTopic(result.PostID), ws.EventCommentCreated, result)
 
 	return result, nil
 }
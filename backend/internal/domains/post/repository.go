@@ -32,6 +32,10 @@ func (r Repository) CreatePost(ctx context.Context, post models.Post) (models.Po
 		return models.Post{}, result.Error
 	}
 
+	if err := r.conn.DB.First(&post.User, post.UserID).Error; err != nil {
+		return models.Post{}, fmt.Errorf("failed to load author of post %d: %w", post.ID, err)
+	}
+
 	return post, nil
 }
 
@@ -3,6 +3,7 @@ package post
 import (
 	"context"
 	"fmt"
+	"log"
 
 	"github.com/akrennmair/slice"
 	"github.com/google/uuid"
@@ -60,7 +61,14 @@ func (u UseCase) CreatePost(ctx context.Context, input post.CreatePostInput) (mo
 		}
 	})
 
-	u.bc.NotifyAll("{\"type\": \"post_created\", \"data\": \"new post\"}")
+	// The post is stored: a missing avatar only leaves it out of the event.
+	if avatar, err := u.getAvatar(ctx, result.User); err != nil {
+		log.Printf("[Post] Failed to fetch avatar of user %d: %v", result.UserID, err)
+	} else {
+		result.User.AvatarMedia = avatar
+	}
+
+	u.bc.Publish(ws.UserTopic(result.UserID), ws.EventPostCreated, result)
 	return result, nil
 }
 
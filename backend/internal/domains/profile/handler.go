@@ -56,7 +56,7 @@ func (h Handler) GetProfile(c *middleware.Context) {
 
 // UpdateProfile godoc
 // @Summary      Update user's profile
-// @Description  Partially updates bio, avatar or email
+// @Description  Partially updates bio or avatar. The email is changed through /email/change.
 // @Tags         users
 // @Accept       json
 // @Produce      json
@@ -87,8 +87,11 @@ func (h Handler) UpdateProfile(c *middleware.Context) {
 	if input.Avatar != nil {
 		user.Avatar = *input.Avatar
 	}
-	if input.Email != nil {
-		user.Email = *input.Email
+	// The email is changed through POST /email/change so that the new
+	// address is confirmed and the old one can cancel.
+	if input.Email != nil && *input.Email != user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use POST /email/change to change your email"})
+		return
 	}
 
 	updatedUser, err := h.usecase.UpdateUser(c.Request.Context(), user)
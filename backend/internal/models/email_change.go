@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// EmailChange is a request to move an account to a new email address. It is
+// applied once the code sent to the new address is confirmed, and the old
+// address can cancel it until CancelableUntil.
+type EmailChange struct {
+	ExpiresAt       time.Time  `json:"expires_at"`
+	CancelableUntil time.Time  `json:"cancelable_until"`
+	ConfirmedAt     *time.Time `json:"confirmed_at"`
+	CanceledAt      *time.Time `json:"canceled_at"`
+	OldEmail        string     `gorm:"size:255"            json:"-"`
+	NewEmail        string     `gorm:"size:255"            json:"new_email"`
+	CodeHash        string     `gorm:"size:64"             json:"-"`
+	CancelTokenHash string     `gorm:"size:64;uniqueIndex" json:"-"`
+	Model
+	UserID uint64 `gorm:"index" json:"user_id"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Identity links an account at a login provider (google, github...) to a
+// user. A provider account can only belong to one user.
+type Identity struct {
+	LastLoginAt *time.Time `json:"last_login_at"`
+	Provider    string     `gorm:"size:64;uniqueIndex:idx_identity_provider_subject"  json:"provider"`
+	Subject     string     `gorm:"size:255;uniqueIndex:idx_identity_provider_subject" json:"-"`
+	Email       string     `gorm:"size:255"                                           json:"email"`
+	Model
+	UserID uint64 `gorm:"index" json:"user_id"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Invite lets up to MaxUses people sign up while registration is invite-only.
+// Users who signed up with it point back to its creator through InvitedByID.
+type Invite struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+	Code      string     `gorm:"size:32;uniqueIndex" json:"code"`
+	Note      string     `gorm:"size:255"            json:"note"`
+	Model
+	CreatedByID uint64 `gorm:"index" json:"created_by_id"`
+	MaxUses     int    `json:"max_uses"`
+	Uses        int    `json:"uses"`
+}
+
+// Usable reports whether the invite can still sign someone up.
+func (i Invite) Usable(now time.Time) bool {
+	return i.Uses < i.MaxUses && (i.ExpiresAt == nil || i.ExpiresAt.After(now))
+}
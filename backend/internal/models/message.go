@@ -2,12 +2,15 @@ package models
 
 import "time"
 
+// Message is a chat message. IdempotencyKey is chosen by the sender so a
+// retried send finds the message already stored instead of adding another.
 type Message struct {
-	Content string `json:"content"`
+	IdempotencyKey *string `gorm:"size:64;uniqueIndex:idx_messages_sender_key" json:"idempotency_key,omitempty"`
+	Content        string  `json:"content"`
 	Model
 	User       User   `json:"user"`
-	UserID     uint64 `gorm:"index"       json:"user_id"`
-	SenderID   uint64 `json:"sender_id"`
+	UserID     uint64 `gorm:"index"                                json:"user_id"`
+	SenderID   uint64 `gorm:"uniqueIndex:idx_messages_sender_key" json:"sender_id"`
 	ReceiverID uint64 `json:"receiver_id"`
 	Read       bool   `json:"read"`
 }
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// PersonalAccessToken lets scripts and bots call the API on behalf of a user
+// with a subset of their permissions. Only a hash of the token is stored.
+type PersonalAccessToken struct {
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Name       string     `gorm:"size:100"            json:"name"`
+	Prefix     string     `gorm:"size:16"             json:"prefix"`
+	TokenHash  string     `gorm:"size:64;uniqueIndex" json:"-"`
+	ScopesRaw  string     `gorm:"column:scopes"       json:"-"`
+	LastUsedIP string     `gorm:"size:64"             json:"last_used_ip"`
+	Model
+	UserID uint64 `gorm:"index" json:"user_id"`
+}
+
+func (t PersonalAccessToken) GetScopes() []string {
+	return strings.Fields(t.ScopesRaw)
+}
+
+func (t *PersonalAccessToken) SetScopes(scopes []string) {
+	t.ScopesRaw = strings.Join(scopes, " ")
+}
+
+func (t PersonalAccessToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !t.ExpiresAt.After(now)
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type RecoveryCode struct {
+	UsedAt *time.Time `json:"-"`
+	Hash   string     `gorm:"size:64;index" json:"-"`
+	Model
+	UserID uint64 `gorm:"index" json:"user_id"`
+}
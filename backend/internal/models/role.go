@@ -0,0 +1,20 @@
+package models
+
+import "strings"
+
+// Role is a custom role created by an admin. The user, moderator and admin
+// roles are built in and not stored.
+type Role struct {
+	Name           string `gorm:"size:64;uniqueIndex" json:"name"`
+	Description    string `gorm:"size:255"           json:"description"`
+	PermissionsRaw string `gorm:"column:permissions" json:"-"`
+	Model
+}
+
+func (r Role) GetPermissions() []string {
+	return strings.Fields(r.PermissionsRaw)
+}
+
+func (r *Role) SetPermissions(perms []string) {
+	r.PermissionsRaw = strings.Join(perms, " ")
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type Session struct {
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `gorm:"index"        json:"-"`
+	Device     string     `gorm:"size:100"     json:"device"`
+	UserAgent  string     `gorm:"size:512"     json:"user_agent"`
+	IP         string     `gorm:"size:64"      json:"ip"`
+	Model
+	UserID  uint64 `gorm:"index" json:"user_id"`
+	Current bool   `gorm:"-"     json:"current"`
+}
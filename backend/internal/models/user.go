@@ -11,15 +11,20 @@ type User struct {
 	Email              string      `gorm:"null"          json:"-"`
 	Phone              string      `gorm:"null"          json:"-"`
 	VerifiedCode       string      `gorm:"null"          json:"-"`
+	PhoneCode          string      `gorm:"null"          json:"-"`
 	Avatar             string      `json:"avatar"`
 	Password           string      `json:"-"`
 	Bio                string      `json:"bio"`
 	SignupType         string      `gorm:"default:email" json:"signup_type"`
+	TOTPSecret         string      `gorm:"null"          json:"-"`
 	AvatarMedia        AvatarMedia `gorm:"-"             json:"avatar_media,omitempty"`
+	InvitedByID        *uint64     `gorm:"index"         json:"invited_by_id,omitempty"`
 	Model
-	ID       uint64 `gorm:"primaryKey"    json:"id"`
-	Verified bool   `gorm:"default:false" json:"verified"`
-	Active   bool   `gorm:"default:true"  json:"active"`
+	ID            uint64 `gorm:"primaryKey"    json:"id"`
+	Verified      bool   `gorm:"default:false" json:"verified"`
+	Active        bool   `gorm:"default:true"  json:"active"`
+	TOTPEnabled   bool   `gorm:"default:false" json:"-"`
+	PhoneVerified bool   `gorm:"default:false" json:"-"`
 }
 
 func (u User) IsZero() bool {
@@ -33,3 +38,13 @@ type AvatarMedia struct {
 	FileExt  string `json:"file_ext"`
 	FileSize uint64 `json:"file_size"`
 }
+
+func (u User) GetCursorFields() (createdAt time.Time, id uint64) {
+	return u.CreatedAt, u.ID
+}
+
+type UserList struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	Users      []User `json:"users"`
+	HasMore    bool   `json:"has_more"`
+}
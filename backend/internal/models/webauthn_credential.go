@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type WebAuthnCredential struct {
+	LastUsedAt      *time.Time `json:"last_used_at"`
+	Name            string     `gorm:"size:100"    json:"name"`
+	AttestationType string     `gorm:"size:32"     json:"-"`
+	Transports      string     `gorm:"size:128"    json:"-"`
+	CredentialID    []byte     `gorm:"uniqueIndex" json:"-"`
+	PublicKey       []byte     `json:"-"`
+	AAGUID          []byte     `json:"-"`
+	Model
+	UserID         uint64 `gorm:"index" json:"user_id"`
+	SignCount      uint32 `json:"-"`
+	BackupEligible bool   `json:"backup_eligible"`
+	BackupState    bool   `json:"backup_state"`
+}
@@ -4,7 +4,8 @@ import (
 	"github.com/gin-gonic/gin"
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
-	"social-app/internal/config"
+	"social-app/internal/domains/account"
+	"social-app/internal/domains/admin"
 	"social-app/internal/domains/auth"
 	"social-app/internal/domains/chat"
 	"social-app/internal/domains/comment"
@@ -14,8 +15,9 @@ import (
 	"social-app/internal/domains/notification"
 	"social-app/internal/domains/post"
 	"social-app/internal/domains/profile"
-	"social-app/internal/models"
 	"social-app/pkg/middleware"
+	"social-app/pkg/rbac"
+	"social-app/pkg/token"
 	"social-app/pkg/ws"
 )
 
@@ -30,7 +32,11 @@ type Router struct {
 	wsHandler           ws.Handler
 	llmHandler          llm.Handler
 	authHandler         auth.Handler
-	cfg                 config.Auth
+	adminHandler        admin.Handler
+	accountHandler      account.Handler
+	keys                *token.KeyManager
+	denylist            *token.Denylist
+	pats                middleware.PATResolver
 }
 
 func NewRouter(
@@ -41,8 +47,12 @@ func NewRouter(
 	lh like.Handler,
 	nh notification.Handler,
 	ah auth.Handler,
+	adh admin.Handler,
+	ach account.Handler,
 	mh media.Handler,
-	cfg config.Auth,
+	km *token.KeyManager,
+	dl *token.Denylist,
+	pats middleware.PATResolver,
 	wsh ws.Handler,
 	lmh llm.Handler,
 ) Router {
@@ -54,10 +64,14 @@ func NewRouter(
 		likeHandler:         lh,
 		notificationHandler: nh,
 		authHandler:         ah,
+		adminHandler:        adh,
+		accountHandler:      ach,
 		mediaHandler:        mh,
 		wsHandler:           wsh,
 		llmHandler:          lmh,
-		cfg:                 cfg,
+		keys:                km,
+		denylist:            dl,
+		pats:                pats,
 	}
 }
 
@@ -68,7 +82,7 @@ func (rt Router) SetupRoutes(r *gin.Engine) {
 	rt.publicRoutes(pub)
 
 	authorized := pub.Group("/")
-	authorized.Use(middleware.Auth(rt.cfg))
+	authorized.Use(middleware.Auth(rt.keys, rt.denylist, rt.pats))
 	rt.profileRoutes(authorized)
 	rt.mediaRoutes(authorized)
 	rt.authRoutes(authorized)
@@ -76,37 +90,58 @@ func (rt Router) SetupRoutes(r *gin.Engine) {
 	rt.chatRoutes(authorized)
 	rt.notifRoutes(authorized)
 	rt.wsRoutes(authorized)
+	rt.adminRoutes(authorized)
 }
 
 func (rt Router) wsRoutes(authorized *gin.RouterGroup) gin.IRoutes {
+	authorized.GET("/events", middleware.Verified(rt.wsHandler.Events))
 	return authorized.GET("/ws", middleware.Verified(rt.wsHandler.HandleWebSocket))
 }
 
 func (rt Router) mediaRoutes(authorized *gin.RouterGroup) gin.IRoutes {
-	return authorized.POST("/upload", middleware.Verified(rt.mediaHandler.UploadImage))
+	return authorized.POST("/upload", middleware.Scoped(rt.mediaHandler.UploadImage, rbac.MediaWrite))
 }
 
 func (rt Router) profileRoutes(authorized *gin.RouterGroup) {
-	authorized.GET("/users/:id", middleware.Verified(rt.profileHandler.GetProfile))
-	authorized.PATCH("/users/:id", middleware.Verified(rt.profileHandler.UpdateProfile))
+	authorized.GET("/users/:id", middleware.Scoped(rt.profileHandler.GetProfile))
+	authorized.PATCH("/users/:id", middleware.Scoped(rt.profileHandler.UpdateProfile, rbac.ProfileWrite))
+	authorized.DELETE("/me", middleware.Verified(rt.accountHandler.DeleteAccount))
+	authorized.GET("/me/export", middleware.Verified(rt.accountHandler.ExportAccount))
 }
 
 func (rt Router) publicRoutes(pub *gin.RouterGroup) {
 	pub.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 	pub.Static("/uploads", "./uploads")
+	pub.GET("/.well-known/jwks.json", rt.authHandler.JWKS)
+	pub.GET("/ws/schema.json", rt.wsHandler.Schema)
 
+	pub.GET("/registration", rt.authHandler.Registration)
 	pub.POST("/register", rt.authHandler.Register)
 	pub.POST("/login", rt.authHandler.Login)
-	pub.GET("/oauth/google/login", rt.authHandler.OauthLogin)
-	pub.GET("/oauth/google/callback", rt.authHandler.OauthCallback)
+	pub.POST("/refresh", rt.authHandler.RefreshToken)
+	pub.POST("/password/forgot", rt.authHandler.ForgotPassword)
+	pub.POST("/password/reset", rt.authHandler.ResetPassword)
+	pub.POST("/email/change/cancel", rt.authHandler.CancelEmailChangeByToken)
+	pub.POST("/webauthn/login/begin", rt.authHandler.BeginPasskeyLogin)
+	pub.POST("/webauthn/login/finish", rt.authHandler.FinishPasskeyLogin)
+	pub.GET("/oauth/providers", rt.authHandler.OauthProviders)
+	pub.GET("/oauth/:provider/login", rt.authHandler.OauthLogin)
+	pub.GET("/oauth/:provider/callback", rt.authHandler.OauthCallback)
 	pub.POST("/profile/verify", middleware.Profile(rt.authHandler.Verify))
 	pub.POST("/profile/request-code", middleware.Profile(rt.authHandler.RequestVerification))
 
 	pub.POST("/llm/chat", middleware.Profile(rt.llmHandler.Prompt))
-	pub.GET("/admin/users", func(c *gin.Context) {
-		var users []models.User
-		c.JSON(200, users)
-	})
+}
+
+func (rt Router) adminRoutes(authorized *gin.RouterGroup) {
+	adm := authorized.Group("/admin")
+	adm.GET("/users", middleware.Verified(middleware.RequirePermission(rt.adminHandler.ListUsers, rbac.UsersRead)))
+	adm.PUT("/users/:id/role", middleware.Verified(middleware.RequirePermission(rt.adminHandler.AssignRole, rbac.UsersManage)))
+	adm.POST("/users/:id/restore", middleware.Verified(middleware.RequirePermission(rt.accountHandler.RestoreAccount, rbac.UsersManage)))
+	adm.GET("/roles", middleware.Verified(middleware.RequirePermission(rt.adminHandler.ListRoles, rbac.UsersRead)))
+	adm.POST("/roles", middleware.Verified(middleware.RequirePermission(rt.adminHandler.CreateRole, rbac.RolesManage)))
+	adm.PUT("/roles/:name", middleware.Verified(middleware.RequirePermission(rt.adminHandler.UpdateRole, rbac.RolesManage)))
+	adm.DELETE("/roles/:name", middleware.Verified(middleware.RequirePermission(rt.adminHandler.DeleteRole, rbac.RolesManage)))
 }
 
 func (rt Router) notifRoutes(authorized *gin.RouterGroup) {
@@ -118,29 +153,58 @@ func (rt Router) notifRoutes(authorized *gin.RouterGroup) {
 
 func (rt Router) postRoutes(authorized *gin.RouterGroup) {
 	profileByID := authorized.Group("/profile")
-	profileByID.GET("/:id/posts", middleware.Verified(rt.postHandler.GetPosts))
+	profileByID.GET("/:id/posts", middleware.Scoped(rt.postHandler.GetPosts))
 	posts := authorized.Group("/posts")
-	posts.POST("", middleware.Verified(rt.postHandler.CreatePost))
-	posts.GET("", middleware.Verified(rt.postHandler.GetPosts))
-	posts.GET("/like/counts", middleware.Verified(rt.likeHandler.GetStats))
-	posts.GET("/comments/counts", middleware.Verified(rt.commentHandler.CountByPosts))
+	posts.POST("", middleware.Scoped(rt.postHandler.CreatePost, rbac.PostsWrite))
+	posts.GET("", middleware.Scoped(rt.postHandler.GetPosts))
+	posts.GET("/like/counts", middleware.Scoped(rt.likeHandler.GetStats))
+	posts.GET("/comments/counts", middleware.Scoped(rt.commentHandler.CountByPosts))
 	postByID := posts.Group("/:id")
-	postByID.POST("/comments", middleware.Verified(rt.commentHandler.CreateComment))
-	postByID.GET("/comments", middleware.Verified(rt.commentHandler.GetComments))
+	postByID.POST("/comments", middleware.Scoped(rt.commentHandler.CreateComment, rbac.CommentsWrite))
+	postByID.GET("/comments", middleware.Scoped(rt.commentHandler.GetComments))
 	postByID.POST("/like", middleware.Verified(rt.likeHandler.LikePost))
 	postByID.DELETE("/like", middleware.Verified(rt.likeHandler.UnlikePost))
-	postByID.GET("/likes", middleware.Verified(rt.likeHandler.GetLikes))
+	postByID.GET("/likes", middleware.Scoped(rt.likeHandler.GetLikes))
 }
 
 func (rt Router) chatRoutes(authorized *gin.RouterGroup) {
-	authorized.GET("/chats", middleware.Verified(rt.chatHandler.GetChatList))
-	authorized.POST("/messages", middleware.Verified(rt.chatHandler.CreatMessage))
-	authorized.GET("/messages/:id", middleware.Verified(rt.chatHandler.GetMessages))
-	authorized.POST("/messages/:id/read", middleware.Verified(rt.chatHandler.MarkMessagesAsRead))
+	authorized.GET("/chats", middleware.Scoped(rt.chatHandler.GetChatList, rbac.ChatRead))
+	authorized.POST("/messages", middleware.Scoped(rt.chatHandler.CreatMessage, rbac.ChatWrite))
+	authorized.GET("/messages/:id", middleware.Scoped(rt.chatHandler.GetMessages, rbac.ChatRead))
+	authorized.POST("/messages/:id/read", middleware.Scoped(rt.chatHandler.MarkMessagesAsRead, rbac.ChatWrite))
 }
 
 func (rt Router) authRoutes(authorized *gin.RouterGroup) {
-	authorized.POST("/refresh", middleware.Verified(rt.authHandler.RefreshToken))
 	authorized.POST("/logout", middleware.Verified(rt.authHandler.Logout))
 	authorized.GET("/users/:id/online", middleware.Verified(rt.authHandler.IsUserOnline))
+	authorized.POST("/users/:id/sessions/revoke", middleware.Verified(rt.authHandler.RevokeSessions))
+	authorized.GET("/sessions", middleware.Verified(rt.authHandler.ListSessions))
+	authorized.GET("/tokens", middleware.Verified(rt.authHandler.ListPersonalTokens))
+	authorized.POST("/tokens", middleware.Verified(rt.authHandler.CreatePersonalToken))
+	authorized.DELETE("/tokens/:id", middleware.Verified(rt.authHandler.RevokePersonalToken))
+	authorized.GET("/invites", middleware.Verified(rt.authHandler.ListInvites))
+	authorized.POST("/invites", middleware.Verified(middleware.RequirePermission(rt.authHandler.CreateInvite, rbac.InvitesCreate)))
+	authorized.DELETE("/invites/:id", middleware.Verified(rt.authHandler.RevokeInvite))
+	authorized.GET("/invitees", middleware.Verified(rt.authHandler.ListInvitees))
+	authorized.POST("/2fa/verify", middleware.Pending2FA(rt.authHandler.VerifyTwoFactor))
+	authorized.POST("/2fa/totp/setup", middleware.Verified(rt.authHandler.SetupTOTP))
+	authorized.POST("/2fa/totp/confirm", middleware.Verified(rt.authHandler.ConfirmTOTP))
+	authorized.POST("/2fa/totp/disable", middleware.Verified(rt.authHandler.DisableTOTP))
+	authorized.DELETE("/sessions/:id", middleware.Verified(rt.authHandler.RevokeSession))
+	authorized.POST("/webauthn/register/begin", middleware.Verified(rt.authHandler.BeginPasskeyRegistration))
+	authorized.POST("/webauthn/register/finish", middleware.Verified(rt.authHandler.FinishPasskeyRegistration))
+	authorized.GET("/webauthn/credentials", middleware.Verified(rt.authHandler.ListPasskeys))
+	authorized.DELETE("/webauthn/credentials/:id", middleware.Verified(rt.authHandler.DeletePasskey))
+	authorized.GET("/identities", middleware.Verified(rt.authHandler.ListIdentities))
+	authorized.DELETE("/identities/:id", middleware.Verified(rt.authHandler.UnlinkIdentity))
+	authorized.GET("/oauth/:provider/link", middleware.Verified(rt.authHandler.OauthLink))
+	authorized.POST("/oauth/:provider/link", middleware.Verified(rt.authHandler.LinkIdentity))
+	authorized.GET("/email/change", middleware.Verified(rt.authHandler.GetEmailChange))
+	authorized.POST("/email/change", middleware.Verified(rt.authHandler.RequestEmailChange))
+	authorized.POST("/email/change/confirm", middleware.Verified(rt.authHandler.ConfirmEmailChange))
+	authorized.DELETE("/email/change", middleware.Verified(rt.authHandler.CancelEmailChange))
+	authorized.GET("/phone", middleware.Verified(rt.authHandler.GetPhone))
+	authorized.PUT("/phone", middleware.Verified(rt.authHandler.SetPhone))
+	authorized.POST("/phone/verify", middleware.Verified(rt.authHandler.VerifyPhone))
+	authorized.DELETE("/phone", middleware.Verified(rt.authHandler.RemovePhone))
 }
@@ -16,7 +16,13 @@ import (
 	"social-app/internal/domains/comment"
 	"social-app/internal/domains/chat"
 	"social-app/internal/domains/auth"
+	"social-app/internal/domains/admin"
+	"social-app/internal/domains/account"
 	"social-app/pkg/ws"
+	"social-app/pkg/middleware"
+	"social-app/pkg/token"
+	"social-app/pkg/passkey"
+	"social-app/pkg/sso"
 	"social-app/pkg/server"
 	"social-app/internal/routes"
 	"social-app/pkg/notifier"
@@ -35,6 +41,7 @@ var (
 			"Mailtrap",
 			"LLM",
 			"Media",
+			"Account",
 		),
 		connector.NewDBConn,
 	)
@@ -48,9 +55,16 @@ var (
 	WSWiring = wire.NewSet(
 		connector.NewRedisConnector,
 		ws.NewConnector,
+		token.NewDenylist,
+		token.NewKeyManager,
+		token.NewSecretSealer,
 	)
 	RepositoryWiring = wire.NewSet(
 		auth.NewRepository,
+		auth.NewTokenStore,
+		auth.NewLoginGuard,
+		admin.NewRepository,
+		account.NewRepository,
 		chat.NewRepository,
 		comment.NewRepository,
 		post.NewRepository,
@@ -61,6 +75,8 @@ var (
 	)
 	ServiceWiring = wire.NewSet(
 		llm.NewService,
+		passkey.NewRelyingParty,
+		sso.NewRegistry,
 	)
 	UseCaseWiring = wire.NewSet(
 		CommonWiring,
@@ -69,6 +85,8 @@ var (
 		NotifierWiring,
 		WSWiring,
 		auth.NewUseCase,
+		admin.NewUseCase,
+		account.NewUseCase,
 		chat.NewUseCase,
 		comment.NewUseCase,
 		post.NewUseCase,
@@ -81,6 +99,9 @@ var (
 	HandlerWiring = wire.NewSet(
 		UseCaseWiring,
 		auth.NewHandler,
+		admin.NewHandler,
+		account.NewHandler,
+		account.NewPurger,
 		chat.NewHandler,
 		comment.NewHandler,
 		post.NewHandler,
@@ -91,6 +112,9 @@ var (
 		ws.NewBroadcaster,
 		ws.NewHandler,
 		llm.NewHandler,
+
+		wire.Bind(new(middleware.PATResolver), new(auth.UseCase)),
+		wire.Bind(new(ws.ChatSender), new(chat.UseCase)),
 	)
 )
 
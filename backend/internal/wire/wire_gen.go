@@ -11,6 +11,8 @@ import (
 	"github.com/google/wire"
 	"social-app/internal/config"
 	"social-app/internal/connector"
+	"social-app/internal/domains/account"
+	"social-app/internal/domains/admin"
 	"social-app/internal/domains/auth"
 	"social-app/internal/domains/chat"
 	"social-app/internal/domains/comment"
@@ -21,8 +23,12 @@ import (
 	"social-app/internal/domains/post"
 	"social-app/internal/domains/profile"
 	"social-app/internal/routes"
+	"social-app/pkg/middleware"
 	"social-app/pkg/notifier"
+	"social-app/pkg/passkey"
 	"social-app/pkg/server"
+	"social-app/pkg/sso"
+	"social-app/pkg/token"
 	"social-app/pkg/ws"
 )
 
@@ -59,26 +65,53 @@ func InitServer(ctx context.Context) (server.Server, error) {
 	profileUseCase := profile.NewUseCase(profileRepository, useCase, notifierSMS, mailTrap)
 	profileHandler := profile.NewHandler(profileUseCase, useCase)
 	chatRepository := chat.NewRepository(dbConn)
-	chatUseCase := chat.NewUseCase(chatRepository)
 	notificationRepository := notification.NewRepository(dbConn)
 	notificationUseCase := notification.NewUseCase(notificationRepository, wsConnector)
+	chatUseCase := chat.NewUseCase(chatRepository, notificationUseCase, broadcaster)
 	chatHandler := chat.NewHandler(chatUseCase, notificationUseCase)
 	likeRepository := like.NewRepository(dbConn)
 	likeUseCase := like.NewUseCase(likeRepository)
 	likeHandler := like.NewHandler(likeUseCase)
 	notificationHandler := notification.NewHandler(notificationUseCase)
 	authRepository := auth.NewRepository(dbConn)
+	tokenStore := auth.NewTokenStore(redisConnector)
 	configAuth := configConfig.Auth
-	authUseCase := auth.NewUseCase(authRepository, configAuth, wsConnector, notifierSMS, mailTrap)
+	loginGuard := auth.NewLoginGuard(redisConnector, configAuth)
+	denylist := token.NewDenylist(redisConnector)
+	keyManager, err := token.NewKeyManager(configAuth, redisConnector)
+	if err != nil {
+		return server.Server{}, err
+	}
+	sealer, err := token.NewSecretSealer(configAuth)
+	if err != nil {
+		return server.Server{}, err
+	}
+	relyingParty, err := passkey.NewRelyingParty(configAuth)
+	if err != nil {
+		return server.Server{}, err
+	}
+	registry, err := sso.NewRegistry(configAuth)
+	if err != nil {
+		return server.Server{}, err
+	}
+	authUseCase := auth.NewUseCase(authRepository, tokenStore, loginGuard, denylist, keyManager, sealer, relyingParty, registry, configAuth, wsConnector, notifierSMS, mailTrap)
 	authHandler := auth.NewHandler(authUseCase)
+	adminRepository := admin.NewRepository(dbConn)
+	adminUseCase := admin.NewUseCase(adminRepository, denylist, configAuth)
+	adminHandler := admin.NewHandler(adminUseCase)
+	accountRepository := account.NewRepository(dbConn)
+	configAccount := configConfig.Account
+	accountUseCase := account.NewUseCase(accountRepository, authUseCase, configAccount)
+	accountHandler := account.NewHandler(accountUseCase)
 	mediaHandler := media.NewHandler(useCase)
-	wsHandler := ws.NewHandler(wsConnector)
+	wsHandler := ws.NewHandler(wsConnector, chatUseCase)
 	configLLM := configConfig.LLM
 	service := llm.NewService(configLLM)
 	llmUseCase := llm.NewUseCase(service)
 	llmHandler := llm.NewHandler(llmUseCase)
-	router := routes.NewRouter(handler, commentHandler, profileHandler, chatHandler, likeHandler, notificationHandler, authHandler, mediaHandler, configAuth, wsHandler, llmHandler)
-	serverServer := server.NewServer(ctx, router, broadcaster, redisConnector)
+	router := routes.NewRouter(handler, commentHandler, profileHandler, chatHandler, likeHandler, notificationHandler, authHandler, adminHandler, accountHandler, mediaHandler, keyManager, denylist, authUseCase, wsHandler, llmHandler)
+	purger := account.NewPurger(accountUseCase, configAccount)
+	serverServer := server.NewServer(ctx, router, broadcaster, redisConnector, purger)
 	return serverServer, nil
 }
 
@@ -94,20 +127,21 @@ var (
 		"Mailtrap",
 		"LLM",
 		"Media",
+		"Account",
 	), connector.NewDBConn,
 	)
 	NotifierWiring   = wire.NewSet(notifier.NewSMS, notifier.NewMailTrap, wire.Bind(new(notifier.Mailerx), new(*notifier.MailTrap)), wire.Bind(new(notifier.SMSNotifier), new(*notifier.SMS)))
-	WSWiring         = wire.NewSet(connector.NewRedisConnector, ws.NewConnector)
-	RepositoryWiring = wire.NewSet(auth.NewRepository, chat.NewRepository, comment.NewRepository, post.NewRepository, like.NewRepository, media.NewRepository, notification.NewRepository, profile.NewRepository)
-	ServiceWiring    = wire.NewSet(llm.NewService)
+	WSWiring         = wire.NewSet(connector.NewRedisConnector, ws.NewConnector, token.NewDenylist, token.NewKeyManager, token.NewSecretSealer)
+	RepositoryWiring = wire.NewSet(auth.NewRepository, auth.NewTokenStore, auth.NewLoginGuard, admin.NewRepository, account.NewRepository, chat.NewRepository, comment.NewRepository, post.NewRepository, like.NewRepository, media.NewRepository, notification.NewRepository, profile.NewRepository)
+	ServiceWiring    = wire.NewSet(llm.NewService, passkey.NewRelyingParty, sso.NewRegistry)
 	UseCaseWiring    = wire.NewSet(
 		CommonWiring,
 		RepositoryWiring,
 		ServiceWiring,
 		NotifierWiring,
-		WSWiring, auth.NewUseCase, chat.NewUseCase, comment.NewUseCase, post.NewUseCase, like.NewUseCase, media.NewUseCase, notification.NewUseCase, profile.NewUseCase, llm.NewUseCase,
+		WSWiring, auth.NewUseCase, admin.NewUseCase, account.NewUseCase, chat.NewUseCase, comment.NewUseCase, post.NewUseCase, like.NewUseCase, media.NewUseCase, notification.NewUseCase, profile.NewUseCase, llm.NewUseCase,
 	)
 	HandlerWiring = wire.NewSet(
-		UseCaseWiring, auth.NewHandler, chat.NewHandler, comment.NewHandler, post.NewHandler, like.NewHandler, media.NewHandler, notification.NewHandler, profile.NewHandler, ws.NewBroadcaster, ws.NewHandler, llm.NewHandler,
+		UseCaseWiring, auth.NewHandler, admin.NewHandler, account.NewHandler, account.NewPurger, chat.NewHandler, comment.NewHandler, post.NewHandler, like.NewHandler, media.NewHandler, notification.NewHandler, profile.NewHandler, ws.NewBroadcaster, ws.NewHandler, llm.NewHandler, wire.Bind(new(middleware.PATResolver), new(auth.UseCase)), wire.Bind(new(ws.ChatSender), new(chat.UseCase)),
 	)
 )
@@ -1,45 +1,120 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
-	"social-app/internal/config"
+	"social-app/pkg/token"
 )
 
-func Auth(cfg config.Auth) gin.HandlerFunc {
+// PAT is what a personal access token grants: its scopes that the user
+// still holds.
+type PAT struct {
+	Scopes   []string
+	Username string
+	Role     string
+	ID       uint64
+	UserID   uint64
+	Verified bool
+}
+
+// PATResolver looks up personal access tokens and records their use.
+type PATResolver interface {
+	ResolvePAT(ctx context.Context, raw, ip string) (PAT, error)
+}
+
+func Auth(km *token.KeyManager, dl *token.Denylist, pats PATResolver) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString := extractToken(c)
+		tokenString := ExtractToken(c)
 		if tokenString == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid token"})
 			return
 		}
 
-		token, err := parseToken(tokenString, []byte(cfg.JWTSecret))
-		if err != nil || !token.Valid {
+		if token.IsPAT(tokenString) {
+			authPAT(c, pats, tokenString)
+			return
+		}
+
+		tok, err := parseToken(tokenString, km)
+		if err != nil || !tok.Valid {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
+		claims, ok := tok.Claims.(jwt.MapClaims)
 		if !ok {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 			return
 		}
 
+		// Only access tokens and pending two-factor tokens open a request;
+		// refresh and password reset tokens are redeemed on their own routes,
+		// and ID tokens only describe the user to the client.
+		switch getStringClaim(claims, "typ", "") {
+		case "", "2fa":
+		default:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token type"})
+			return
+		}
+
 		if err := injectClaimsIntoContext(c, claims); err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
 
+		revoked, err := dl.IsRevoked(
+			c.Request.Context(),
+			c.GetString("token_id"),
+			c.GetString("session_id"),
+			c.GetUint64("user_id"),
+			issuedAt(claims),
+		)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+			return
+		}
+		if revoked {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
+			return
+		}
+
 		c.Next()
 	}
 }
 
-func extractToken(c *gin.Context) string {
+// authPAT authenticates a personal access token. Such tokens are long-lived,
+// so they are only accepted in the Authorization header, never in URLs that
+// end up in logs.
+func authPAT(c *gin.Context, pats PATResolver, raw string) {
+	if c.GetHeader("Authorization") == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Personal access tokens must be sent in the Authorization header"})
+		return
+	}
+
+	pat, err := pats.ResolvePAT(c.Request.Context(), raw, c.ClientIP())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	c.Set("user_id", pat.UserID)
+	c.Set("role", pat.Role)
+	c.Set("permissions", pat.Scopes)
+	c.Set("username", pat.Username)
+	c.Set("verified", pat.Verified)
+	c.Set("token_id", fmt.Sprintf("pat:%d", pat.ID))
+	c.Set("pat", true)
+
+	c.Next()
+}
+
+func ExtractToken(c *gin.Context) string {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
 		tokenString := c.Query("token")
@@ -51,13 +126,8 @@ func extractToken(c *gin.Context) string {
 	return strings.TrimPrefix(authHeader, "Bearer ")
 }
 
-func parseToken(tokenString string, secret []byte) (*jwt.Token, error) {
-	j, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return secret, nil
-	})
+func parseToken(tokenString string, km *token.KeyManager) (*jwt.Token, error) {
+	j, err := jwt.Parse(tokenString, km.Keyfunc)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
@@ -71,10 +141,14 @@ func injectClaimsIntoContext(c *gin.Context, claims jwt.MapClaims) error {
 	}
 	c.Set("user_id", uint64(sub))
 	c.Set("role", getStringClaim(claims, "role", "anonymous"))
+	c.Set("permissions", getStringsClaim(claims, "perms"))
 	c.Set("email", getStringClaim(claims, "email", ""))
 	c.Set("username", getStringClaim(claims, "username", ""))
 	c.Set("verified", getBoolClaim(claims, "verified", false))
 	c.Set("need_2fa", getBoolClaim(claims, "need_2fa", false))
+	c.Set("session_id", getStringClaim(claims, "sid", ""))
+	c.Set("token_id", getStringClaim(claims, "jti", ""))
+	c.Set("token_expires_at", getTimeClaim(claims, "exp"))
 	return nil
 }
 
@@ -85,9 +159,36 @@ func getStringClaim(claims jwt.MapClaims, key, fallback string) string {
 	return fallback
 }
 
+func getStringsClaim(claims jwt.MapClaims, key string) []string {
+	values, _ := claims[key].([]interface{})
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
 func getBoolClaim(claims jwt.MapClaims, key string, fallback bool) bool {
 	if val, exists := claims[key].(bool); exists {
 		return val
 	}
 	return fallback
 }
+
+// issuedAt reads the issue time of a token, to the millisecond from iat_ms
+// when the token carries it.
+func issuedAt(claims jwt.MapClaims) time.Time {
+	if ms, ok := claims["iat_ms"].(float64); ok {
+		return time.UnixMilli(int64(ms))
+	}
+	return getTimeClaim(claims, "iat")
+}
+
+func getTimeClaim(claims jwt.MapClaims, key string) time.Time {
+	if val, exists := claims[key].(float64); exists {
+		return time.Unix(int64(val), 0)
+	}
+	return time.Time{}
+}
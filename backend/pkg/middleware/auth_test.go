@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"social-app/internal/config"
+	"social-app/internal/connector"
+	"social-app/pkg/rbac"
+	"social-app/pkg/token"
+)
+
+type stubResolver map[string]PAT
+
+func (s stubResolver) ResolvePAT(_ context.Context, raw, _ string) (PAT, error) {
+	pat, ok := s[raw]
+	if !ok {
+		return PAT{}, errors.New("unknown token")
+	}
+	return pat, nil
+}
+
+func TestAuthPersonalAccessToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	raw := token.PATPrefix + "writer"
+	pats := stubResolver{raw: {ID: 7, UserID: 42, Username: "bot", Verified: true, Scopes: []string{rbac.PostsWrite}}}
+
+	var seen *Context
+	ok := func(c *Context) {
+		seen = c
+		c.JSON(http.StatusOK, gin.H{})
+	}
+
+	r := gin.New()
+	r.Use(Auth(nil, nil, pats))
+	r.POST("/posts", Scoped(ok, rbac.PostsWrite))
+	r.GET("/chats", Scoped(ok, rbac.ChatRead))
+	r.GET("/sessions", Verified(ok))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		want   int
+	}{
+		{"scope granted", http.MethodPost, "/posts", "Bearer " + raw, http.StatusOK},
+		{"scope missing", http.MethodGet, "/chats", "Bearer " + raw, http.StatusForbidden},
+		{"browser only route", http.MethodGet, "/sessions", "Bearer " + raw, http.StatusForbidden},
+		{"unknown token", http.MethodPost, "/posts", "Bearer " + token.PATPrefix + "nope", http.StatusUnauthorized},
+		{"token in query", http.MethodPost, "/posts?token=" + raw, "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = nil
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("Expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			if seen == nil || seen.User.ID != 42 || !seen.Token.PAT || seen.Token.ID != "pat:7" {
+				t.Errorf("Unexpected context %+v", seen)
+			}
+		})
+	}
+}
+
+func TestAuthTokenType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	host, port, _ := net.SplitHostPort(mr.Addr())
+	p, _ := strconv.Atoi(port)
+	rc := connector.NewRedisConnector(config.Redis{Host: host, Port: p})
+
+	km, err := token.NewKeyManager(config.Auth{JWTAlg: token.AlgHS256, JWTSecret: "secret"}, rc)
+	if err != nil {
+		t.Fatalf("NewKeyManager failed: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(Auth(km, token.NewDenylist(rc), nil))
+	r.GET("/me", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) })
+
+	tests := []struct {
+		typ  string
+		want int
+	}{
+		{"", http.StatusOK},
+		{"2fa", http.StatusOK},
+		{"refresh", http.StatusUnauthorized},
+		{"password_reset", http.StatusUnauthorized},
+		{"id", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.typ, func(t *testing.T) {
+			now := time.Now()
+			claims := jwt.MapClaims{
+				"sub":    float64(42),
+				"sid":    "family",
+				"jti":    "jti-" + tt.typ,
+				"iat":    now.Unix(),
+				"iat_ms": now.UnixMilli(),
+				"exp":    now.Add(time.Minute).Unix(),
+			}
+			if tt.typ != "" {
+				claims["typ"] = tt.typ
+			}
+			ts, err := km.Sign(context.Background(), claims)
+			if err != nil {
+				t.Fatalf("Sign failed: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+ts)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("Expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
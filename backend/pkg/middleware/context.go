@@ -5,21 +5,49 @@ import (
 	"mime/multipart"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"social-app/internal/models"
+	"social-app/pkg/rbac"
 )
 
 type Context struct {
-	Writer  gin.ResponseWriter
-	root    *gin.Context
-	Request *http.Request
-	User    models.User
+	Writer      gin.ResponseWriter
+	root        *gin.Context
+	Request     *http.Request
+	Token       Token
+	User        models.User
+	Permissions []string
+}
+
+// Token describes the access token that authenticated the request. PAT is
+// set for personal access tokens, which have no session nor expiry here.
+type Token struct {
+	ExpiresAt time.Time
+	ID        string
+	SessionID string
+	PAT       bool
 }
 
 type HandlerFunc func(*Context)
 
+// Verified lets through verified users signed in through the browser flow.
+// Personal access tokens are refused: routes open to them use Scoped.
 func Verified(handler HandlerFunc) gin.HandlerFunc {
+	return verified(handler, false)
+}
+
+// Scoped is Verified for the routes personal access tokens may use. The
+// request needs every one of perms, which for a personal access token are
+// its scopes:
+//
+//	middleware.Scoped(h.CreatePost, rbac.PostsWrite)
+func Scoped(handler HandlerFunc, perms ...string) gin.HandlerFunc {
+	return verified(RequirePermission(handler, perms...), true)
+}
+
+func verified(handler HandlerFunc, allowPAT bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, done := setContext(c)
 		if done {
@@ -28,6 +56,16 @@ func Verified(handler HandlerFunc) gin.HandlerFunc {
 
 		c.Set("context", ctx)
 
+		if ctx.Token.PAT && !allowPAT {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "personal access tokens cannot use this endpoint"})
+			return
+		}
+
+		if c.GetBool("need_2fa") {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "two-factor authentication required"})
+			return
+		}
+
 		if !ctx.User.Verified {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "user not verified"})
 			return
@@ -37,6 +75,41 @@ func Verified(handler HandlerFunc) gin.HandlerFunc {
 	}
 }
 
+// Pending2FA only lets through tokens issued by a login that still awaits its
+// second factor.
+func Pending2FA(handler HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, done := setContext(c)
+		if done {
+			return
+		}
+
+		c.Set("context", ctx)
+
+		if !c.GetBool("need_2fa") {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "no pending two-factor authentication"})
+			return
+		}
+
+		handler(ctx)
+	}
+}
+
+// RequirePermission only runs handler when the token grants every one of
+// perms. It goes inside Verified:
+//
+//	middleware.Verified(middleware.RequirePermission(h.ListUsers, rbac.UsersRead))
+func RequirePermission(handler HandlerFunc, perms ...string) HandlerFunc {
+	return func(c *Context) {
+		if !rbac.Has(c.Permissions, perms...) {
+			c.root.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		handler(c)
+	}
+}
+
 func Profile(handler HandlerFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := &Context{
@@ -59,7 +132,14 @@ func setContext(c *gin.Context) (*Context, bool) {
 	}
 
 	ctx := &Context{
-		User:    user,
+		User:        user,
+		Permissions: c.GetStringSlice("permissions"),
+		Token: Token{
+			ID:        c.GetString("token_id"),
+			SessionID: c.GetString("session_id"),
+			ExpiresAt: c.GetTime("token_expires_at"),
+			PAT:       c.GetBool("pat"),
+		},
 		root:    c,
 		Writer:  c.Writer,
 		Request: c.Request,
@@ -95,6 +175,10 @@ func (c *Context) BindJSON(obj any) error {
 	return nil
 }
 
+func (c *Context) ClientIP() string {
+	return c.root.ClientIP()
+}
+
 func (c *Context) Query(key string) string {
 	return c.root.Query(key)
 }
@@ -13,6 +13,10 @@ import (
 
 type Mailerx interface {
 	SendEmailVerification(to string, code string) error
+	SendPasswordReset(to string, link string) error
+	SendAccountLocked(to string, until time.Time) error
+	SendEmailChangeCode(to string, code string) error
+	SendEmailChangeNotice(to string, newEmail string, cancelLink string, until time.Time) error
 }
 
 type MailTrap struct {
@@ -52,6 +56,79 @@ func (m *MailTrap) SendEmailVerification(to, code string) error {
 	return nil
 }
 
+func (m *MailTrap) SendPasswordReset(to, link string) error {
+	message := gomail.NewMessage()
+
+	message.SetHeader("From", m.From)
+	message.SetHeader("To", to)
+	message.SetHeader("Subject", "Réinitialisation de votre mot de passe")
+
+	message.SetBody("text/plain", "Pour choisir un nouveau mot de passe, ouvrez ce lien : "+link+
+		"\n\nSi vous n'êtes pas à l'origine de cette demande, ignorez cet email.")
+
+	dialer := gomail.NewDialer(m.Host, m.Port, m.AuthUser, m.AuthPass)
+
+	if err := dialer.DialAndSend(message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
+
+func (m *MailTrap) SendAccountLocked(to string, until time.Time) error {
+	message := gomail.NewMessage()
+
+	message.SetHeader("From", m.From)
+	message.SetHeader("To", to)
+	message.SetHeader("Subject", "Votre compte a été temporairement verrouillé")
+
+	message.SetBody("text/plain", lockedBody(until))
+
+	dialer := gomail.NewDialer(m.Host, m.Port, m.AuthUser, m.AuthPass)
+
+	if err := dialer.DialAndSend(message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
+
+func (m *MailTrap) SendEmailChangeCode(to, code string) error {
+	message := gomail.NewMessage()
+
+	message.SetHeader("From", m.From)
+	message.SetHeader("To", to)
+	message.SetHeader("Subject", "Confirmez votre nouvelle adresse email")
+
+	message.SetBody("text/plain", emailChangeCodeBody(code))
+
+	dialer := gomail.NewDialer(m.Host, m.Port, m.AuthUser, m.AuthPass)
+
+	if err := dialer.DialAndSend(message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
+
+func (m *MailTrap) SendEmailChangeNotice(to, newEmail, cancelLink string, until time.Time) error {
+	message := gomail.NewMessage()
+
+	message.SetHeader("From", m.From)
+	message.SetHeader("To", to)
+	message.SetHeader("Subject", "Changement de votre adresse email")
+
+	message.SetBody("text/plain", emailChangeNoticeBody(newEmail, cancelLink, until))
+
+	dialer := gomail.NewDialer(m.Host, m.Port, m.AuthUser, m.AuthPass)
+
+	if err := dialer.DialAndSend(message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
+
 type Mailgun struct {
 	Domain string
 	APIKey string
@@ -82,3 +159,91 @@ func (m *Mailgun) SendEmailVerification(to, code string) error {
 
 	return nil
 }
+
+func (m *Mailgun) SendPasswordReset(to, link string) error {
+	mg := mailgun.NewMailgun(m.Domain, m.APIKey)
+
+	subject := "Réinitialisation de votre mot de passe"
+	body := fmt.Sprintf("Pour choisir un nouveau mot de passe, ouvrez ce lien : %s\n\nSi vous n'êtes pas à l'origine de cette demande, ignorez cet email.", link)
+
+	message := mailgun.NewMessage(m.From, subject, body, to)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if _, _, err := mg.Send(ctx, message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	log.Printf("[Mailgun] Password reset email sent to %s", to)
+
+	return nil
+}
+
+func (m *Mailgun) SendAccountLocked(to string, until time.Time) error {
+	mg := mailgun.NewMailgun(m.Domain, m.APIKey)
+
+	message := mailgun.NewMessage(m.From, "Votre compte a été temporairement verrouillé", lockedBody(until), to)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if _, _, err := mg.Send(ctx, message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	log.Printf("[Mailgun] Account locked email sent to %s", to)
+
+	return nil
+}
+
+func (m *Mailgun) SendEmailChangeCode(to, code string) error {
+	mg := mailgun.NewMailgun(m.Domain, m.APIKey)
+
+	message := mailgun.NewMessage(m.From, "Confirmez votre nouvelle adresse email", emailChangeCodeBody(code), to)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if _, _, err := mg.Send(ctx, message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	log.Printf("[Mailgun] Email change code sent to %s", to)
+
+	return nil
+}
+
+func (m *Mailgun) SendEmailChangeNotice(to, newEmail, cancelLink string, until time.Time) error {
+	mg := mailgun.NewMailgun(m.Domain, m.APIKey)
+
+	message := mailgun.NewMessage(m.From, "Changement de votre adresse email", emailChangeNoticeBody(newEmail, cancelLink, until), to)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if _, _, err := mg.Send(ctx, message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	log.Printf("[Mailgun] Email change notice sent to %s", to)
+
+	return nil
+}
+
+func emailChangeCodeBody(code string) string {
+	return fmt.Sprintf("Voici le code pour confirmer votre nouvelle adresse email : %s\n\n"+
+		"Si vous n'êtes pas à l'origine de cette demande, ignorez cet email.", code)
+}
+
+func emailChangeNoticeBody(newEmail, cancelLink string, until time.Time) string {
+	return fmt.Sprintf("Une demande de changement de l'adresse email de votre compte vers %s a été faite.\n\n"+
+		"Si ce n'était pas vous, annulez-la avant le %s (UTC) en ouvrant ce lien : %s\n"+
+		"L'annulation rétablit cette adresse et déconnecte toutes les sessions.",
+		newEmail, until.UTC().Format("02/01/2006 15:04"), cancelLink)
+}
+
+func lockedBody(until time.Time) string {
+	return fmt.Sprintf("Suite à plusieurs tentatives de connexion échouées, votre compte est verrouillé jusqu'à %s (UTC).\n\n"+
+		"Si ce n'était pas vous, nous vous conseillons de réinitialiser votre mot de passe.", until.UTC().Format("02/01/2006 15:04"))
+}
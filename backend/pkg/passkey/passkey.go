@@ -0,0 +1,178 @@
+package passkey
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"social-app/internal/config"
+)
+
+var (
+	ErrInvalidUserHandle = errors.New("invalid user handle")
+	ErrCloneWarning      = errors.New("authenticator sign count went backwards")
+)
+
+// User is the WebAuthn view of an account. The user handle is the big-endian
+// encoding of the user ID so that discoverable logins can find the account.
+type User struct {
+	Name        string
+	DisplayName string
+	Credentials []webauthn.Credential
+	ID          uint64
+}
+
+func (u User) WebAuthnID() []byte {
+	return binary.BigEndian.AppendUint64(nil, u.ID)
+}
+
+func (u User) WebAuthnName() string {
+	return u.Name
+}
+
+func (u User) WebAuthnDisplayName() string {
+	if u.DisplayName == "" {
+		return u.Name
+	}
+	return u.DisplayName
+}
+
+func (u User) WebAuthnCredentials() []webauthn.Credential {
+	return u.Credentials
+}
+
+func UserID(handle []byte) (uint64, error) {
+	if len(handle) != 8 {
+		return 0, ErrInvalidUserHandle
+	}
+	return binary.BigEndian.Uint64(handle), nil
+}
+
+// Lookup loads the account owning a credential presented during a passkey
+// login.
+type Lookup func(userID uint64, credentialID []byte) (User, error)
+
+// RelyingParty runs the registration and authentication ceremonies. Ceremony
+// state is returned as opaque bytes for the caller to keep until the client
+// answers.
+type RelyingParty struct {
+	web *webauthn.WebAuthn
+}
+
+func NewRelyingParty(cfg config.Auth) (*RelyingParty, error) {
+	web, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthn.RPID,
+		RPDisplayName: cfg.WebAuthn.RPDisplayName,
+		RPOrigins:     cfg.WebAuthn.GetOrigins(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure WebAuthn: %w", err)
+	}
+
+	return &RelyingParty{
+		web: web,
+	}, nil
+}
+
+// BeginRegistration creates the options of a discoverable credential for the
+// user, excluding the authenticators already registered. The authenticator
+// must verify the user, with a PIN or biometrics.
+func (rp *RelyingParty) BeginRegistration(user User) (*protocol.CredentialCreation, []byte, error) {
+	creation, session, err := rp.web.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(user.Credentials).CredentialDescriptors()),
+		requireUserVerification,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin registration: %w", err)
+	}
+
+	state, err := json.Marshal(session)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode registration session: %w", err)
+	}
+
+	return creation, state, nil
+}
+
+func (rp *RelyingParty) FinishRegistration(user User, state, response []byte) (*webauthn.Credential, error) {
+	var session webauthn.SessionData
+	if err := json.Unmarshal(state, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode registration session: %w", err)
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse attestation: %w", err)
+	}
+
+	credential, err := rp.web.CreateCredential(user, session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify attestation: %w", err)
+	}
+
+	return credential, nil
+}
+
+// requireUserVerification makes FinishRegistration check the UV flag, which
+// go-webauthn only does when the session requires it.
+func requireUserVerification(options *protocol.PublicKeyCredentialCreationOptions) {
+	options.AuthenticatorSelection.UserVerification = protocol.VerificationRequired
+}
+
+// BeginLogin starts a usernameless login: any passkey of this relying party
+// may answer. The assertion must prove user verification, so a passkey is
+// both factors: possession of the authenticator and its PIN or biometrics.
+func (rp *RelyingParty) BeginLogin() (*protocol.CredentialAssertion, []byte, error) {
+	assertion, session, err := rp.web.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin login: %w", err)
+	}
+
+	state, err := json.Marshal(session)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode login session: %w", err)
+	}
+
+	return assertion, state, nil
+}
+
+// FinishLogin verifies the assertion and returns the account and the updated
+// credential, whose sign count and backup state must be persisted.
+func (rp *RelyingParty) FinishLogin(state, response []byte, lookup Lookup) (User, *webauthn.Credential, error) {
+	var session webauthn.SessionData
+	if err := json.Unmarshal(state, &session); err != nil {
+		return User{}, nil, fmt.Errorf("failed to decode login session: %w", err)
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return User{}, nil, fmt.Errorf("failed to parse assertion: %w", err)
+	}
+
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := UserID(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		return lookup(userID, rawID)
+	}
+
+	found, credential, err := rp.web.ValidatePasskeyLogin(handler, session, parsed)
+	if err != nil {
+		return User{}, nil, fmt.Errorf("failed to verify assertion: %w", err)
+	}
+	if credential.Authenticator.CloneWarning {
+		return User{}, nil, ErrCloneWarning
+	}
+
+	user, ok := found.(User)
+	if !ok {
+		return User{}, nil, fmt.Errorf("unexpected user type %T", found)
+	}
+
+	return user, credential, nil
+}
@@ -0,0 +1,317 @@
+package passkey
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"social-app/internal/config"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:5173"
+
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// softAuthenticator is an in-memory ES256 authenticator holding a single
+// resident credential.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	counter      uint32
+	// skipUV answers without verifying the user, like a security key
+	// without a PIN.
+	skipUV bool
+}
+
+func (a *softAuthenticator) flags() byte {
+	if a.skipUV {
+		return flagUserPresent
+	}
+	return flagUserPresent | flagUserVerified
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatalf("rand.Read failed: %v", err)
+	}
+
+	return &softAuthenticator{key: key, credentialID: id}
+}
+
+func (a *softAuthenticator) create(t *testing.T, challenge string, userHandle []byte) []byte {
+	t.Helper()
+
+	a.userHandle = userHandle
+	clientData := clientDataJSON(t, "webauthn.create", challenge)
+
+	cose, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatalf("failed to encode COSE key: %v", err)
+	}
+
+	authData := a.authData(a.flags() | flagAttested)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, cose...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode attestation: %v", err)
+	}
+
+	return a.credential(t, map[string]any{
+		"clientDataJSON":    b64(clientData),
+		"attestationObject": b64(attestation),
+		"transports":        []string{"internal"},
+	})
+}
+
+func (a *softAuthenticator) get(t *testing.T, challenge string) []byte {
+	t.Helper()
+
+	a.counter++
+	clientData := clientDataJSON(t, "webauthn.get", challenge)
+	authData := a.authData(a.flags())
+
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign assertion: %v", err)
+	}
+
+	return a.credential(t, map[string]any{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.counter)
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]any) []byte {
+	t.Helper()
+
+	raw, err := json.Marshal(map[string]any{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode credential: %v", err)
+	}
+	return raw
+}
+
+func clientDataJSON(t *testing.T, typ, challenge string) []byte {
+	t.Helper()
+
+	raw, err := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": challenge,
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode client data: %v", err)
+	}
+	return raw
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newTestRelyingParty(t *testing.T) *RelyingParty {
+	t.Helper()
+
+	rp, err := NewRelyingParty(config.Auth{WebAuthn: config.WebAuthn{
+		RPID:          testRPID,
+		RPDisplayName: "Social App",
+		RPOriginsRaw:  testOrigin,
+	}})
+	if err != nil {
+		t.Fatalf("NewRelyingParty failed: %v", err)
+	}
+	return rp
+}
+
+func register(t *testing.T, rp *RelyingParty, a *softAuthenticator, user User) webauthn.Credential {
+	t.Helper()
+
+	creation, state, err := rp.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("BeginRegistration failed: %v", err)
+	}
+
+	credential, err := rp.FinishRegistration(user, state, a.create(t, creation.Response.Challenge.String(), user.WebAuthnID()))
+	if err != nil {
+		t.Fatalf("FinishRegistration failed: %v", err)
+	}
+	return *credential
+}
+
+func TestRegistrationAndLogin(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	a := newSoftAuthenticator(t)
+	user := User{ID: 42, Name: "alice"}
+
+	credential := register(t, rp, a, user)
+	if !bytes.Equal(credential.ID, a.credentialID) {
+		t.Fatalf("Expected credential ID %x, got %x", a.credentialID, credential.ID)
+	}
+	user.Credentials = []webauthn.Credential{credential}
+
+	assertion, state, err := rp.BeginLogin()
+	if err != nil {
+		t.Fatalf("BeginLogin failed: %v", err)
+	}
+
+	lookup := func(userID uint64, credentialID []byte) (User, error) {
+		if userID != user.ID {
+			t.Errorf("Expected lookup of user %d, got %d", user.ID, userID)
+		}
+		return user, nil
+	}
+
+	found, updated, err := rp.FinishLogin(state, a.get(t, assertion.Response.Challenge.String()), lookup)
+	if err != nil {
+		t.Fatalf("FinishLogin failed: %v", err)
+	}
+	if found.ID != user.ID {
+		t.Errorf("Expected user %d, got %d", user.ID, found.ID)
+	}
+	if updated.Authenticator.SignCount != a.counter {
+		t.Errorf("Expected sign count %d, got %d", a.counter, updated.Authenticator.SignCount)
+	}
+}
+
+func TestLoginRejectsWrongChallenge(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	a := newSoftAuthenticator(t)
+	user := User{ID: 7, Name: "bob"}
+	user.Credentials = []webauthn.Credential{register(t, rp, a, user)}
+
+	_, state, err := rp.BeginLogin()
+	if err != nil {
+		t.Fatalf("BeginLogin failed: %v", err)
+	}
+
+	lookup := func(uint64, []byte) (User, error) { return user, nil }
+	if _, _, err := rp.FinishLogin(state, a.get(t, b64([]byte("not-the-challenge"))), lookup); err == nil {
+		t.Fatal("Expected an assertion for another challenge to be rejected")
+	}
+}
+
+func TestUserVerificationRequired(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	a := newSoftAuthenticator(t)
+	user := User{ID: 8, Name: "dave"}
+
+	creation, state, err := rp.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("BeginRegistration failed: %v", err)
+	}
+	if uv := creation.Response.AuthenticatorSelection.UserVerification; uv != "required" {
+		t.Errorf("Expected registration to require user verification, got %q", uv)
+	}
+	a.skipUV = true
+	if _, err := rp.FinishRegistration(user, state, a.create(t, creation.Response.Challenge.String(), user.WebAuthnID())); err == nil {
+		t.Error("Expected an attestation without user verification to be rejected")
+	}
+
+	a.skipUV = false
+	user.Credentials = []webauthn.Credential{register(t, rp, a, user)}
+
+	assertion, state, err := rp.BeginLogin()
+	if err != nil {
+		t.Fatalf("BeginLogin failed: %v", err)
+	}
+	if uv := assertion.Response.UserVerification; uv != "required" {
+		t.Errorf("Expected login to require user verification, got %q", uv)
+	}
+	a.skipUV = true
+	lookup := func(uint64, []byte) (User, error) { return user, nil }
+	if _, _, err := rp.FinishLogin(state, a.get(t, assertion.Response.Challenge.String()), lookup); err == nil {
+		t.Error("Expected an assertion without user verification to be rejected")
+	}
+}
+
+func TestLoginDetectsClonedAuthenticator(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	a := newSoftAuthenticator(t)
+	user := User{ID: 9, Name: "carol"}
+
+	credential := register(t, rp, a, user)
+	credential.Authenticator.SignCount = 10
+	user.Credentials = []webauthn.Credential{credential}
+
+	assertion, state, err := rp.BeginLogin()
+	if err != nil {
+		t.Fatalf("BeginLogin failed: %v", err)
+	}
+
+	lookup := func(uint64, []byte) (User, error) { return user, nil }
+	_, _, err = rp.FinishLogin(state, a.get(t, assertion.Response.Challenge.String()), lookup)
+	if !errors.Is(err, ErrCloneWarning) {
+		t.Fatalf("Expected ErrCloneWarning, got %v", err)
+	}
+}
+
+func TestUserID(t *testing.T) {
+	user := User{ID: 123456789}
+
+	id, err := UserID(user.WebAuthnID())
+	if err != nil {
+		t.Fatalf("UserID failed: %v", err)
+	}
+	if id != user.ID {
+		t.Errorf("Expected %d, got %d", user.ID, id)
+	}
+
+	if _, err := UserID([]byte("short")); !errors.Is(err, ErrInvalidUserHandle) {
+		t.Errorf("Expected ErrInvalidUserHandle, got %v", err)
+	}
+}
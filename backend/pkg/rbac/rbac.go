@@ -0,0 +1,166 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Permissions are "resource:action" strings. A role granting "resource:*"
+// has every action on the resource, and "*" grants everything.
+const (
+	All = "*"
+
+	PostsWrite       = "posts:write"
+	PostsModerate    = "posts:moderate"
+	CommentsWrite    = "comments:write"
+	CommentsModerate = "comments:moderate"
+	ChatRead         = "chat:read"
+	ChatWrite        = "chat:write"
+	MediaWrite       = "media:write"
+	ProfileWrite     = "profile:write"
+	UsersRead        = "users:read"
+	UsersManage      = "users:manage"
+	RolesManage      = "roles:manage"
+	InvitesCreate    = "invites:create"
+	InvitesManage    = "invites:manage"
+)
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var (
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrInvalidRoleName   = errors.New("invalid role name")
+)
+
+var known = []string{
+	PostsWrite,
+	PostsModerate,
+	CommentsWrite,
+	CommentsModerate,
+	ChatRead,
+	ChatWrite,
+	MediaWrite,
+	ProfileWrite,
+	UsersRead,
+	UsersManage,
+	RolesManage,
+	InvitesCreate,
+	InvitesManage,
+}
+
+var userPermissions = []string{
+	PostsWrite,
+	CommentsWrite,
+	ChatRead,
+	ChatWrite,
+	MediaWrite,
+	ProfileWrite,
+	InvitesCreate,
+}
+
+var builtin = map[string][]string{
+	RoleUser:      userPermissions,
+	RoleModerator: append([]string{PostsModerate, CommentsModerate, UsersRead}, userPermissions...),
+	RoleAdmin:     {All},
+}
+
+// Known returns every permission a role can be granted.
+func Known() []string {
+	return append([]string(nil), known...)
+}
+
+// Builtin returns the permissions of the user, moderator and admin roles.
+func Builtin(role string) ([]string, bool) {
+	perms, ok := builtin[role]
+	if !ok {
+		return nil, false
+	}
+	return append([]string(nil), perms...), true
+}
+
+func IsBuiltin(role string) bool {
+	_, ok := builtin[role]
+	return ok
+}
+
+// BuiltinRoles returns the names of the built-in roles, sorted.
+func BuiltinRoles() []string {
+	names := make([]string, 0, len(builtin))
+	for name := range builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Has reports whether granted includes every one of perms.
+func Has(granted []string, perms ...string) bool {
+	for _, perm := range perms {
+		if !has(granted, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+func has(granted []string, perm string) bool {
+	resource, _, _ := strings.Cut(perm, ":")
+	for _, g := range granted {
+		if g == All || g == perm || g == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize validates perms and returns them sorted without duplicates.
+func Normalize(perms []string) ([]string, error) {
+	set := make(map[string]struct{}, len(perms))
+	for _, perm := range perms {
+		perm = strings.TrimSpace(perm)
+		if !valid(perm) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownPermission, perm)
+		}
+		set[perm] = struct{}{}
+	}
+
+	out := make([]string, 0, len(set))
+	for perm := range set {
+		out = append(out, perm)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func valid(perm string) bool {
+	if perm == All {
+		return true
+	}
+	for _, k := range known {
+		resource, _, _ := strings.Cut(k, ":")
+		if perm == k || perm == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRoleName accepts lowercase names of letters, digits, '-' and '_'
+// that are not a built-in role.
+func ValidateRoleName(name string) error {
+	if name == "" || len(name) > 64 || IsBuiltin(name) {
+		return ErrInvalidRoleName
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return ErrInvalidRoleName
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package rbac
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHas(t *testing.T) {
+	tests := []struct {
+		name    string
+		granted []string
+		perms   []string
+		want    bool
+	}{
+		{"exact", []string{PostsWrite}, []string{PostsWrite}, true},
+		{"missing", []string{PostsWrite}, []string{PostsModerate}, false},
+		{"all required", []string{PostsWrite}, []string{PostsWrite, ChatRead}, false},
+		{"resource wildcard", []string{"posts:*"}, []string{PostsWrite, PostsModerate}, true},
+		{"wildcard stays on its resource", []string{"posts:*"}, []string{CommentsWrite}, false},
+		{"everything", []string{All}, []string{UsersManage, RolesManage}, true},
+		{"nothing granted", nil, []string{ChatRead}, false},
+		{"nothing required", nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Has(tt.granted, tt.perms...); got != tt.want {
+				t.Errorf("Has(%v, %v) = %v, expected %v", tt.granted, tt.perms, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuiltinRoles(t *testing.T) {
+	user, _ := Builtin(RoleUser)
+	moderator, _ := Builtin(RoleModerator)
+	admin, _ := Builtin(RoleAdmin)
+
+	if Has(user, PostsModerate) || Has(user, UsersRead) {
+		t.Errorf("Expected users not to moderate, got %v", user)
+	}
+	if !Has(user, InvitesCreate) || Has(user, InvitesManage) {
+		t.Errorf("Expected users to invite without managing invites, got %v", user)
+	}
+	if !Has(moderator, PostsModerate, CommentsModerate, UsersRead, PostsWrite) {
+		t.Errorf("Expected moderators to moderate and post, got %v", moderator)
+	}
+	if Has(moderator, UsersManage) || Has(moderator, RolesManage) {
+		t.Errorf("Expected moderators not to manage users, got %v", moderator)
+	}
+	if !Has(admin, Known()...) {
+		t.Errorf("Expected admins to have every permission, got %v", admin)
+	}
+
+	if _, ok := Builtin("editor"); ok {
+		t.Error("Expected editor not to be a built-in role")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	got, err := Normalize([]string{ChatRead, " posts:* ", ChatRead})
+	if err != nil {
+		t.Fatalf("Normalize failed: %v", err)
+	}
+	if want := []string{ChatRead, "posts:*"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	for _, perm := range []string{"posts:delete", "billing:*", ""} {
+		if _, err := Normalize([]string{perm}); !errors.Is(err, ErrUnknownPermission) {
+			t.Errorf("Normalize(%q): expected ErrUnknownPermission, got %v", perm, err)
+		}
+	}
+}
+
+func TestValidateRoleName(t *testing.T) {
+	for _, name := range []string{"editor", "support-l2", "beta_testers"} {
+		if err := ValidateRoleName(name); err != nil {
+			t.Errorf("ValidateRoleName(%q) failed: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "admin", "Editor", "power user"} {
+		if err := ValidateRoleName(name); !errors.Is(err, ErrInvalidRoleName) {
+			t.Errorf("ValidateRoleName(%q): expected ErrInvalidRoleName, got %v", name, err)
+		}
+	}
+}
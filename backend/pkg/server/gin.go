@@ -14,19 +14,21 @@ import (
 	"github.com/gin-gonic/gin"
 	"social-app/docs"
 	"social-app/internal/connector"
+	"social-app/internal/domains/account"
 	"social-app/internal/routes"
 	"social-app/pkg/ws"
 )
 
 type Server struct {
 	bc      ws.Broadcaster
+	purger  account.Purger
 	rootCtx context.Context
 	root    *gin.Engine
 	srv     *http.Server
 	rc      *connector.RedisConnector
 }
 
-func NewServer(ctx context.Context, router routes.Router, bc ws.Broadcaster, rc *connector.RedisConnector) Server {
+func NewServer(ctx context.Context, router routes.Router, bc ws.Broadcaster, rc *connector.RedisConnector, p account.Purger) Server {
 	r := gin.New()
 	r.MaxMultipartMemory = 8 << 20 // 8 MB
 	docs.SwaggerInfo.BasePath = "/"
@@ -42,6 +44,7 @@ func NewServer(ctx context.Context, router routes.Router, bc ws.Broadcaster, rc
 		rootCtx: ctx,
 		bc:      bc,
 		rc:      rc,
+		purger:  p,
 	}
 }
 
@@ -67,6 +70,12 @@ func (s *Server) Serve() error {
 		s.bc.Start(ctx)
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.purger.Start(ctx)
+	}()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -0,0 +1,110 @@
+package sso
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/oauth2"
+	"social-app/internal/config"
+)
+
+// oauth2Provider covers providers without OpenID Connect, such as GitHub:
+// the profile is read from a userinfo URL with the access token.
+type oauth2Provider struct {
+	oauth *oauth2.Config
+	cfg   config.SsoProvider
+}
+
+type providerEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+func newOAuth2Provider(pc config.SsoProvider) *oauth2Provider {
+	return &oauth2Provider{
+		cfg: pc,
+		oauth: &oauth2.Config{
+			ClientID:     pc.ClientID,
+			ClientSecret: pc.ClientSecret,
+			RedirectURL:  pc.RedirectURL,
+			Scopes:       pc.GetScopes(),
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  pc.AuthURL,
+				TokenURL: pc.TokenURL,
+			},
+		},
+	}
+}
+
+func (p *oauth2Provider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *oauth2Provider) AuthCodeURL(_ context.Context, state string, opts ...oauth2.AuthCodeOption) (string, error) {
+	return p.oauth.AuthCodeURL(state, opts...), nil
+}
+
+func (p *oauth2Provider) Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (Identity, error) {
+	tok, err := p.oauth.Exchange(ctx, code, opts...)
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to exchange OAuth code: %w", err)
+	}
+
+	client := p.oauth.Client(ctx, tok)
+
+	claims := map[string]any{}
+	if err := getJSON(ctx, client, p.cfg.UserInfoURL, &claims); err != nil {
+		return Identity{}, fmt.Errorf("failed to get user info: %w", err)
+	}
+
+	id, err := identity(p.cfg, claims)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	// The profile email may be hidden or unverified: prefer the primary
+	// verified address from the emails endpoint when there is one.
+	if p.cfg.EmailsURL != "" {
+		var emails []providerEmail
+		if err := getJSON(ctx, client, p.cfg.EmailsURL, &emails); err != nil {
+			return Identity{}, fmt.Errorf("failed to get user emails: %w", err)
+		}
+		for _, e := range emails {
+			if e.Primary && e.Verified {
+				id.Email = e.Email
+				id.EmailVerified = true
+				break
+			}
+		}
+	}
+
+	return id, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"social-app/internal/config"
+)
+
+var ErrMissingIDToken = errors.New("provider returned no ID token")
+
+// oidcProvider discovers its endpoints from the issuer on first use, so that
+// an unreachable provider does not prevent the server from starting.
+type oidcProvider struct {
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+	oauth    *oauth2.Config
+	cfg      config.SsoProvider
+	mu       sync.Mutex
+}
+
+func newOIDCProvider(pc config.SsoProvider) *oidcProvider {
+	return &oidcProvider{cfg: pc}
+}
+
+func (p *oidcProvider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, state string, opts ...oauth2.AuthCodeOption) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+	return p.oauth.AuthCodeURL(state, opts...), nil
+}
+
+// Exchange redeems the code and verifies the ID token. Claims missing from
+// the ID token are completed from the userinfo endpoint.
+func (p *oidcProvider) Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (Identity, error) {
+	if err := p.discover(ctx); err != nil {
+		return Identity{}, err
+	}
+
+	tok, err := p.oauth.Exchange(ctx, code, opts...)
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to exchange OAuth code: %w", err)
+	}
+
+	rawIDToken, ok := tok.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return Identity{}, ErrMissingIDToken
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to verify ID token: %w", err)
+	}
+
+	claims := map[string]any{}
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, fmt.Errorf("failed to decode ID token claims: %w", err)
+	}
+
+	if claimString(claims, p.cfg.EmailClaim) == "" && p.provider.UserInfoEndpoint() != "" {
+		info, err := p.provider.UserInfo(ctx, oauth2.StaticTokenSource(tok))
+		if err != nil {
+			return Identity{}, fmt.Errorf("failed to get user info: %w", err)
+		}
+		if info.Subject != idToken.Subject {
+			return Identity{}, fmt.Errorf("user info subject %q does not match ID token", info.Subject)
+		}
+
+		extra := map[string]any{}
+		if err := info.Claims(&extra); err != nil {
+			return Identity{}, fmt.Errorf("failed to decode user info: %w", err)
+		}
+		for k, v := range extra {
+			if _, ok := claims[k]; !ok {
+				claims[k] = v
+			}
+		}
+	}
+
+	return identity(p.cfg, claims)
+}
+
+func (p *oidcProvider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider != nil {
+		return nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.cfg.Issuer)
+	if err != nil {
+		return fmt.Errorf("failed to discover %s: %w", p.cfg.Name, err)
+	}
+
+	p.provider = provider
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+	p.oauth = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       p.cfg.GetScopes(),
+		Endpoint:     provider.Endpoint(),
+	}
+
+	return nil
+}
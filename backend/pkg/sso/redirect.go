@@ -0,0 +1,40 @@
+package sso
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var ErrRedirectNotAllowed = errors.New("redirect target not allowed")
+
+// CheckRedirect validates where the frontend may send the user after login.
+// Relative paths are always accepted; absolute URLs must be on one of the
+// allowed origins. An empty target stays empty.
+func CheckRedirect(target string, allowlist []string) (string, error) {
+	if target == "" {
+		return "", nil
+	}
+
+	// "//host" and "/\host" are protocol-relative in browsers.
+	if strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//") && !strings.ContainsRune(target, '\\') {
+		return target, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return "", ErrRedirectNotAllowed
+	}
+
+	for _, allowed := range allowlist {
+		a, err := url.Parse(allowed)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(a.Scheme, u.Scheme) && strings.EqualFold(a.Host, u.Host) {
+			return u.String(), nil
+		}
+	}
+
+	return "", ErrRedirectNotAllowed
+}
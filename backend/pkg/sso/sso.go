@@ -0,0 +1,195 @@
+package sso
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"golang.org/x/oauth2"
+	"social-app/internal/config"
+)
+
+const (
+	TypeOIDC   = "oidc"
+	TypeOAuth2 = "oauth2"
+
+	googleIssuer = "https://accounts.google.com"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown login provider")
+	ErrMissingSubject  = errors.New("provider returned no subject")
+)
+
+// Identity is the profile of the user at a login provider.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	Name          string
+	Username      string
+	Picture       string
+	EmailVerified bool
+}
+
+// Provider runs the authorization code flow of a login provider.
+type Provider interface {
+	Name() string
+	AuthCodeURL(ctx context.Context, state string, opts ...oauth2.AuthCodeOption) (string, error)
+	Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (Identity, error)
+}
+
+// presets fill in what is always the same for well-known providers.
+var presets = map[string]config.SsoProvider{
+	"github": {
+		Type:          TypeOAuth2,
+		AuthURL:       "https://github.com/login/oauth/authorize",
+		TokenURL:      "https://github.com/login/oauth/access_token",
+		UserInfoURL:   "https://api.github.com/user",
+		EmailsURL:     "https://api.github.com/user/emails",
+		ScopesRaw:     "read:user user:email",
+		SubjectClaim:  "id",
+		UsernameClaim: "login",
+		PictureClaim:  "avatar_url",
+	},
+	"gitlab": {
+		Type:   TypeOIDC,
+		Issuer: "https://gitlab.com",
+	},
+	"google": {
+		Type:   TypeOIDC,
+		Issuer: googleIssuer,
+	},
+}
+
+type Registry struct {
+	providers map[string]Provider
+}
+
+// NewRegistry builds the providers of SSO_PROVIDERS. Google keeps its own
+// SSO_GOOGLE_* settings and is always available.
+func NewRegistry(cfg config.Auth) (*Registry, error) {
+	r := &Registry{providers: make(map[string]Provider)}
+
+	google := config.SsoProvider{
+		Name:         "google",
+		ClientID:     cfg.Sso.Google.ClientID,
+		ClientSecret: cfg.Sso.Google.ClientSecret,
+		RedirectURL:  cfg.Sso.Google.RedirectURL,
+		ScopesRaw:    cfg.Sso.Google.ScopesRaw,
+	}
+
+	for _, pc := range append([]config.SsoProvider{google}, cfg.Sso.Providers...) {
+		p, err := New(pc)
+		if err != nil {
+			return nil, err
+		}
+		r.providers[pc.Name] = p
+	}
+
+	return r, nil
+}
+
+func New(pc config.SsoProvider) (Provider, error) {
+	pc = withDefaults(pc)
+
+	switch pc.Type {
+	case TypeOIDC:
+		if pc.Issuer == "" {
+			return nil, fmt.Errorf("login provider %s: missing issuer", pc.Name)
+		}
+		return newOIDCProvider(pc), nil
+	case TypeOAuth2:
+		if pc.AuthURL == "" || pc.TokenURL == "" || pc.UserInfoURL == "" {
+			return nil, fmt.Errorf("login provider %s: missing auth, token or userinfo URL", pc.Name)
+		}
+		return newOAuth2Provider(pc), nil
+	default:
+		return nil, fmt.Errorf("login provider %s: unsupported type %q", pc.Name, pc.Type)
+	}
+}
+
+func (r *Registry) Get(name string) (Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func withDefaults(pc config.SsoProvider) config.SsoProvider {
+	preset := presets[pc.Name]
+
+	fill := func(v *string, values ...string) {
+		for _, d := range values {
+			if *v == "" {
+				*v = d
+			}
+		}
+	}
+
+	fill(&pc.Type, preset.Type, TypeOIDC)
+	fill(&pc.Issuer, preset.Issuer)
+	fill(&pc.AuthURL, preset.AuthURL)
+	fill(&pc.TokenURL, preset.TokenURL)
+	fill(&pc.UserInfoURL, preset.UserInfoURL)
+	fill(&pc.EmailsURL, preset.EmailsURL)
+	fill(&pc.ScopesRaw, preset.ScopesRaw, "openid email profile")
+	fill(&pc.SubjectClaim, preset.SubjectClaim, "sub")
+	fill(&pc.EmailClaim, preset.EmailClaim, "email")
+	fill(&pc.NameClaim, preset.NameClaim, "name")
+	fill(&pc.UsernameClaim, preset.UsernameClaim, "preferred_username")
+	fill(&pc.PictureClaim, preset.PictureClaim, "picture")
+
+	return pc
+}
+
+// identity maps provider claims to an Identity according to the configured
+// claim names.
+func identity(pc config.SsoProvider, claims map[string]any) (Identity, error) {
+	id := Identity{
+		Provider: pc.Name,
+		Subject:  claimString(claims, pc.SubjectClaim),
+		Email:    claimString(claims, pc.EmailClaim),
+		Name:     claimString(claims, pc.NameClaim),
+		Username: claimString(claims, pc.UsernameClaim),
+		Picture:  claimString(claims, pc.PictureClaim),
+	}
+	if id.Subject == "" {
+		return Identity{}, ErrMissingSubject
+	}
+
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified, _ = strconv.ParseBool(v)
+	}
+
+	return id, nil
+}
+
+func claimString(claims map[string]any, key string) string {
+	switch v := claims[key].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
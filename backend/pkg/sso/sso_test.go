@@ -0,0 +1,326 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"social-app/internal/config"
+)
+
+const (
+	testClientID = "social-app"
+	testCode     = "good-code"
+	testKid      = "test-key"
+)
+
+// mockIssuer is a minimal OpenID Connect provider: discovery, JWKS, token and
+// userinfo endpoints, issuing RS256 ID tokens for a single user.
+type mockIssuer struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	audience string
+	claims   jwt.MapClaims
+	userinfo map[string]any
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	m := &mockIssuer{key: key, audience: testClientID}
+	mux := http.NewServeMux()
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/authorize",
+			"token_endpoint":                        m.URL + "/token",
+			"userinfo_endpoint":                     m.URL + "/userinfo",
+			"jwks_uri":                              m.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": testKid,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != testCode {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss": m.URL,
+			"aud": m.audience,
+			"iat": time.Now().Unix(),
+			"exp": time.Now().Add(time.Minute).Unix(),
+		}
+		for k, v := range m.claims {
+			claims[k] = v
+		}
+
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = testKid
+		idToken, err := tok.SignedString(key)
+		if err != nil {
+			t.Errorf("failed to sign ID token: %v", err)
+		}
+
+		writeJSON(w, map[string]any{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, m.userinfo)
+	})
+
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestProvider(t *testing.T, pc config.SsoProvider) Provider {
+	t.Helper()
+
+	p, err := New(pc)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return p
+}
+
+func TestOIDCProvider(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.claims = jwt.MapClaims{
+		"sub":                "user-1",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"name":               "Alice",
+		"preferred_username": "alice",
+	}
+
+	p := newTestProvider(t, config.SsoProvider{
+		Name:        "keycloak",
+		Issuer:      issuer.URL,
+		ClientID:    testClientID,
+		RedirectURL: "http://localhost:5173/oauth-callback/keycloak",
+	})
+
+	raw, err := p.AuthCodeURL(context.Background(), "some-state")
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+	authURL, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("invalid auth URL %q: %v", raw, err)
+	}
+	if !strings.HasPrefix(raw, issuer.URL+"/authorize") {
+		t.Errorf("Expected the discovered authorization endpoint, got %s", raw)
+	}
+	if got := authURL.Query().Get("state"); got != "some-state" {
+		t.Errorf("Expected state some-state, got %s", got)
+	}
+	if got := authURL.Query().Get("scope"); got != "openid email profile" {
+		t.Errorf("Expected default OIDC scopes, got %s", got)
+	}
+
+	id, err := p.Exchange(context.Background(), testCode)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+
+	want := Identity{
+		Provider:      "keycloak",
+		Subject:       "user-1",
+		Email:         "alice@example.com",
+		Name:          "Alice",
+		Username:      "alice",
+		EmailVerified: true,
+	}
+	if id != want {
+		t.Errorf("Expected %+v, got %+v", want, id)
+	}
+}
+
+func TestOIDCProviderCompletesClaimsFromUserInfo(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.claims = jwt.MapClaims{"sub": "user-2"}
+	issuer.userinfo = map[string]any{
+		"sub":            "user-2",
+		"email":          "bob@example.com",
+		"email_verified": "true",
+		"picture":        "https://example.com/bob.png",
+	}
+
+	p := newTestProvider(t, config.SsoProvider{Name: "gitlab", Issuer: issuer.URL, ClientID: testClientID})
+
+	id, err := p.Exchange(context.Background(), testCode)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if id.Email != "bob@example.com" || !id.EmailVerified || id.Picture != "https://example.com/bob.png" {
+		t.Errorf("Expected claims from userinfo, got %+v", id)
+	}
+}
+
+func TestOIDCProviderRejectsForeignAudience(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.audience = "another-client"
+	issuer.claims = jwt.MapClaims{"sub": "user-3", "email": "carol@example.com"}
+
+	p := newTestProvider(t, config.SsoProvider{Name: "keycloak", Issuer: issuer.URL, ClientID: testClientID})
+
+	if _, err := p.Exchange(context.Background(), testCode); err == nil {
+		t.Fatal("Expected an ID token issued to another client to be rejected")
+	}
+}
+
+func TestOIDCProviderRejectsBadCode(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.claims = jwt.MapClaims{"sub": "user-4"}
+
+	p := newTestProvider(t, config.SsoProvider{Name: "keycloak", Issuer: issuer.URL, ClientID: testClientID})
+
+	if _, err := p.Exchange(context.Background(), "bad-code"); err == nil {
+		t.Fatal("Expected an unknown code to be rejected")
+	}
+}
+
+func TestOAuth2Provider(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"access_token": "gh-token", "token_type": "bearer"})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"id": 9007199254740993, "login": "octocat", "name": "The Octocat", "email": nil})
+	})
+	mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []providerEmail{
+			{Email: "old@example.com", Verified: true},
+			{Email: "octocat@example.com", Primary: true, Verified: true},
+		})
+	})
+
+	p := newTestProvider(t, config.SsoProvider{
+		Name:        "github",
+		ClientID:    testClientID,
+		AuthURL:     srv.URL + "/login/oauth/authorize",
+		TokenURL:    srv.URL + "/login/oauth/access_token",
+		UserInfoURL: srv.URL + "/user",
+		EmailsURL:   srv.URL + "/user/emails",
+	})
+
+	id, err := p.Exchange(context.Background(), testCode)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+
+	want := Identity{
+		Provider:      "github",
+		Subject:       "9007199254740993",
+		Email:         "octocat@example.com",
+		Name:          "The Octocat",
+		Username:      "octocat",
+		EmailVerified: true,
+	}
+	if id != want {
+		t.Errorf("Expected %+v, got %+v", want, id)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r, err := NewRegistry(config.Auth{Sso: config.Sso{
+		Providers: []config.SsoProvider{{Name: "github"}, {Name: "keycloak", Issuer: "https://sso.example.com/realms/social"}},
+	}})
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+
+	if got := strings.Join(r.Names(), ","); got != "github,google,keycloak" {
+		t.Errorf("Expected github,google,keycloak, got %s", got)
+	}
+	if _, err := r.Get("facebook"); err != ErrUnknownProvider {
+		t.Errorf("Expected ErrUnknownProvider, got %v", err)
+	}
+
+	if _, err := NewRegistry(config.Auth{Sso: config.Sso{
+		Providers: []config.SsoProvider{{Name: "custom"}},
+	}}); err == nil {
+		t.Error("Expected an OIDC provider without issuer to be rejected")
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	allowlist := []string{"http://localhost:5173", "https://social.example.com"}
+
+	tests := []struct {
+		target string
+		want   string
+		ok     bool
+	}{
+		{"", "", true},
+		{"/feed", "/feed", true},
+		{"/profile/42?tab=posts", "/profile/42?tab=posts", true},
+		{"https://social.example.com/chat", "https://social.example.com/chat", true},
+		{"http://LOCALHOST:5173/feed", "http://LOCALHOST:5173/feed", true},
+		{"//evil.example.com", "", false},
+		{"/\\evil.example.com", "", false},
+		{"https://evil.example.com/feed", "", false},
+		{"https://social.example.com.evil.com/", "", false},
+		{"http://social.example.com/feed", "", false},
+		{"javascript:alert(1)", "", false},
+		{"https://user@social.example.com/", "", false},
+		{"feed", "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := CheckRedirect(tt.target, allowlist)
+		if tt.ok && (err != nil || got != tt.want) {
+			t.Errorf("CheckRedirect(%q) = %q, %v; expected %q", tt.target, got, err, tt.want)
+		}
+		if !tt.ok && err != ErrRedirectNotAllowed {
+			t.Errorf("CheckRedirect(%q) = %q, %v; expected ErrRedirectNotAllowed", tt.target, got, err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"social-app/internal/connector"
+)
+
+const (
+	jtiKeyPrefix     = "auth:denylist:jti:"
+	sessionKeyPrefix = "auth:denylist:sid:"
+	userKeyPrefix    = "auth:denylist:user:"
+)
+
+// Denylist rejects access tokens before their natural expiry, either one by
+// one through their jti, per session, or all at once for a given user.
+type Denylist struct {
+	redisConn *connector.RedisConnector
+	now       func() time.Time
+}
+
+func NewDenylist(r *connector.RedisConnector) *Denylist {
+	return &Denylist{
+		redisConn: r,
+		now:       time.Now,
+	}
+}
+
+// Revoke denies the token identified by jti until it expires.
+func (d *Denylist) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+
+	if err := d.redisConn.Set(ctx, jtiKeyPrefix+jti, "1", ttl); err != nil {
+		return fmt.Errorf("failed to revoke token %s: %w", jti, err)
+	}
+	return nil
+}
+
+// RevokeSession denies every token carrying the given session ID. The entry
+// only needs to outlive the longest-lived access token, given as ttl.
+func (d *Denylist) RevokeSession(ctx context.Context, sessionID string, ttl time.Duration) error {
+	if sessionID == "" {
+		return nil
+	}
+
+	if err := d.redisConn.Set(ctx, sessionKeyPrefix+sessionID, "1", ttl); err != nil {
+		return fmt.Errorf("failed to revoke session %s: %w", sessionID, err)
+	}
+	return nil
+}
+
+// RevokeUser denies every token issued to the user up to now, to the
+// millisecond, so that a token issued right after is accepted even within
+// the same second. The entry only needs to outlive the longest-lived access
+// token, given as ttl.
+func (d *Denylist) RevokeUser(ctx context.Context, userID uint64, ttl time.Duration) error {
+	now := strconv.FormatInt(d.now().UnixMilli(), 10)
+	if err := d.redisConn.Set(ctx, fmt.Sprintf("%s%d", userKeyPrefix, userID), now, ttl); err != nil {
+		return fmt.Errorf("failed to revoke tokens of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+func (d *Denylist) IsRevoked(ctx context.Context, jti, sessionID string, userID uint64, issuedAt time.Time) (bool, error) {
+	if jti != "" {
+		revoked, err := d.redisConn.IsExists(ctx, jtiKeyPrefix+jti)
+		if err != nil {
+			return false, fmt.Errorf("failed to check token %s: %w", jti, err)
+		}
+		if revoked {
+			return true, nil
+		}
+	}
+
+	if sessionID != "" {
+		revoked, err := d.redisConn.IsExists(ctx, sessionKeyPrefix+sessionID)
+		if err != nil {
+			return false, fmt.Errorf("failed to check session %s: %w", sessionID, err)
+		}
+		if revoked {
+			return true, nil
+		}
+	}
+
+	val, err := d.redisConn.Get(ctx, fmt.Sprintf("%s%d", userKeyPrefix, userID))
+	if err != nil {
+		return false, fmt.Errorf("failed to check tokens of user %d: %w", userID, err)
+	}
+	if val == "" {
+		return false, nil
+	}
+
+	revokedAt, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid revocation time for user %d: %w", userID, err)
+	}
+
+	return issuedAt.UnixMilli() <= revokedAt, nil
+}
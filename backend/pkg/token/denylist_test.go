@@ -0,0 +1,48 @@
+package token
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"social-app/internal/config"
+	"social-app/internal/connector"
+)
+
+// newTestRedis starts a miniredis for the test.
+func newTestRedis(t *testing.T) (*connector.RedisConnector, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	host, port, _ := net.SplitHostPort(mr.Addr())
+	p, _ := strconv.Atoi(port)
+	return connector.NewRedisConnector(config.Redis{Host: host, Port: p}), mr
+}
+
+func TestRevokeUserSameSecond(t *testing.T) {
+	rc, _ := newTestRedis(t)
+	dl := NewDenylist(rc)
+	ctx := context.Background()
+
+	second := time.Unix(1700000000, 0)
+	before := second.Add(100 * time.Millisecond)
+	after := second.Add(300 * time.Millisecond)
+
+	dl.now = func() time.Time { return second.Add(200 * time.Millisecond) }
+	if err := dl.RevokeUser(ctx, 1, time.Minute); err != nil {
+		t.Fatalf("RevokeUser failed: %v", err)
+	}
+
+	if revoked, err := dl.IsRevoked(ctx, "", "", 1, before); err != nil || !revoked {
+		t.Errorf("Expected a token issued before the revocation to be revoked, got %v, %v", revoked, err)
+	}
+	if revoked, err := dl.IsRevoked(ctx, "", "", 1, after); err != nil || revoked {
+		t.Errorf("Expected a token issued after the revocation in the same second to be accepted, got %v, %v", revoked, err)
+	}
+	if revoked, err := dl.IsRevoked(ctx, "", "", 2, before); err != nil || revoked {
+		t.Errorf("Expected the tokens of another user to be accepted, got %v, %v", revoked, err)
+	}
+}
@@ -0,0 +1,431 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"social-app/internal/config"
+	"social-app/internal/connector"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	keyKeyPrefix  = "auth:keys:"
+	keyIDsKey     = "auth:keys:kids"
+	currentKeyKey = "auth:keys:current"
+
+	rsaKeyBits    = 2048
+	sealKeyInfo   = "social-app jwt signing keys"
+	redisTimeout  = 5 * time.Second
+	reloadBackoff = 30 * time.Second
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeyManager signs and verifies tokens. With HS256 the shared JWT secret is
+// used as is; with RS256 or EdDSA, key pairs identified by their kid are kept
+// in Redis so every instance signs with the same current key. A new key is
+// generated once the current one is older than the rotation period, and
+// retired keys stay published until the tokens they signed have expired.
+// Private keys are sealed with AES-GCM before they are written to Redis.
+type KeyManager struct {
+	redisConn   *connector.RedisConnector
+	sealer      *Sealer
+	keys        map[string]signingKey
+	lastReload  time.Time
+	current     string
+	alg         string
+	secret      []byte
+	rotation    time.Duration
+	retention   time.Duration
+	currentExp  time.Time
+	mu          sync.RWMutex
+	rotateMutex sync.Mutex
+}
+
+type signingKey struct {
+	private crypto.Signer
+	kid     string
+}
+
+// storedKey is a key pair as kept in Redis. Sealed is the PKCS8 private key
+// encrypted with AES-GCM, its nonce first.
+type storedKey struct {
+	CreatedAt time.Time `json:"created_at"`
+	Kid       string    `json:"kid"`
+	Alg       string    `json:"alg"`
+	Sealed    string    `json:"sealed"`
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewKeyManager(cfg config.Auth, r *connector.RedisConnector) (*KeyManager, error) {
+	switch cfg.JWTAlg {
+	case AlgHS256, AlgRS256, AlgEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALG %q", cfg.JWTAlg)
+	}
+
+	sealer, err := NewSealer(cfg, sealKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyManager{
+		redisConn: r,
+		sealer:    sealer,
+		keys:      make(map[string]signingKey),
+		alg:       cfg.JWTAlg,
+		secret:    []byte(cfg.JWTSecret),
+		rotation:  cfg.JWTKeyRotationDuration,
+		retention: cfg.RefreshExpDuration,
+	}, nil
+}
+
+func (k *KeyManager) Sign(ctx context.Context, claims jwt.MapClaims) (string, error) {
+	if k.alg == AlgHS256 {
+		ts, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign token: %w", err)
+		}
+		return ts, nil
+	}
+
+	key, err := k.currentKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	tok := jwt.NewWithClaims(jwt.GetSigningMethod(k.alg), claims)
+	tok.Header["kid"] = key.kid
+	ts, err := tok.SignedString(key.private)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return ts, nil
+}
+
+// Keyfunc resolves the verification key of a token for jwt.Parse.
+func (k *KeyManager) Keyfunc(t *jwt.Token) (interface{}, error) {
+	if t.Method.Alg() != k.alg {
+		return nil, jwt.ErrSignatureInvalid
+	}
+
+	if k.alg == AlgHS256 {
+		return k.secret, nil
+	}
+
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrUnknownKey
+	}
+
+	key, ok := k.lookup(kid)
+	if !ok {
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		defer cancel()
+
+		if err := k.reloadIfStale(ctx); err != nil {
+			return nil, err
+		}
+		if key, ok = k.lookup(kid); !ok {
+			return nil, ErrUnknownKey
+		}
+	}
+
+	return key.private.Public(), nil
+}
+
+func (k *KeyManager) JWKS(ctx context.Context) (JWKSet, error) {
+	set := JWKSet{Keys: []JWK{}}
+	if k.alg == AlgHS256 {
+		return set, nil
+	}
+
+	if err := k.reload(ctx); err != nil {
+		return set, err
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		jwk, err := publicJWK(key.kid, k.alg, key.private.Public())
+		if err != nil {
+			return set, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set, nil
+}
+
+func (k *KeyManager) lookup(kid string) (signingKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func (k *KeyManager) currentKey(ctx context.Context) (signingKey, error) {
+	k.mu.RLock()
+	key, ok := k.keys[k.current]
+	fresh := time.Now().Before(k.currentExp)
+	k.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+
+	if err := k.rotate(ctx); err != nil {
+		return signingKey{}, err
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok = k.keys[k.current]
+	if !ok {
+		return signingKey{}, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// rotate makes sure a current key exists in Redis, generating one when the
+// previous key has reached the end of its rotation period.
+func (k *KeyManager) rotate(ctx context.Context) error {
+	k.rotateMutex.Lock()
+	defer k.rotateMutex.Unlock()
+
+	kid, err := k.redisConn.Get(ctx, currentKeyKey)
+	if err != nil {
+		return fmt.Errorf("failed to get current signing key: %w", err)
+	}
+
+	if kid == "" {
+		kid, err = k.generate(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := k.reload(ctx); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.current = kid
+	k.currentExp = time.Now().Add(reloadBackoff)
+	return nil
+}
+
+func (k *KeyManager) generate(ctx context.Context) (string, error) {
+	private, err := generateKey(k.alg)
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode signing key: %w", err)
+	}
+
+	kid := uuid.NewString()
+	sealed, err := k.sealer.Seal(kid, der)
+	if err != nil {
+		return "", fmt.Errorf("failed to seal signing key: %w", err)
+	}
+	raw, err := json.Marshal(storedKey{
+		Kid:       kid,
+		Alg:       k.alg,
+		Sealed:    sealed,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode signing key: %w", err)
+	}
+
+	if err := k.redisConn.Set(ctx, keyKeyPrefix+kid, string(raw), k.rotation+k.retention); err != nil {
+		return "", fmt.Errorf("failed to save signing key: %w", err)
+	}
+	if err := k.redisConn.SAdd(ctx, keyIDsKey, kid); err != nil {
+		return "", fmt.Errorf("failed to index signing key: %w", err)
+	}
+
+	won, err := k.redisConn.SetNX(ctx, currentKeyKey, kid, k.rotation)
+	if err != nil {
+		return "", fmt.Errorf("failed to promote signing key: %w", err)
+	}
+	if won {
+		log.Printf("[JWT] Rotated signing key, new kid %s", kid)
+		return kid, nil
+	}
+
+	// Another instance rotated concurrently, drop ours and use theirs.
+	if err := k.redisConn.Delete(ctx, keyKeyPrefix+kid); err != nil {
+		return "", fmt.Errorf("failed to drop signing key: %w", err)
+	}
+	if err := k.redisConn.SRem(ctx, keyIDsKey, kid); err != nil {
+		return "", fmt.Errorf("failed to drop signing key: %w", err)
+	}
+
+	current, err := k.redisConn.Get(ctx, currentKeyKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to get current signing key: %w", err)
+	}
+	return current, nil
+}
+
+func (k *KeyManager) reloadIfStale(ctx context.Context) error {
+	k.mu.RLock()
+	stale := time.Since(k.lastReload) > reloadBackoff
+	k.mu.RUnlock()
+
+	if !stale {
+		return nil
+	}
+	return k.reload(ctx)
+}
+
+func (k *KeyManager) reload(ctx context.Context) error {
+	kids, err := k.redisConn.SMembers(ctx, keyIDsKey)
+	if err != nil {
+		return fmt.Errorf("failed to list signing keys: %w", err)
+	}
+
+	keys := make(map[string]signingKey, len(kids))
+	for _, kid := range kids {
+		raw, err := k.redisConn.Get(ctx, keyKeyPrefix+kid)
+		if err != nil {
+			return fmt.Errorf("failed to get signing key %s: %w", kid, err)
+		}
+		if raw == "" {
+			if err := k.redisConn.SRem(ctx, keyIDsKey, kid); err != nil {
+				return fmt.Errorf("failed to prune signing key %s: %w", kid, err)
+			}
+			continue
+		}
+
+		key, err := k.decodeKey(raw)
+		if err != nil {
+			return err
+		}
+		if key.kid == "" {
+			continue
+		}
+		keys[key.kid] = key
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys = keys
+	k.lastReload = time.Now()
+	return nil
+}
+
+func (k *KeyManager) decodeKey(raw string) (signingKey, error) {
+	var sk storedKey
+	if err := json.Unmarshal([]byte(raw), &sk); err != nil {
+		return signingKey{}, fmt.Errorf("failed to decode signing key: %w", err)
+	}
+
+	if sk.Sealed == "" {
+		return signingKey{}, fmt.Errorf("signing key %s is not sealed", sk.Kid)
+	}
+
+	der, err := k.sealer.Open(sk.Kid, sk.Sealed)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("failed to decode signing key %s: %w", sk.Kid, err)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("failed to parse signing key %s: %w", sk.Kid, err)
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return signingKey{}, fmt.Errorf("signing key %s is not a signer", sk.Kid)
+	}
+
+	return signingKey{kid: sk.Kid, private: private}, nil
+}
+
+func generateKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate RSA key: %w", err)
+		}
+		return key, nil
+	case AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate Ed25519 key: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("no key pair for algorithm %s", alg)
+	}
+}
+
+func publicJWK(kid, alg string, pub crypto.PublicKey) (JWK, error) {
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: alg,
+			Kid: kid,
+			N:   base64.RawURLEncoding.EncodeToString(p.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Use: "sig",
+			Alg: alg,
+			Kid: kid,
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(p),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
@@ -0,0 +1,197 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"social-app/internal/config"
+	"social-app/internal/connector"
+)
+
+func newTestKeyManager(t *testing.T, rc *connector.RedisConnector, alg, secret string) *KeyManager {
+	t.Helper()
+
+	km, err := NewKeyManager(config.Auth{
+		JWTAlg:                 alg,
+		JWTSecret:              secret,
+		JWTKeyRotationDuration: time.Hour,
+		RefreshExpDuration:     24 * time.Hour,
+	}, rc)
+	if err != nil {
+		t.Fatalf("NewKeyManager failed: %v", err)
+	}
+	return km
+}
+
+func sign(t *testing.T, km *KeyManager) string {
+	t.Helper()
+
+	ts, err := km.Sign(context.Background(), jwt.MapClaims{"sub": "1", "exp": time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	return ts
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, alg := range []string{AlgHS256, AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			rc, _ := newTestRedis(t)
+			km := newTestKeyManager(t, rc, alg, "secret")
+
+			tok, err := jwt.Parse(sign(t, km), km.Keyfunc)
+			if err != nil || !tok.Valid {
+				t.Fatalf("Expected a valid token, got %v", err)
+			}
+			if tok.Method.Alg() != alg {
+				t.Errorf("Expected %s, got %s", alg, tok.Method.Alg())
+			}
+		})
+	}
+}
+
+func TestKeyfuncRejectsOtherAlgorithm(t *testing.T) {
+	rc, _ := newTestRedis(t)
+	hs := newTestKeyManager(t, rc, AlgHS256, "secret")
+	ed := newTestKeyManager(t, rc, AlgEdDSA, "secret")
+
+	// A token signed with the shared secret must not pass for an asymmetric
+	// one, and the other way round.
+	if _, err := jwt.Parse(sign(t, hs), ed.Keyfunc); !errors.Is(err, jwt.ErrSignatureInvalid) {
+		t.Errorf("Expected an HS256 token to be rejected by EdDSA, got %v", err)
+	}
+	if _, err := jwt.Parse(sign(t, ed), hs.Keyfunc); !errors.Is(err, jwt.ErrSignatureInvalid) {
+		t.Errorf("Expected an EdDSA token to be rejected by HS256, got %v", err)
+	}
+}
+
+func TestKeyfuncUnknownKid(t *testing.T) {
+	rc, _ := newTestRedis(t)
+	km := newTestKeyManager(t, rc, AlgEdDSA, "secret")
+	sign(t, km)
+
+	key, err := km.currentKey(context.Background())
+	if err != nil {
+		t.Fatalf("currentKey failed: %v", err)
+	}
+	for _, kid := range []string{"", "unknown"} {
+		tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"sub": "1"})
+		if kid != "" {
+			tok.Header["kid"] = kid
+		}
+		ts, err := tok.SignedString(key.private)
+		if err != nil {
+			t.Fatalf("SignedString failed: %v", err)
+		}
+		if _, err := jwt.Parse(ts, km.Keyfunc); !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("Expected ErrUnknownKey for kid %q, got %v", kid, err)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rc, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	hs := newTestKeyManager(t, rc, AlgHS256, "secret")
+	if set, err := hs.JWKS(ctx); err != nil || len(set.Keys) != 0 {
+		t.Errorf("Expected no published key for HS256, got %v, %v", set, err)
+	}
+
+	rs := newTestKeyManager(t, rc, AlgRS256, "secret")
+	tok, _ := jwt.Parse(sign(t, rs), rs.Keyfunc)
+	set, err := rs.JWKS(ctx)
+	if err != nil {
+		t.Fatalf("JWKS failed: %v", err)
+	}
+	if len(set.Keys) != 1 {
+		t.Fatalf("Expected one key, got %d", len(set.Keys))
+	}
+	jwk := set.Keys[0]
+	if jwk.Kid != tok.Header["kid"] || jwk.Kty != "RSA" || jwk.Alg != AlgRS256 || jwk.Use != "sig" || jwk.E != "AQAB" || jwk.N == "" {
+		t.Errorf("Unexpected JWK %+v", jwk)
+	}
+}
+
+func TestRotationKeepsPreviousKey(t *testing.T) {
+	rc, mr := newTestRedis(t)
+	ctx := context.Background()
+	km := newTestKeyManager(t, rc, AlgEdDSA, "secret")
+
+	old := sign(t, km)
+
+	// The current key reaches the end of its rotation period.
+	mr.FastForward(time.Hour + time.Second)
+	km.mu.Lock()
+	km.currentExp = time.Time{}
+	km.mu.Unlock()
+
+	fresh := sign(t, km)
+
+	oldTok, err := jwt.Parse(old, km.Keyfunc)
+	if err != nil {
+		t.Fatalf("Expected the token of the previous key to stay valid, got %v", err)
+	}
+	freshTok, err := jwt.Parse(fresh, km.Keyfunc)
+	if err != nil {
+		t.Fatalf("Expected the token of the new key to be valid, got %v", err)
+	}
+	if oldTok.Header["kid"] == freshTok.Header["kid"] {
+		t.Fatal("Expected a new key after rotation")
+	}
+
+	// Another instance that never saw the previous key loads it from Redis.
+	other := newTestKeyManager(t, rc, AlgEdDSA, "secret")
+	if _, err := jwt.Parse(old, other.Keyfunc); err != nil {
+		t.Errorf("Expected another instance to verify the previous key, got %v", err)
+	}
+
+	set, err := km.JWKS(ctx)
+	if err != nil {
+		t.Fatalf("JWKS failed: %v", err)
+	}
+	if len(set.Keys) != 2 {
+		t.Errorf("Expected both keys to be published, got %d", len(set.Keys))
+	}
+}
+
+func TestKeysAreSealed(t *testing.T) {
+	rc, mr := newTestRedis(t)
+	km := newTestKeyManager(t, rc, AlgEdDSA, "secret")
+	tok, _ := jwt.Parse(sign(t, km), km.Keyfunc)
+
+	raw, err := mr.Get(keyKeyPrefix + tok.Header["kid"].(string))
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if strings.Contains(raw, `"private"`) || !strings.Contains(raw, `"sealed"`) {
+		t.Errorf("Expected the private key to be sealed, got %s", raw)
+	}
+
+	// Without the secret the stored keys cannot be read.
+	other := newTestKeyManager(t, rc, AlgEdDSA, "another secret")
+	if _, err := other.JWKS(context.Background()); err == nil {
+		t.Error("Expected the keys to fail to unseal with another secret")
+	}
+}
+
+func TestUnsealedKeyIsRejected(t *testing.T) {
+	rc, mr := newTestRedis(t)
+	km := newTestKeyManager(t, rc, AlgEdDSA, "secret")
+
+	// An entry holding the private key in clear text is never loaded.
+	if err := mr.Set(keyKeyPrefix+"plain", `{"kid":"plain","alg":"EdDSA","private":"MC4CAQAwBQYDK2VwBCIEIA=="}`); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := mr.SAdd(keyIDsKey, "plain"); err != nil {
+		t.Fatalf("SAdd failed: %v", err)
+	}
+
+	if _, err := km.JWKS(context.Background()); err == nil || !strings.Contains(err.Error(), "not sealed") {
+		t.Errorf("Expected the unsealed key to be rejected, got %v", err)
+	}
+}
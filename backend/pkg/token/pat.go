@@ -0,0 +1,45 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// PATPrefix starts every personal access token, which tells them apart from
+// JWTs and makes them easy to spot in logs and secret scanners.
+const PATPrefix = "sapat_"
+
+// patDisplayLen is how much of a token is kept to let users recognize it.
+const patDisplayLen = len(PATPrefix) + 6
+
+// NewPAT generates a personal access token. Only its hash is meant to be
+// stored; the token itself is shown once to the user.
+func NewPAT() (raw, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate personal access token: %w", err)
+	}
+	raw = PATPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return raw, HashPAT(raw), nil
+}
+
+func IsPAT(raw string) bool {
+	return strings.HasPrefix(raw, PATPrefix)
+}
+
+func HashPAT(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// PATDisplay returns the beginning of a token, safe to show in listings.
+func PATDisplay(raw string) string {
+	if len(raw) < patDisplayLen {
+		return raw
+	}
+	return raw[:patDisplayLen]
+}
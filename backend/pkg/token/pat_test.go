@@ -0,0 +1,44 @@
+package token
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewPAT(t *testing.T) {
+	raw, hash, err := NewPAT()
+	if err != nil {
+		t.Fatalf("NewPAT failed: %v", err)
+	}
+
+	if !IsPAT(raw) {
+		t.Errorf("Expected %q to be a personal access token", raw)
+	}
+	if hash != HashPAT(raw) {
+		t.Errorf("Expected hash %q, got %q", HashPAT(raw), hash)
+	}
+	if strings.Contains(hash, raw) || len(hash) != 64 {
+		t.Errorf("Expected a sha256 hex hash, got %q", hash)
+	}
+
+	other, _, err := NewPAT()
+	if err != nil {
+		t.Fatalf("NewPAT failed: %v", err)
+	}
+	if other == raw {
+		t.Error("Expected two tokens to differ")
+	}
+
+	if display := PATDisplay(raw); !strings.HasPrefix(raw, display) || len(display) != len(PATPrefix)+6 {
+		t.Errorf("Unexpected display %q for %q", display, raw)
+	}
+}
+
+func TestIsPAT(t *testing.T) {
+	if IsPAT("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Error("Expected a JWT not to be a personal access token")
+	}
+	if IsPAT("") {
+		t.Error("Expected an empty string not to be a personal access token")
+	}
+}
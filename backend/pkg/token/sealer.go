@@ -0,0 +1,82 @@
+package token
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"social-app/internal/config"
+)
+
+// secretSealInfo is the info of the key that seals the secrets of users,
+// such as their TOTP seed.
+const secretSealInfo = "social-app user secrets"
+
+// Sealer encrypts secrets kept at rest with AES-GCM. Its key is derived from
+// JWT_KEY_ENCRYPTION_KEY, or from JWT_SECRET when it is not set, with an
+// info string of its own so that every use gets a different key.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+func NewSealer(cfg config.Auth, info string) (*Sealer, error) {
+	secret := cfg.JWTKeyEncryptionKey
+	if secret == "" {
+		secret = cfg.JWTSecret
+	}
+	if secret == "" {
+		return nil, errors.New("JWT_KEY_ENCRYPTION_KEY or JWT_SECRET is required to seal secrets")
+	}
+
+	key, err := hkdf.Key(sha256.New, []byte(secret), nil, info, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key encryption key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key cipher: %w", err)
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// NewSecretSealer returns the Sealer of the secrets of users.
+func NewSecretSealer(cfg config.Auth) (*Sealer, error) {
+	return NewSealer(cfg, secretSealInfo)
+}
+
+// Seal encrypts plaintext into base64, its nonce first. The owner is
+// authenticated with it, so a sealed secret cannot be moved to another
+// entry.
+func (s *Sealer) Seal(owner string, plaintext []byte) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to seal: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(s.aead.Seal(nonce, nonce, plaintext, []byte(owner))), nil
+}
+
+// Open decrypts what Seal returned for the same owner.
+func (s *Sealer) Open(owner, sealed string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	size := s.aead.NonceSize()
+	if len(raw) < size {
+		return nil, errors.New("sealed secret too short")
+	}
+	plaintext, err := s.aead.Open(nil, raw[:size], raw[size:], []byte(owner))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal: %w", err)
+	}
+	return plaintext, nil
+}
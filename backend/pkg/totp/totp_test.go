@@ -0,0 +1,52 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238, appendix B (SHA1).
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, v := range vectors {
+		got := hotp(key, counter(time.Unix(v.unix, 0)), 8)
+		if got != v.code {
+			t.Errorf("At %d: expected %s, got %s", v.unix, v.code, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret failed: %v", err)
+	}
+
+	now := time.Now()
+	code, err := Code(secret, now.Add(-Period))
+	if err != nil {
+		t.Fatalf("Code failed: %v", err)
+	}
+
+	if _, ok := Validate(secret, code, now, 1); !ok {
+		t.Error("Expected code from previous step to be accepted with skew 1")
+	}
+	if _, ok := Validate(secret, code, now, 0); ok {
+		t.Error("Expected code from previous step to be rejected without skew")
+	}
+	if _, ok := Validate(secret, "000000x", now, 1); ok {
+		t.Error("Expected malformed code to be rejected")
+	}
+}
@@ -4,12 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"log"
-
-	"github.com/gorilla/websocket"
 )
 
-var broadcast = make(chan string)
-
+// Broadcaster relays Redis pub/sub messages to the sockets of this node:
+// deliveries published to the node's channel by Connector.Send on other
+// nodes, close orders of CloseClient and CloseSession, and NotifyAll and
+// Publish messages published by any node.
 type Broadcaster struct {
 	conn *Connector
 }
@@ -21,43 +21,94 @@ func NewBroadcaster(c *Connector) Broadcaster {
 }
 
 func (b Broadcaster) Start(ctx context.Context) {
+	ps, err := b.conn.redisConn.Subscribe(ctx, BroadcastChannel, TopicChannel, NodeChannelPrefix+b.conn.nodeID)
+	if err != nil {
+		log.Printf("Broadcaster failed to subscribe: %v", err)
+		return
+	}
+
 	go func() {
+		defer func() {
+			if err := ps.Close(); err != nil {
+				log.Printf("Error closing subscription: %v", err)
+			}
+		}()
+
+		messages := ps.Channel()
 		for {
 			select {
 			case <-ctx.Done():
-				err := b.conn.closeAll(ctx)
+				err := b.conn.closeAll(context.Background())
 				if err != nil {
 					log.Printf("Error closing all clients: %v", err)
 					return
 				}
 				log.Println("Broadcaster stopped by context cancellation")
 				return
-			case msg := <-broadcast:
-				for idx := range b.conn.Clients {
-					if b.conn.Clients[idx] == nil {
-						log.Printf("Client %d is nil, skipping", idx)
-						continue
-					}
-					err := b.conn.Clients[idx].WriteMessage(websocket.TextMessage, []byte(msg))
-					if err != nil {
-						log.Printf("Error sending message to client %d: %v", idx, err)
-						if err := b.conn.CloseClient(ctx, idx); err != nil {
-							log.Printf("Error closing client %d: %v", idx, err)
-							return
-						}
-						log.Printf("Client %d removed due to error", idx)
-					}
+			case msg, ok := <-messages:
+				if !ok {
+					log.Println("Broadcaster subscription closed")
+					return
 				}
+				b.relay(msg.Channel, []byte(msg.Payload))
 			}
 		}
 	}()
 }
 
+func (b Broadcaster) relay(channel string, payload []byte) {
+	if channel == BroadcastChannel {
+		if len(b.conn.sockets(0)) == 0 {
+			return
+		}
+		if err := b.conn.deliver(0, payload); err != nil {
+			log.Printf("Error broadcasting message: %v", err)
+		}
+		return
+	}
+
+	if channel == TopicChannel {
+		var m topicMessage
+		if err := json.Unmarshal(payload, &m); err != nil {
+			log.Printf("Invalid topic message: %v", err)
+			return
+		}
+		b.conn.deliverTopic(m.Topic, m.Data)
+		return
+	}
+
+	var d delivery
+	if err := json.Unmarshal(payload, &d); err != nil {
+		log.Printf("Invalid delivery on %s: %v", channel, err)
+		return
+	}
+	if d.Close != "" {
+		if err := b.conn.closeClients(context.Background(), d.UserID, closeMatch(d.Close)); err != nil {
+			log.Printf("Error closing sockets of user %d: %v", d.UserID, err)
+		}
+		return
+	}
+	if err := b.conn.deliver(d.UserID, d.Data); err != nil {
+		log.Printf("Error delivering message to user %d: %v", d.UserID, err)
+	}
+}
+
+// NotifyAll sends the message to every connected user, on every node.
 func (b Broadcaster) NotifyAll(message string) {
-	msgJon, err := json.Marshal(map[string]string{"message": message})
+	msgJon, err := eventFrame(map[string]string{"message": message}, 0)
 	if err != nil {
 		log.Printf("Error marshalling message: %v", err)
 		return
 	}
-	broadcast <- string(msgJon)
+	if err := b.conn.redisConn.Publish(context.Background(), BroadcastChannel, msgJon); err != nil {
+		log.Printf("Error publishing message: %v", err)
+	}
+}
+
+// Publish sends an event of the given type to the sockets subscribed to the
+// topic, on every node. data is the entity the event is about.
+func (b Broadcaster) Publish(topic, eventType string, data any) {
+	if err := b.conn.publishTopic(context.Background(), topic, eventType, data); err != nil {
+		log.Printf("Error publishing to topic %s: %v", topic, err)
+	}
 }
@@ -2,9 +2,13 @@ package ws
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,77 +20,210 @@ import (
 const (
 	UserKeyPrefix   = "ws:user:"
 	SocketKeyPrefix = "ws:socket:"
-	ttlTimeout      = 15 * time.Minute
+	// ttlTimeout is how long presence lasts without news of the socket. Pongs
+	// refresh it, so only sockets of a node that went away expire.
+	ttlTimeout = 3 * pongWait
+
+	// NodeChannelPrefix is followed by a node ID: the node delivers what is
+	// published there to its own sockets.
+	NodeChannelPrefix = "ws:node:"
+	// BroadcastChannel reaches every socket of every node.
+	BroadcastChannel = "ws:broadcast"
 )
 
+// Connector keeps the sockets of the users connected to this process, by
+// user ID then socket ID. Each process is a node with its own random ID. In
+// Redis, ws:user:<id> is the set of the user's sockets as "<node>:<socket>",
+// so the user is online until their last socket closes and any node knows
+// which nodes to publish to. A member only counts while its ws:socket:<id>
+// key lives: the sockets of a node that went away expire one by one and are
+// pruned from the set.
 type Connector struct {
-	Clients      map[uint64]*websocket.Conn
+	Clients      map[uint64]map[string]*Client
 	redisConn    *connector.RedisConnector
+	nodeID       string
 	Upgrader     websocket.Upgrader
 	ClientsMutex sync.RWMutex
 }
 
 func NewConnector(r *connector.RedisConnector) *Connector {
 	return &Connector{
-		Clients:      make(map[uint64]*websocket.Conn),
+		Clients:      make(map[uint64]map[string]*Client),
 		ClientsMutex: sync.RWMutex{},
 		Upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool { return true },
 		},
 		redisConn: r,
+		nodeID:    uuid.NewString(),
 	}
 }
 
-func (c *Connector) ConnectClient(r *http.Request, w http.ResponseWriter, userID uint64) (*websocket.Conn, string, error) {
+// NodeID identifies this process among the replicas sharing Redis.
+func (c *Connector) NodeID() string {
+	return c.nodeID
+}
+
+func (c *Connector) ConnectClient(r *http.Request, w http.ResponseWriter, userID uint64, sessionID string, perms []string) (*Client, error) {
 	conn, err := c.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		return nil, "", fmt.Errorf("upgrade error: %w", err)
+		return nil, fmt.Errorf("upgrade error: %w", err)
 	}
 
-	socketID := uuid.NewString()
-	if err := c.ReplaceClient(userID, conn); err != nil {
-		return nil, "", err
-	}
+	client := newClient(conn, uuid.NewString(), sessionID, userID, perms)
+	// The events that arrive before the resume of the client follow its
+	// replay. A client that does not resume gets them after resumeWait.
+	hold := client.hold()
+	time.AfterFunc(resumeWait, func() { client.release(hold, 0) })
+	conn.SetReadLimit(maxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		c.touch(client)
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	c.addClient(client)
+	go client.writePump()
 
-	userKey := fmt.Sprintf("%s%d", UserKeyPrefix, userID)
-	socketKey := fmt.Sprintf("%s%s", SocketKeyPrefix, socketID)
+	if err := c.register(r.Context(), client); err != nil {
+		if closeErr := c.CloseSocket(context.Background(), userID, client.ID); closeErr != nil {
+			return nil, fmt.Errorf("%w (close error: %v)", err, closeErr)
+		}
+		return nil, err
+	}
+	return client, nil
+}
 
-	if err := c.redisConn.Set(r.Context(), userKey, socketID, ttlTimeout); err != nil {
-		return nil, "", fmt.Errorf("redis set user→socket error: %w", err)
+// register adds the socket to the presence of its user in Redis.
+func (c *Connector) register(ctx context.Context, client *Client) error {
+	userKey := userKey(client.UserID)
+	if err := c.redisConn.SAdd(ctx, userKey, c.member(client.ID)); err != nil {
+		return fmt.Errorf("redis add user→socket error: %w", err)
+	}
+	if err := c.redisConn.Expire(ctx, userKey, ttlTimeout); err != nil {
+		return fmt.Errorf("redis expire user→socket error: %w", err)
 	}
-	if err := c.redisConn.Set(r.Context(), socketKey, fmt.Sprintf("%d", userID), ttlTimeout); err != nil {
-		return nil, "", fmt.Errorf("redis set socket→user error: %w", err)
+	if err := c.redisConn.Set(ctx, socketKey(client.ID), strconv.FormatUint(client.UserID, 10), ttlTimeout); err != nil {
+		return fmt.Errorf("redis set socket→user error: %w", err)
+	}
+	return nil
+}
+
+func (c *Connector) addClient(client *Client) {
+	c.ClientsMutex.Lock()
+	defer c.ClientsMutex.Unlock()
+
+	if c.Clients[client.UserID] == nil {
+		c.Clients[client.UserID] = make(map[string]*Client)
 	}
+	c.Clients[client.UserID][client.ID] = client
+}
 
-	return conn, socketID, nil
+// CloseSocket closes one socket of the user, on this node.
+func (c *Connector) CloseSocket(ctx context.Context, userID uint64, socketID string) error {
+	return c.closeClients(ctx, userID, func(client *Client) bool {
+		return client.ID == socketID
+	})
 }
 
+// CloseClient closes every socket of the user, on every node.
 func (c *Connector) CloseClient(ctx context.Context, userID uint64) error {
-	id, _, err := c.redisConn.DeleteIfExists(ctx, fmt.Sprintf("%s%d", UserKeyPrefix, userID))
+	return c.closeEverywhere(ctx, userID, closeAll)
+}
+
+// CloseSession closes the sockets of the user opened with the given session,
+// on every node.
+func (c *Connector) CloseSession(ctx context.Context, userID uint64, sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	return c.closeEverywhere(ctx, userID, sessionID)
+}
+
+// closeEverywhere closes the sockets of the user matching target, closeAll
+// or a session ID, here and, through their channel, on the other nodes the
+// user is connected to.
+func (c *Connector) closeEverywhere(ctx context.Context, userID uint64, target string) error {
+	closeErr := c.closeClients(ctx, userID, closeMatch(target))
+
+	nodes, err := c.nodes(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("redis delete error: %w", err)
+		return err
 	}
-	if id != "" {
-		_, _, err := c.redisConn.DeleteIfExists(ctx, fmt.Sprintf("%s%s", SocketKeyPrefix, id))
-		if err != nil {
-			return fmt.Errorf("redis delete error: %w", err)
+	for node := range nodes {
+		if node == c.nodeID {
+			continue
+		}
+		if err := c.publish(ctx, node, delivery{Close: target, UserID: userID}); err != nil {
+			return err
 		}
 	}
+	return closeErr
+}
 
+// closeMatch selects the sockets a close order is about.
+func closeMatch(target string) func(*Client) bool {
+	if target == closeAll {
+		return func(*Client) bool { return true }
+	}
+	return func(client *Client) bool {
+		return client.SessionID == target
+	}
+}
+
+func (c *Connector) closeClients(ctx context.Context, userID uint64, match func(*Client) bool) error {
 	c.ClientsMutex.Lock()
-	defer c.ClientsMutex.Unlock()
+	var closing []*Client
+	for id, client := range c.Clients[userID] {
+		if match(client) {
+			closing = append(closing, client)
+			delete(c.Clients[userID], id)
+		}
+	}
+	if len(c.Clients[userID]) == 0 {
+		delete(c.Clients, userID)
+	}
+	c.ClientsMutex.Unlock()
 
-	conn, ok := c.Clients[userID]
-	if !ok || conn == nil {
+	if len(closing) == 0 {
 		log.Printf("No active connection for user %d", userID)
 		return nil
 	}
-	delete(c.Clients, userID)
 
-	if err := conn.Close(); err != nil {
-		return fmt.Errorf("close error: %w", err)
+	// The sockets are closed even when Redis fails: their presence expires
+	// with ttlTimeout anyway.
+	var closeErr error
+	for _, client := range closing {
+		if err := c.forget(ctx, client); err != nil && closeErr == nil {
+			closeErr = err
+		}
+		if err := client.close(); err != nil && closeErr == nil {
+			closeErr = fmt.Errorf("close error: %w", err)
+		}
 	}
+	return closeErr
+}
+
+// touch extends the presence of the socket and of its user.
+func (c *Connector) touch(client *Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), writeWait)
+	defer cancel()
 
+	if err := c.redisConn.Expire(ctx, userKey(client.UserID), ttlTimeout); err != nil {
+		log.Printf("[WS] Failed to refresh presence of user %d: %v", client.UserID, err)
+	}
+	if err := c.redisConn.Expire(ctx, socketKey(client.ID), ttlTimeout); err != nil {
+		log.Printf("[WS] Failed to refresh socket %s: %v", client.ID, err)
+	}
+}
+
+// forget removes the socket from the user's presence in Redis. The set key
+// goes away with its last member.
+func (c *Connector) forget(ctx context.Context, client *Client) error {
+	if err := c.redisConn.SRem(ctx, userKey(client.UserID), c.member(client.ID)); err != nil {
+		return fmt.Errorf("redis remove error: %w", err)
+	}
+	if err := c.redisConn.Delete(ctx, socketKey(client.ID)); err != nil {
+		return fmt.Errorf("redis delete error: %w", err)
+	}
 	return nil
 }
 
@@ -94,61 +231,224 @@ func (c *Connector) closeAll(ctx context.Context) error {
 	c.ClientsMutex.Lock()
 	defer c.ClientsMutex.Unlock()
 
-	for userID, conn := range c.Clients {
-		if conn != nil {
-			if err := conn.Close(); err != nil {
-				log.Printf("Error closing connection for user %d: %v", userID, err)
+	for userID, sockets := range c.Clients {
+		for _, client := range sockets {
+			if err := client.close(); err != nil {
+				log.Printf("Error closing socket %s of user %d: %v", client.ID, userID, err)
+			}
+			if err := c.forget(ctx, client); err != nil {
+				return err
 			}
 		}
+	}
+	c.Clients = make(map[uint64]map[string]*Client)
+	return nil
+}
 
-		id, _, err := c.redisConn.DeleteIfExists(ctx, fmt.Sprintf("%s%d", UserKeyPrefix, userID))
-		if err != nil {
-			return fmt.Errorf("redis delete error: %w", err)
+// sockets returns the sockets of the user, or of every user when userID is 0.
+func (c *Connector) sockets(userID uint64) []*Client {
+	c.ClientsMutex.RLock()
+	defer c.ClientsMutex.RUnlock()
+
+	var out []*Client
+	for id, sockets := range c.Clients {
+		if userID != 0 && id != userID {
+			continue
 		}
-		if id != "" {
-			_, _, err := c.redisConn.DeleteIfExists(ctx, fmt.Sprintf("%s%s", SocketKeyPrefix, id))
-			if err != nil {
-				return fmt.Errorf("redis delete error: %w", err)
-			}
+		for _, client := range sockets {
+			out = append(out, client)
 		}
 	}
-	c.Clients = make(map[uint64]*websocket.Conn)
-	return nil
+	return out
+}
+
+var errNoConnection = errors.New("no connection for user")
+
+// closeAll is the close order for every socket of a user.
+const closeAll = "*"
+
+// delivery is what a node publishes to another node for one of its users:
+// data for their sockets or, with Close set, an order to close those of a
+// session, or all of them with closeAll.
+type delivery struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Close  string          `json:"close,omitempty"`
+	UserID uint64          `json:"user_id"`
 }
 
+// Send writes notif in an event frame to every socket of the user, on
+// whichever nodes they are connected to. The event is first added to the
+// user's event log, so a user who is not connected gets it on resume: Send
+// only fails when the event is neither logged nor delivered.
 func (c *Connector) Send(userID uint64, notif any) error {
-	c.ClientsMutex.Lock()
-	conn, ok := c.Clients[userID]
-	c.ClientsMutex.Unlock()
+	ctx := context.Background()
+
+	payload, err := json.Marshal(notif)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message to user %d: %w", userID, err)
+	}
 
-	if !ok || conn == nil {
-		return fmt.Errorf("no connection for user %d", userID)
+	seq, logErr := c.logEvent(ctx, userID, payload)
+	if logErr != nil {
+		log.Printf("[WS] Failed to log event for user %d: %v", userID, logErr)
 	}
 
-	if err := conn.WriteJSON(notif); err != nil {
-		return fmt.Errorf("failed to write JSON to user %d: %w", userID, err)
+	data, err := eventFrame(json.RawMessage(payload), seq)
+	if err != nil {
+		return err
+	}
+
+	err = c.send(ctx, userID, data)
+	if errors.Is(err, errNoConnection) && logErr == nil {
+		return nil
+	}
+	return err
+}
+
+// SendEphemeral writes notif in an event frame to the sockets of the user
+// without logging it, for signals that are worthless once missed.
+func (c *Connector) SendEphemeral(userID uint64, notif any) error {
+	data, err := eventFrame(notif, 0)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message to user %d: %w", userID, err)
+	}
+	return c.send(context.Background(), userID, data)
+}
+
+// send writes a frame to the sockets of the user on every node. Sockets of
+// this node are written directly, other nodes get it through their Redis
+// channel.
+func (c *Connector) send(ctx context.Context, userID uint64, data []byte) error {
+	nodes, err := c.nodes(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("%w %d", errNoConnection, userID)
+	}
+
+	var lastErr error
+	delivered := 0
+	for node := range nodes {
+		if node == c.nodeID {
+			err = c.deliver(userID, data)
+		} else {
+			err = c.publish(ctx, node, delivery{Data: data, UserID: userID})
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		delivered++
+	}
+	if delivered == 0 {
+		return lastErr
 	}
 	return nil
 }
 
-func (c *Connector) ReplaceClient(userID uint64, newConn *websocket.Conn) error {
-	c.ClientsMutex.Lock()
-	defer c.ClientsMutex.Unlock()
+// nodes returns the nodes the user has live sockets on. Sockets whose key
+// expired are removed from the user's presence on the way.
+func (c *Connector) nodes(ctx context.Context, userID uint64) (map[string]struct{}, error) {
+	members, err := c.redisConn.SMembers(ctx, userKey(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sockets of user %d: %w", userID, err)
+	}
+	nodes := make(map[string]struct{}, len(members))
+	for _, m := range members {
+		node, socketID, ok := strings.Cut(m, ":")
+		if !ok {
+			continue
+		}
 
-	if oldConn, ok := c.Clients[userID]; ok && oldConn != nil {
-		if err := oldConn.Close(); err != nil {
-			return fmt.Errorf("failed to close old connection for user %d: %w", userID, err)
+		live, err := c.redisConn.IsExists(ctx, socketKey(socketID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to check socket %s of user %d: %w", socketID, userID, err)
+		}
+		if !live {
+			if err := c.redisConn.SRem(ctx, userKey(userID), m); err != nil {
+				return nil, fmt.Errorf("failed to prune socket %s of user %d: %w", socketID, userID, err)
+			}
+			continue
 		}
+		nodes[node] = struct{}{}
 	}
+	return nodes, nil
+}
 
-	c.Clients[userID] = newConn
+func (c *Connector) publish(ctx context.Context, node string, d delivery) error {
+	msg, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to marshal delivery to user %d: %w", d.UserID, err)
+	}
+	if err := c.redisConn.Publish(ctx, NodeChannelPrefix+node, msg); err != nil {
+		return fmt.Errorf("failed to publish to node %s: %w", node, err)
+	}
 	return nil
 }
 
+// deliver queues data on the sockets of the user on this node, or of every
+// user when userID is 0. A socket whose queue is full is a slow consumer and
+// is evicted; deliver only fails when no socket got the message.
+func (c *Connector) deliver(userID uint64, data []byte) error {
+	sockets := c.sockets(userID)
+	if len(sockets) == 0 {
+		return fmt.Errorf("no connection for user %d on node %s", userID, c.nodeID)
+	}
+
+	var lastErr error
+	delivered := 0
+	for _, client := range sockets {
+		if !client.enqueue(data) {
+			lastErr = fmt.Errorf("socket %s of user %d is not keeping up", client.ID, client.UserID)
+			log.Printf("[WS] Evicting slow socket %s of user %d", client.ID, client.UserID)
+			if err := c.CloseSocket(context.Background(), client.UserID, client.ID); err != nil {
+				log.Printf("Error closing socket %s of user %d: %v", client.ID, client.UserID, err)
+			}
+			continue
+		}
+		delivered++
+	}
+	if delivered == 0 {
+		return lastErr
+	}
+	return nil
+}
+
+// reply queues a frame on one socket, evicting it when it is not keeping up.
+func (c *Connector) reply(client *Client, env Envelope) {
+	data, err := json.Marshal(env)
+	if err != nil {
+		log.Printf("[WS] Failed to marshal %s frame: %v", env.Type, err)
+		return
+	}
+	if client.enqueue(data) {
+		return
+	}
+
+	log.Printf("[WS] Evicting slow socket %s of user %d", client.ID, client.UserID)
+	if err := c.CloseSocket(context.Background(), client.UserID, client.ID); err != nil {
+		log.Printf("Error closing socket %s of user %d: %v", client.ID, client.UserID, err)
+	}
+}
+
+// IsUserOnline tells whether the user has a live socket on any node.
 func (c *Connector) IsUserOnline(ctx context.Context, id uint64) (bool, error) {
-	exists, err := c.redisConn.IsExists(ctx, fmt.Sprintf("%s%d", UserKeyPrefix, id))
+	nodes, err := c.nodes(ctx, id)
 	if err != nil {
 		return false, fmt.Errorf("redis error: %w", err)
 	}
-	return exists, nil
+	return len(nodes) > 0, nil
+}
+
+func userKey(userID uint64) string {
+	return fmt.Sprintf("%s%d", UserKeyPrefix, userID)
+}
+
+func (c *Connector) member(socketID string) string {
+	return c.nodeID + ":" + socketID
+}
+
+func socketKey(socketID string) string {
+	return SocketKeyPrefix + socketID
 }
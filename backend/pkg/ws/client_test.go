@@ -0,0 +1,166 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/websocket"
+	"social-app/internal/config"
+	"social-app/internal/connector"
+)
+
+// newTestRedis starts a miniredis for the test.
+func newTestRedis(t *testing.T) (*connector.RedisConnector, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	host, port, _ := net.SplitHostPort(mr.Addr())
+	p, _ := strconv.Atoi(port)
+	return connector.NewRedisConnector(config.Redis{Host: host, Port: p}), mr
+}
+
+// connectTest registers a socket without a connection, as ConnectClient
+// would.
+func connectTest(t *testing.T, c *Connector, userID uint64, sessionID string) *Client {
+	t.Helper()
+
+	client := newClient(nil, "socket-"+sessionID+"-"+c.nodeID[:8], sessionID, userID, nil)
+	c.addClient(client)
+	if err := c.register(context.Background(), client); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	return client
+}
+
+func closed(client *Client) bool {
+	select {
+	case <-client.done:
+		return true
+	case <-time.After(2 * time.Second):
+		return false
+	}
+}
+
+func TestCloseSessionOnEveryNode(t *testing.T) {
+	rc, _ := newTestRedis(t)
+	nodeA, nodeB := NewConnector(rc), NewConnector(rc)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	NewBroadcaster(nodeB).Start(ctx)
+	// Start subscribes before returning, but let the subscription settle.
+	time.Sleep(50 * time.Millisecond)
+
+	onA := connectTest(t, nodeA, 1, "s1")
+	onB := connectTest(t, nodeB, 1, "s1")
+	otherSession := connectTest(t, nodeB, 1, "s2")
+
+	if err := nodeA.CloseSession(context.Background(), 1, "s1"); err != nil {
+		t.Fatalf("CloseSession failed: %v", err)
+	}
+
+	if !closed(onA) {
+		t.Error("Expected the socket of node A to be closed")
+	}
+	if !closed(onB) {
+		t.Error("Expected the socket of node B to be closed")
+	}
+	select {
+	case <-otherSession.done:
+		t.Error("Expected the socket of another session to stay open")
+	default:
+	}
+
+	if err := nodeA.CloseClient(context.Background(), 1); err != nil {
+		t.Fatalf("CloseClient failed: %v", err)
+	}
+	if !closed(otherSession) {
+		t.Error("Expected CloseClient to close the sockets of node B")
+	}
+
+	// The presence of the user goes away with the last socket.
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if online, _ := nodeA.IsUserOnline(context.Background(), 1); !online {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected the user to be offline once every socket is closed")
+}
+
+func TestConnectClientClosesOnRegisterError(t *testing.T) {
+	rc, mr := newTestRedis(t)
+	c := NewConnector(rc)
+	mr.Close()
+
+	errs := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := c.ConnectClient(r, w, 1, "s1", nil)
+		errs <- err
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	if err := <-errs; err == nil {
+		t.Fatal("Expected ConnectClient to fail without Redis")
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Error("Expected the socket to be closed")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Error("Expected the socket to be closed, it was left open")
+	}
+
+	c.ClientsMutex.RLock()
+	defer c.ClientsMutex.RUnlock()
+	if len(c.Clients) != 0 {
+		t.Errorf("Expected no socket left, got %d users", len(c.Clients))
+	}
+}
+
+func TestStaleSocketsArePruned(t *testing.T) {
+	rc, mr := newTestRedis(t)
+	c := NewConnector(rc)
+	ctx := context.Background()
+
+	// A node that went away left a socket of each user behind; its key has
+	// expired but the member is still in the set.
+	connectTest(t, c, 1, "s1")
+	for _, user := range []string{"1", "2"} {
+		if _, err := mr.SAdd(UserKeyPrefix+user, "dead-node:dead-socket"); err != nil {
+			t.Fatalf("SAdd failed: %v", err)
+		}
+	}
+
+	nodes, err := c.nodes(ctx, 1)
+	if err != nil {
+		t.Fatalf("nodes failed: %v", err)
+	}
+	if _, ok := nodes["dead-node"]; ok || len(nodes) != 1 {
+		t.Errorf("Expected only the live node, got %v", nodes)
+	}
+	if members, _ := mr.Members(UserKeyPrefix + "1"); len(members) != 1 {
+		t.Errorf("Expected the stale socket to be pruned, got %v", members)
+	}
+
+	if online, err := c.IsUserOnline(ctx, 2); err != nil || online {
+		t.Errorf("Expected a user with only stale sockets to be offline, got %v, %v", online, err)
+	}
+	if err := c.send(ctx, 2, []byte(`{}`)); !errors.Is(err, errNoConnection) {
+		t.Errorf("Expected no connection for a user with only stale sockets, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// EventStreamPrefix is followed by a user ID: a Redis stream of the
+	// user's events, each under the ID "<seq>-0".
+	EventStreamPrefix = "ws:events:"
+	// EventSeqPrefix is followed by a user ID: the last sequence number given
+	// to an event of the user.
+	EventSeqPrefix = "ws:seq:"
+
+	// eventLogMaxLen is how many events a log keeps, and eventLogTTL how long
+	// it lives without new events.
+	eventLogMaxLen = 1000
+	eventLogTTL    = 24 * time.Hour
+	// maxReplay is the largest gap a resume replays. Beyond it the client is
+	// told to resync from the REST API instead.
+	maxReplay = 500
+)
+
+// logEvent adds the payload of an event to the user's log and returns its
+// sequence number.
+func (c *Connector) logEvent(ctx context.Context, userID uint64, payload []byte) (int64, error) {
+	id := strconv.FormatUint(userID, 10)
+	return c.redisConn.AppendSeq(ctx, EventStreamPrefix+id, EventSeqPrefix+id, eventLogMaxLen, eventLogTTL, payload)
+}
+
+// replay queues on the socket the events of its user numbered after lastSeq.
+// When some of them are no longer in the log, or there are too many, nothing
+// is replayed and the ack asks for a full resync. Live events are held
+// meanwhile and follow the replay, but for those it covered.
+func (c *Connector) replay(ctx context.Context, client *Client, lastSeq int64) (ResumeAck, error) {
+	hold := client.hold()
+
+	ack, frames, err := c.missed(ctx, client.UserID, lastSeq)
+	if err != nil {
+		client.release(hold, 0)
+		return ResumeAck{}, err
+	}
+	for _, data := range frames {
+		if !client.enqueueWait(data, writeWait) {
+			client.release(hold, 0)
+			return ResumeAck{}, fmt.Errorf("socket %s of user %d is not keeping up with the replay", client.ID, client.UserID)
+		}
+	}
+	if !client.release(hold, ack.Seq) {
+		return ResumeAck{}, fmt.Errorf("socket %s of user %d is not keeping up with the replay", client.ID, client.UserID)
+	}
+	return ack, nil
+}
+
+// missed returns the event frames of the user numbered after lastSeq, and
+// the ack of their replay. When some of them are no longer in the log, or
+// there are too many, there are none and the ack asks for a full resync.
+func (c *Connector) missed(ctx context.Context, userID uint64, lastSeq int64) (ResumeAck, [][]byte, error) {
+	id := strconv.FormatUint(userID, 10)
+
+	raw, err := c.redisConn.Get(ctx, EventSeqPrefix+id)
+	if err != nil {
+		return ResumeAck{}, nil, err
+	}
+	var latest int64
+	if raw != "" {
+		if latest, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return ResumeAck{}, nil, fmt.Errorf("invalid sequence number %q for user %d: %w", raw, userID, err)
+		}
+	}
+
+	switch {
+	case lastSeq == latest:
+		return ResumeAck{Seq: latest}, nil, nil
+	case lastSeq > latest, latest-lastSeq > maxReplay:
+		// A sequence number ahead of the log means the log expired and
+		// started over.
+		return ResumeAck{Seq: latest, ResyncRequired: true}, nil, nil
+	}
+
+	entries, err := c.redisConn.XRange(ctx, EventStreamPrefix+id, fmt.Sprintf("%d-0", lastSeq+1), "+", maxReplay)
+	if err != nil {
+		return ResumeAck{}, nil, err
+	}
+	if len(entries) == 0 || entrySeq(entries[0].ID) != lastSeq+1 {
+		return ResumeAck{Seq: latest, ResyncRequired: true}, nil, nil
+	}
+
+	ack := ResumeAck{Seq: lastSeq}
+	frames := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		payload, _ := entry.Values["data"].(string)
+		seq := entrySeq(entry.ID)
+
+		data, err := eventFrame(json.RawMessage(payload), seq)
+		if err != nil {
+			return ResumeAck{}, nil, err
+		}
+		frames = append(frames, data)
+		ack.Seq = seq
+		ack.Replayed++
+	}
+	return ack, frames, nil
+}
+
+// entrySeq reads the sequence number of a stream entry ID "<seq>-0".
+func entrySeq(id string) int64 {
+	ms, _, _ := strings.Cut(id, "-")
+	seq, _ := strconv.ParseInt(ms, 10, 64)
+	return seq
+}
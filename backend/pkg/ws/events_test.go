@@ -0,0 +1,149 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestEntrySeq(t *testing.T) {
+	tests := map[string]int64{
+		"1-0":    1,
+		"4242-0": 4242,
+		"bad":    0,
+	}
+	for id, want := range tests {
+		if got := entrySeq(id); got != want {
+			t.Errorf("entrySeq(%q) = %d, expected %d", id, got, want)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	rc, mr := newTestRedis(t)
+	c := NewConnector(rc)
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		if _, err := c.logEvent(ctx, 1, []byte(fmt.Sprintf(`{"n":%d}`, i))); err != nil {
+			t.Fatalf("logEvent failed: %v", err)
+		}
+	}
+
+	t.Run("gap", func(t *testing.T) {
+		client := newClient(nil, "socket", "", 1, nil)
+		ack, err := c.replay(ctx, client, 1)
+		if err != nil {
+			t.Fatalf("replay failed: %v", err)
+		}
+		if ack != (ResumeAck{Seq: 3, Replayed: 2}) {
+			t.Fatalf("Unexpected ack %+v", ack)
+		}
+		for _, want := range []int64{2, 3} {
+			var env Envelope
+			if err := json.Unmarshal(<-client.send, &env); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if env.Type != TypeEvent || env.Seq != want || string(env.Payload) != fmt.Sprintf(`{"n":%d}`, want) {
+				t.Errorf("Unexpected frame %+v, expected event %d", env, want)
+			}
+		}
+	})
+
+	t.Run("up to date", func(t *testing.T) {
+		client := newClient(nil, "socket", "", 1, nil)
+		ack, err := c.replay(ctx, client, 3)
+		if err != nil || ack != (ResumeAck{Seq: 3}) || len(client.send) != 0 {
+			t.Errorf("Expected nothing to replay, got %+v, %v", ack, err)
+		}
+	})
+
+	t.Run("ahead of log", func(t *testing.T) {
+		// The log expired and started over since the client saw seq 10.
+		client := newClient(nil, "socket", "", 1, nil)
+		ack, err := c.replay(ctx, client, 10)
+		if err != nil || ack != (ResumeAck{Seq: 3, ResyncRequired: true}) || len(client.send) != 0 {
+			t.Errorf("Expected a resync, got %+v, %v", ack, err)
+		}
+	})
+
+	t.Run("trimmed", func(t *testing.T) {
+		// Only events 4 and 5 are left of user 2's log.
+		for _, seq := range []string{"4-0", "5-0"} {
+			if _, err := mr.XAdd(EventStreamPrefix+"2", seq, []string{"data", "{}"}); err != nil {
+				t.Fatalf("XAdd failed: %v", err)
+			}
+		}
+		if err := mr.Set(EventSeqPrefix+"2", "5"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+
+		client := newClient(nil, "socket", "", 2, nil)
+		ack, err := c.replay(ctx, client, 1)
+		if err != nil || ack != (ResumeAck{Seq: 5, ResyncRequired: true}) || len(client.send) != 0 {
+			t.Errorf("Expected a resync, got %+v, %v", ack, err)
+		}
+	})
+
+	t.Run("too far behind", func(t *testing.T) {
+		if err := mr.Set(EventSeqPrefix+"3", strconv.Itoa(maxReplay+2)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+
+		client := newClient(nil, "socket", "", 3, nil)
+		ack, err := c.replay(ctx, client, 1)
+		if err != nil || ack != (ResumeAck{Seq: maxReplay + 2, ResyncRequired: true}) || len(client.send) != 0 {
+			t.Errorf("Expected a resync, got %+v, %v", ack, err)
+		}
+	})
+}
+
+func TestReplayHoldsLiveEvents(t *testing.T) {
+	rc, _ := newTestRedis(t)
+	c := NewConnector(rc)
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		if _, err := c.logEvent(ctx, 1, []byte(`{}`)); err != nil {
+			t.Fatalf("logEvent failed: %v", err)
+		}
+	}
+	live := func(seq int64) []byte {
+		data, err := eventFrame(map[string]string{}, seq)
+		if err != nil {
+			t.Fatalf("eventFrame failed: %v", err)
+		}
+		return data
+	}
+
+	// Events 2 to 4 arrive live between the connection and the resume from
+	// seq 1; event 4 was logged after the replay read the log.
+	client := newClient(nil, "socket", "", 1, nil)
+	connected := client.hold()
+	for _, seq := range []int64{2, 3, 0, 4} {
+		if !client.enqueue(live(seq)) {
+			t.Fatalf("enqueue of event %d failed", seq)
+		}
+	}
+
+	ack, err := c.replay(ctx, client, 1)
+	if err != nil || ack != (ResumeAck{Seq: 3, Replayed: 2}) {
+		t.Fatalf("Unexpected ack %+v, %v", ack, err)
+	}
+
+	// The stale hold of the connection changes nothing, and a late live
+	// copy of a replayed event is dropped.
+	if !client.release(connected, 0) || !client.enqueue(live(3)) || !client.enqueue(live(5)) {
+		t.Fatal("Expected the socket to keep up")
+	}
+
+	var got []int64
+	for len(client.send) > 0 {
+		got = append(got, frameSeq(<-client.send))
+	}
+	if fmt.Sprint(got) != fmt.Sprint([]int64{0, 2, 3, 4, 5}) {
+		t.Errorf("Expected events 0, 2, 3, 4, 5 in order, got %v", got)
+	}
+}
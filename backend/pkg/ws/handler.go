@@ -3,118 +3,410 @@ package ws
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"social-app/docs"
 	"social-app/internal/models"
 	"social-app/pkg/middleware"
+	"social-app/pkg/rbac"
 )
 
 type Handler struct {
 	conn *Connector
+	chat ChatSender
 }
 
-func NewHandler(c *Connector) Handler {
+func NewHandler(c *Connector, cs ChatSender) Handler {
 	return Handler{
 		conn: c,
+		chat: cs,
 	}
 }
 
+// Schema godoc
+// @Summary      Websocket protocol schema
+// @Description  JSON schema of the frames exchanged over /ws
+// @Tags         ws
+// @Produce      json
+// @Success      200 {object} map[string]interface{} "JSON schema"
+// @Router       /ws/schema.json [get]
+func (h Handler) Schema(c *gin.Context) {
+	c.Data(http.StatusOK, "application/schema+json", docs.WSSchema)
+}
+
 func (h Handler) HandleWebSocket(c *middleware.Context) {
 	userID := c.User.ID
 
-	conn, _, err := h.conn.ConnectClient(c.Request, c.Writer, userID)
+	client, err := h.conn.ConnectClient(c.Request, c.Writer, userID, c.Token.SessionID, c.Permissions)
 	if err != nil {
+		// The upgrade has answered the request, or the connection is hijacked
+		// and closed: nothing can be written back.
 		log.Printf("[WS] Failed to connect user %d: %v", userID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "WebSocket failed"})
 		return
 	}
 
+	h.sendHello(client, "")
+
 	ctx, cancel := context.WithCancel(c.Request.Context())
 	defer cancel()
 
 	defer func() {
-		err := h.conn.CloseClient(c.Request.Context(), userID)
+		err := h.conn.CloseSocket(context.Background(), userID, client.ID)
 		if err != nil {
-			log.Printf("[WS] Error closing connection for user %d: %v", userID, err)
+			log.Printf("[WS] Error closing socket %s of user %d: %v", client.ID, userID, err)
 		}
 	}()
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf("[WS] Context done, closing connection for user %d", userID)
+			log.Printf("[WS] Context done, closing socket %s of user %d", client.ID, userID)
 			return
 		default:
-			if conn == nil {
-				log.Printf("[WS] Connection for user %d is nil, reconnecting...", userID)
-				var sID string
-				conn, sID, err = h.conn.ConnectClient(c.Request, c.Writer, userID)
-				if err != nil {
-					log.Printf("[WS] Reconnect error for user %d: %v", userID, err)
-					break
-				}
-				log.Printf("[WS] User %d reconnected with socket ID %s", userID, sID)
+			if err := h.readAndDispatch(client); err != nil {
+				log.Printf("[WS] Read error on socket %s of user %d: %v", client.ID, userID, err)
+				return
 			}
+		}
+	}
+}
+
+// Events godoc
+// @Summary      Stream notifications
+// @Description  Server-Sent Events fallback for /ws, for clients whose proxy breaks websockets. Streams the event frames delivered to the user, each logged one with its seq as event ID. With Last-Event-ID, or last_event_id on a first connection, the events missed since that seq are replayed first; when they are gone a "resync" event asks the client to reload.
+// @Tags         ws
+// @Produce      text/event-stream
+// @Param        Last-Event-ID header string false "Last seq received"
+// @Param        last_event_id query string false "Last seq received, when the header cannot be set"
+// @Success      200 {string} string "Event stream"
+// @Failure      400 {object} map[string]string
+// @Failure      500 {object} map[string]string
+// @Router       /events [get]
+func (h Handler) Events(c *middleware.Context) {
+	userID := c.User.ID
+
+	lastSeq, resume, err := lastEventID(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-			if err := h.readAndDispatch(userID); err != nil {
-				log.Printf("[WS] Read error for user %d: %v", userID, err)
+	client, err := h.conn.ConnectStream(c.Request.Context(), userID, c.Token.SessionID, c.Permissions)
+	if err != nil {
+		log.Printf("[SSE] Failed to connect user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Event stream failed"})
+		return
+	}
+
+	defer func() {
+		err := h.conn.CloseSocket(context.Background(), userID, client.ID)
+		if err != nil {
+			log.Printf("[SSE] Error closing stream %s of user %d: %v", client.ID, userID, err)
+		}
+	}()
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Writer.WriteHeader(http.StatusOK)
+
+	// The server write timeout is meant for requests, not streams: every
+	// write gets its own deadline instead.
+	rc := http.NewResponseController(c.Writer)
+	flush := func(write func() error) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := write(); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	if err := flush(func() error { return writeHeartbeat(c.Writer) }); err != nil {
+		log.Printf("[SSE] Write error on stream %s of user %d: %v", client.ID, userID, err)
+		return
+	}
+
+	// The missed events are written before any live one. The live events
+	// queued meanwhile that the replay covered are dropped.
+	var replayed int64
+	if resume {
+		frames, seq, err := h.resumeStream(c.Request.Context(), client, lastSeq)
+		if err != nil {
+			log.Printf("[SSE] Failed to replay events of user %d: %v", userID, err)
+			return
+		}
+		for _, data := range frames {
+			if err := flush(func() error { return writeEvent(c.Writer, data) }); err != nil {
+				log.Printf("[SSE] Write error on stream %s of user %d: %v", client.ID, userID, err)
 				return
 			}
 		}
+		replayed = seq
+	}
+
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-client.done:
+			return
+		case data := <-client.send:
+			if seq := frameSeq(data); seq > 0 && seq <= replayed {
+				continue
+			}
+			if err := flush(func() error { return writeEvent(c.Writer, data) }); err != nil {
+				log.Printf("[SSE] Write error on stream %s of user %d: %v", client.ID, userID, err)
+				return
+			}
+		case <-ticker.C:
+			if err := flush(func() error { return writeHeartbeat(c.Writer) }); err != nil {
+				log.Printf("[SSE] Write error on stream %s of user %d: %v", client.ID, userID, err)
+				return
+			}
+			h.conn.touch(client)
+		}
 	}
 }
 
-func (h Handler) readAndDispatch(senderID uint64) error {
-	_, raw, err := h.conn.Clients[senderID].ReadMessage()
+// resumeStream returns the frames a stream starts with when it resumes from
+// lastSeq: the events it missed, or a resync frame when they are lost. seq is
+// the last event they account for.
+func (h Handler) resumeStream(ctx context.Context, client *Client, lastSeq int64) (frames [][]byte, seq int64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, writeWait)
+	defer cancel()
+
+	ack, frames, err := h.conn.missed(ctx, client.UserID, lastSeq)
 	if err != nil {
-		if websocket.IsCloseError(err, websocket.CloseAbnormalClosure) {
-			return nil
-		}
+		return nil, 0, err
+	}
+	if !ack.ResyncRequired {
+		return frames, ack.Seq, nil
+	}
 
-		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+	env, err := newEnvelope(TypeResync, "", ack)
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to marshal %s frame: %w", env.Type, err)
+	}
+	return [][]byte{data}, ack.Seq, nil
+}
+
+// readAndDispatch reads one frame and answers it: an ack when it was handled
+// and carries an ID, an error frame when it was refused. Only read errors
+// end the socket.
+func (h Handler) readAndDispatch(client *Client) error {
+	senderID := client.UserID
+	_, raw, err := client.Conn.ReadMessage()
+	if err != nil {
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 			return fmt.Errorf("connection closed by user %d: %w", senderID, err)
 		}
 
 		return fmt.Errorf("read error: %w", err)
 	}
 
-	var msg WSMessage
-	if err := json.Unmarshal(raw, &msg); err != nil {
+	var env Envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
 		log.Printf("[WS] Invalid JSON from user %d: %s", senderID, string(raw))
-		return fmt.Errorf("invalid JSON: %w", err)
+		h.sendError(client, "", frameError(CodeInvalidFrame, "frame is not a JSON envelope"))
+		return nil
 	}
 
-	msg.SenderID = senderID
+	ack, err := h.dispatchMessage(client, env)
+	if err != nil {
+		var fe *FrameError
+		if !errors.As(err, &fe) {
+			log.Printf("[WS] Failed to handle '%s' frame from user %d: %v", env.Type, senderID, err)
+			fe = frameError(CodeInternal, "frame could not be handled")
+		}
+		h.sendError(client, env.ID, fe)
+		return nil
+	}
 
-	return h.dispatchMessage(msg)
+	if env.ID != "" && env.Type != TypeHello {
+		h.sendAck(client, env.ID, ack)
+	}
+	return nil
 }
 
-func (h Handler) dispatchMessage(msg WSMessage) error {
-	switch msg.Type {
-	case TypeTyping, TypeSeen, TypeMessage:
-		return h.handleSignalMessage(msg)
+// dispatchMessage handles a client frame and returns the payload of its ack,
+// if any.
+func (h Handler) dispatchMessage(client *Client, env Envelope) (any, error) {
+	if env.V != ProtocolVersion {
+		return nil, frameError(CodeUnsupportedVersion, "protocol version %d is not supported, expected %d", env.V, ProtocolVersion)
+	}
+	if len(env.ID) > maxFrameIDLength {
+		return nil, frameError(CodeInvalidFrame, "id is longer than %d characters", maxFrameIDLength)
+	}
+
+	switch env.Type {
+	case TypeHello:
+		return nil, h.handleHello(client, env)
+	case TypeTyping, TypeSeen:
+		return nil, h.handleSignalMessage(client, env)
+	case TypeMessage:
+		return h.handleChatMessage(client, env)
+	case TypeResume:
+		return h.handleResume(client, env)
+	case TypeSubscribe, TypeUnsubscribe:
+		return h.handleSubscription(client, env)
 	default:
-		log.Printf("[WS] Unhandled message type '%s' from user %d", msg.Type, msg.SenderID)
-		return nil
+		log.Printf("[WS] Unhandled message type '%s' from user %d", env.Type, client.UserID)
+		return nil, frameError(CodeUnknownType, "unknown frame type %q", env.Type)
 	}
 }
 
-func (h Handler) handleSignalMessage(msg WSMessage) error {
-	if msg.ReceiverID == 0 {
-		log.Printf("[WS] Missing receiver_id in '%s' message from user %d", msg.Type, msg.SenderID)
-		return nil
+// handleHello answers the hello of a client with the hello of the server,
+// sent under the same ID.
+func (h Handler) handleHello(client *Client, env Envelope) error {
+	var hello Hello
+	if len(env.Payload) > 0 {
+		if err := json.Unmarshal(env.Payload, &hello); err != nil {
+			return frameError(CodeInvalidPayload, "invalid hello payload")
+		}
+	}
+	if hello.Version != 0 && hello.Version != ProtocolVersion {
+		return frameError(CodeUnsupportedVersion, "protocol version %d is not supported, expected %d", hello.Version, ProtocolVersion)
+	}
+
+	h.sendHello(client, env.ID)
+	return nil
+}
+
+func (h Handler) handleSignalMessage(client *Client, env Envelope) error {
+	var signal Signal
+	if err := json.Unmarshal(env.Payload, &signal); err != nil {
+		return frameError(CodeInvalidPayload, "invalid %s payload", env.Type)
+	}
+	if signal.ReceiverID == 0 {
+		return frameError(CodeInvalidPayload, "receiver_id is required")
 	}
 
 	notification := models.Notification{
-		UserID:     msg.SenderID,
-		Type:       models.NotificationType(msg.Type),
-		ReceiverID: msg.ReceiverID,
-		Content:    fmt.Sprintf("User %d sent signal: %s", msg.SenderID, msg.Type),
+		UserID:     client.UserID,
+		Type:       models.NotificationType(env.Type),
+		ReceiverID: signal.ReceiverID,
+		Content:    fmt.Sprintf("User %d sent signal: %s", client.UserID, env.Type),
+	}
+
+	if err := h.conn.SendEphemeral(signal.ReceiverID, notification); err != nil {
+		log.Printf("[WS] Failed to relay '%s' from user %d to user %d: %v", env.Type, client.UserID, signal.ReceiverID, err)
+		return frameError(CodeNotDelivered, "receiver is not connected")
+	}
+	return nil
+}
+
+// handleChatMessage stores and delivers a chat message like POST /messages.
+func (h Handler) handleChatMessage(client *Client, env Envelope) (any, error) {
+	if !rbac.Has(client.Permissions, rbac.ChatWrite) {
+		return nil, frameError(CodeForbidden, "missing permission %s", rbac.ChatWrite)
+	}
+
+	var msg ChatMessage
+	if err := json.Unmarshal(env.Payload, &msg); err != nil {
+		return nil, frameError(CodeInvalidPayload, "invalid message payload")
+	}
+	if msg.IdempotencyKey == "" {
+		msg.IdempotencyKey = env.ID
+	}
+	if len(msg.IdempotencyKey) > maxFrameIDLength {
+		return nil, frameError(CodeInvalidPayload, "idempotency_key is longer than %d characters", maxFrameIDLength)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeWait)
+	defer cancel()
+
+	id, err := h.chat.SendChatMessage(ctx, client.UserID, msg)
+	if err != nil {
+		if errors.Is(err, ErrInvalidMessage) {
+			return nil, frameError(CodeInvalidPayload, "%v", err)
+		}
+		return nil, err
+	}
+	return ChatAck{MessageID: id}, nil
+}
+
+// handleResume queues the events the client missed, before acking.
+func (h Handler) handleResume(client *Client, env Envelope) (any, error) {
+	var resume Resume
+	if err := json.Unmarshal(env.Payload, &resume); err != nil || resume.LastSeq < 0 {
+		return nil, frameError(CodeInvalidPayload, "invalid resume payload")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeWait)
+	defer cancel()
+
+	return h.conn.replay(ctx, client, resume.LastSeq)
+}
+
+// handleSubscription changes the topics of the socket. A subscribe frame is
+// refused as a whole when one of its topics is.
+func (h Handler) handleSubscription(client *Client, env Envelope) (any, error) {
+	var sub Subscription
+	if err := json.Unmarshal(env.Payload, &sub); err != nil || len(sub.Topics) == 0 {
+		return nil, frameError(CodeInvalidPayload, "invalid %s payload", env.Type)
+	}
+
+	if env.Type == TypeUnsubscribe {
+		return SubscriptionAck{Topics: client.unsubscribe(sub.Topics)}, nil
+	}
+
+	for _, topic := range sub.Topics {
+		if fe := checkTopic(client, topic); fe != nil {
+			return nil, fe
+		}
+	}
+	topics, err := client.subscribe(sub.Topics)
+	if err != nil {
+		return nil, err
+	}
+	return SubscriptionAck{Topics: topics}, nil
+}
+
+func (h Handler) sendHello(client *Client, id string) {
+	env, err := newEnvelope(TypeHello, id, Hello{
+		SocketID:     client.ID,
+		Capabilities: capabilities(),
+		Version:      ProtocolVersion,
+	})
+	if err != nil {
+		log.Printf("[WS] %v", err)
+		return
 	}
+	h.conn.reply(client, env)
+}
+
+func (h Handler) sendAck(client *Client, id string, payload any) {
+	env, err := newEnvelope(TypeAck, id, payload)
+	if err != nil {
+		log.Printf("[WS] %v", err)
+		return
+	}
+	h.conn.reply(client, env)
+}
+
+func (h Handler) sendError(client *Client, id string, fe *FrameError) {
+	env, err := newEnvelope(TypeError, id, fe)
+	if err != nil {
+		log.Printf("[WS] %v", err)
+		return
+	}
+	h.conn.reply(client, env)
+}
 
-	return h.conn.Send(msg.ReceiverID, notification)
+func capabilities() []string {
+	return []string{CapabilityAcks, CapabilitySignals, CapabilityChat, CapabilityResume, CapabilityTopics}
 }
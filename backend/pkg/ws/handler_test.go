@@ -0,0 +1,97 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"social-app/pkg/rbac"
+)
+
+func TestDispatchRefusedFrames(t *testing.T) {
+	h := NewHandler(nil, nil)
+	client := newClient(nil, "socket", "", 1, nil)
+
+	tests := []struct {
+		name string
+		env  Envelope
+		code ErrorCode
+	}{
+		{"missing version", Envelope{Type: TypeTyping}, CodeUnsupportedVersion},
+		{"future version", Envelope{Type: TypeTyping, V: ProtocolVersion + 1}, CodeUnsupportedVersion},
+		{"unknown type", Envelope{Type: "shout", V: ProtocolVersion}, CodeUnknownType},
+		{"long id", Envelope{Type: TypeTyping, ID: string(make([]byte, maxFrameIDLength+1)), V: ProtocolVersion}, CodeInvalidFrame},
+		{"no payload", Envelope{Type: TypeSeen, V: ProtocolVersion}, CodeInvalidPayload},
+		{"no receiver", Envelope{Type: TypeTyping, V: ProtocolVersion, Payload: json.RawMessage(`{"data":{}}`)}, CodeInvalidPayload},
+		{"message without chat:write", Envelope{Type: TypeMessage, V: ProtocolVersion, Payload: json.RawMessage(`{"receiver_id":2,"content":"hi"}`)}, CodeForbidden},
+		{"negative resume", Envelope{Type: TypeResume, V: ProtocolVersion, Payload: json.RawMessage(`{"last_seq":-1}`)}, CodeInvalidPayload},
+		{"subscribe without topics", Envelope{Type: TypeSubscribe, V: ProtocolVersion, Payload: json.RawMessage(`{"topics":[]}`)}, CodeInvalidPayload},
+		{"subscribe to another conversation", Envelope{Type: TypeSubscribe, V: ProtocolVersion, Payload: json.RawMessage(`{"topics":["post:1","chat:2:3"]}`)}, CodeForbidden},
+		{"hello of another version", Envelope{Type: TypeHello, V: ProtocolVersion, Payload: json.RawMessage(`{"version":2}`)}, CodeUnsupportedVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.dispatchMessage(client, tt.env)
+			var fe *FrameError
+			if !errors.As(err, &fe) {
+				t.Fatalf("Expected a frame error, got %v", err)
+			}
+			if fe.Code != tt.code {
+				t.Errorf("Expected code %s, got %s", tt.code, fe.Code)
+			}
+		})
+	}
+}
+
+func TestEventFrame(t *testing.T) {
+	data, err := eventFrame(map[string]string{"message": "hi"}, 7)
+	if err != nil {
+		t.Fatalf("eventFrame failed: %v", err)
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if env.V != ProtocolVersion || env.Type != TypeEvent || env.Seq != 7 || string(env.Payload) != `{"message":"hi"}` {
+		t.Errorf("Unexpected event frame %s", data)
+	}
+}
+
+type fakeChat struct {
+	got ChatMessage
+	err error
+}
+
+func (f *fakeChat) SendChatMessage(ctx context.Context, senderID uint64, msg ChatMessage) (uint64, error) {
+	f.got = msg
+	return 42, f.err
+}
+
+func TestDispatchChatMessage(t *testing.T) {
+	chat := &fakeChat{}
+	h := NewHandler(nil, chat)
+	client := newClient(nil, "socket", "", 1, []string{rbac.ChatWrite})
+
+	env := Envelope{Type: TypeMessage, ID: "frame-1", V: ProtocolVersion, Payload: json.RawMessage(`{"receiver_id":2,"content":"hi"}`)}
+	ack, err := h.dispatchMessage(client, env)
+	if err != nil {
+		t.Fatalf("dispatchMessage failed: %v", err)
+	}
+	if ack != (ChatAck{MessageID: 42}) {
+		t.Errorf("Expected the ack to carry the stored ID, got %v", ack)
+	}
+	if chat.got.IdempotencyKey != "frame-1" {
+		t.Errorf("Expected the frame ID as idempotency key, got %q", chat.got.IdempotencyKey)
+	}
+
+	chat.err = fmt.Errorf("%w: empty", ErrInvalidMessage)
+	_, err = h.dispatchMessage(client, env)
+	var fe *FrameError
+	if !errors.As(err, &fe) || fe.Code != CodeInvalidPayload {
+		t.Errorf("Expected an invalid_payload error, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package ws
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait bounds every write, so a stuck peer cannot hold its pump.
+	writeWait = 10 * time.Second
+	// pongWait is how long a socket may stay silent before it is dropped.
+	// Pings go out often enough for a live peer to answer in time.
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	// maxMessageSize is the largest frame read from a client.
+	maxMessageSize = 64 << 10
+	// sendBufferSize is how many messages may wait for a socket. A client
+	// that lets it fill up is too slow to keep and is evicted.
+	sendBufferSize = 64
+	// resumeWait is how long a new socket holds its logged events for the
+	// resume frame that clients send right after the hello.
+	resumeWait = 5 * time.Second
+)
+
+// Client is one websocket of a user. A user has one per open tab or device.
+// An event stream is a Client without Conn, written by its handler.
+// Only its write pump writes to Conn, as gorilla/websocket allows a single
+// writer; everyone else queues messages with enqueue.
+// Permissions are those of the token the socket was opened with, topics
+// those it subscribed to.
+// While the socket resumes, its logged events are held so that they follow
+// the replay; replayed is the last seq a replay covered, whose live copies
+// are dropped.
+type Client struct {
+	Conn        *websocket.Conn
+	send        chan []byte
+	done        chan struct{}
+	topics      map[string]struct{}
+	ID          string
+	SessionID   string
+	held        [][]byte
+	Permissions []string
+	holds       int
+	replayed    int64
+	topicsMu    sync.Mutex
+	seqMu       sync.Mutex
+	closeOnce   sync.Once
+	holding     bool
+	UserID      uint64
+}
+
+func newClient(conn *websocket.Conn, id, sessionID string, userID uint64, perms []string) *Client {
+	return &Client{
+		Conn:        conn,
+		send:        make(chan []byte, sendBufferSize),
+		done:        make(chan struct{}),
+		topics:      make(map[string]struct{}),
+		ID:          id,
+		SessionID:   sessionID,
+		Permissions: perms,
+		UserID:      userID,
+	}
+}
+
+// enqueue queues data for the write pump without blocking. It returns false
+// when the socket is closed or its queue is full. Logged events are held
+// while the socket resumes, and dropped when its replay covered them.
+func (cl *Client) enqueue(data []byte) bool {
+	select {
+	case <-cl.done:
+		return false
+	default:
+	}
+
+	if seq := frameSeq(data); seq > 0 {
+		cl.seqMu.Lock()
+		defer cl.seqMu.Unlock()
+
+		if seq <= cl.replayed {
+			return true
+		}
+		if cl.holding {
+			if len(cl.held) >= sendBufferSize {
+				return false
+			}
+			cl.held = append(cl.held, data)
+			return true
+		}
+	}
+
+	select {
+	case cl.send <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueueWait queues data for the write pump, waiting up to timeout for room
+// in the queue. It is meant for bursts such as a replay, where dropping the
+// socket at the first full queue would be too eager.
+func (cl *Client) enqueueWait(data []byte, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-cl.done:
+		return false
+	default:
+	}
+
+	select {
+	case cl.send <- data:
+		return true
+	case <-cl.done:
+		return false
+	case <-timer.C:
+		return false
+	}
+}
+
+// hold starts holding the logged events of the socket, and returns the hold
+// to give to release.
+func (cl *Client) hold() int {
+	cl.seqMu.Lock()
+	defer cl.seqMu.Unlock()
+
+	cl.holds++
+	cl.holding = true
+	return cl.holds
+}
+
+// release ends the hold once a replay covered the events up to seq, or
+// with seq 0 when nothing was replayed. The events held meanwhile are
+// queued, but for those the replay covered. A hold that a later one
+// replaced is left alone. It returns false when the queue is full.
+func (cl *Client) release(hold int, seq int64) bool {
+	cl.seqMu.Lock()
+	defer cl.seqMu.Unlock()
+
+	if hold != cl.holds || !cl.holding {
+		return true
+	}
+	if seq > cl.replayed {
+		cl.replayed = seq
+	}
+	held := cl.held
+	cl.held = nil
+	cl.holding = false
+
+	for _, data := range held {
+		if frameSeq(data) <= cl.replayed {
+			continue
+		}
+		select {
+		case cl.send <- data:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// writePump writes queued messages and pings until the socket is closed or
+// a write fails. A failed write closes the connection, which ends the read
+// loop of the socket and with it the socket itself.
+func (cl *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cl.done:
+			_ = cl.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+			return
+		case data := <-cl.send:
+			_ = cl.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := cl.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Printf("[WS] Write error on socket %s of user %d: %v", cl.ID, cl.UserID, err)
+				_ = cl.Conn.Close()
+				return
+			}
+		case <-ticker.C:
+			if err := cl.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				log.Printf("[WS] Ping error on socket %s of user %d: %v", cl.ID, cl.UserID, err)
+				_ = cl.Conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// close stops the write pump and closes the connection. It is safe to call
+// more than once.
+func (cl *Client) close() error {
+	var err error
+	cl.closeOnce.Do(func() {
+		close(cl.done)
+		if cl.Conn != nil {
+			err = cl.Conn.Close()
+		}
+	})
+	return err
+}
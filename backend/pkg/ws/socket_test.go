@@ -0,0 +1,73 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestEnqueueFullQueue(t *testing.T) {
+	cl := newClient(nil, "socket", "", 1, nil)
+
+	for i := 0; i < sendBufferSize; i++ {
+		if !cl.enqueue([]byte("x")) {
+			t.Fatalf("Expected message %d to be queued", i)
+		}
+	}
+	if cl.enqueue([]byte("x")) {
+		t.Error("Expected a full queue to refuse the message")
+	}
+}
+
+func TestWritePump(t *testing.T) {
+	clients := make(chan *Client, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade failed: %v", err)
+			return
+		}
+		cl := newClient(conn, "socket", "", 1, nil)
+		go cl.writePump()
+		clients <- cl
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	cl := <-clients
+	for _, msg := range []string{"first", "second"} {
+		if !cl.enqueue([]byte(msg)) {
+			t.Fatalf("Expected %q to be queued", msg)
+		}
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, want := range []string{"first", "second"} {
+		_, got, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage failed: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+
+	if err := cl.close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if cl.enqueue([]byte("late")) {
+		t.Error("Expected a closed socket to refuse messages")
+	}
+	if err := cl.close(); err != nil {
+		t.Errorf("Expected a second close to be a no-op, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ConnectStream registers a Server-Sent Events stream of the user. It gets
+// what Send and NotifyAll deliver, like a websocket, but has no write pump:
+// the caller writes what is queued with writeEvent.
+func (c *Connector) ConnectStream(ctx context.Context, userID uint64, sessionID string, perms []string) (*Client, error) {
+	client := newClient(nil, uuid.NewString(), sessionID, userID, perms)
+	c.addClient(client)
+
+	if err := c.register(ctx, client); err != nil {
+		if closeErr := c.CloseSocket(context.Background(), userID, client.ID); closeErr != nil {
+			return nil, fmt.Errorf("%w (close error: %v)", err, closeErr)
+		}
+		return nil, err
+	}
+	return client, nil
+}
+
+// lastEventID reads the sequence number an event stream resumes from: the
+// Last-Event-ID header the browser sends when it reconnects, or the
+// last_event_id query parameter of a first connection. ok is false when
+// neither is set.
+func lastEventID(r *http.Request) (seq int64, ok bool, err error) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	if raw == "" {
+		return 0, false, nil
+	}
+
+	seq, err = strconv.ParseInt(raw, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, false, fmt.Errorf("invalid last event ID %q", raw)
+	}
+	return seq, true, nil
+}
+
+// writeEvent writes a frame as a Server-Sent Event. Event frames go out as
+// unnamed events with their seq as ID, so the browser resumes from it; other
+// frames are named after their type. The data is the frame itself.
+func writeEvent(w io.Writer, data []byte) error {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return fmt.Errorf("invalid frame: %w", err)
+	}
+
+	var err error
+	switch {
+	case env.Type != TypeEvent:
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", env.Type, data)
+	case env.Seq > 0:
+		_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", env.Seq, data)
+	default:
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	return err
+}
+
+// writeHeartbeat writes an SSE comment, which keeps proxies from closing an
+// idle stream.
+func writeHeartbeat(w io.Writer) error {
+	_, err := fmt.Fprintf(w, ": ping %d\n\n", time.Now().Unix())
+	return err
+}
@@ -0,0 +1,123 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLastEventID(t *testing.T) {
+	tests := []struct {
+		query, header string
+		seq           int64
+		ok, err       bool
+	}{
+		{"", "", 0, false, false},
+		{"", "12", 12, true, false},
+		{"?last_event_id=7", "", 7, true, false},
+		{"?last_event_id=7", "12", 12, true, false},
+		{"", "abc", 0, false, true},
+		{"?last_event_id=-1", "", 0, false, true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/events"+tt.query, nil)
+		if tt.header != "" {
+			r.Header.Set("Last-Event-ID", tt.header)
+		}
+		seq, ok, err := lastEventID(r)
+		if seq != tt.seq || ok != tt.ok || (err != nil) != tt.err {
+			t.Errorf("lastEventID(%q, %q) = %d, %v, %v", tt.query, tt.header, seq, ok, err)
+		}
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	logged, _ := eventFrame(map[string]string{"message": "hi"}, 3)
+	ephemeral, _ := eventFrame(map[string]string{"message": "hi"}, 0)
+	resync := []byte(`{"payload":{"seq":9,"replayed":0,"resync_required":true},"type":"resync","v":1}`)
+
+	tests := map[string]struct {
+		frame []byte
+		want  string
+	}{
+		"logged event":    {logged, "id: 3\ndata: " + string(logged) + "\n\n"},
+		"ephemeral event": {ephemeral, "data: " + string(ephemeral) + "\n\n"},
+		"resync":          {resync, "event: resync\ndata: " + string(resync) + "\n\n"},
+	}
+
+	for name, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeEvent(&buf, tt.frame); err != nil {
+			t.Fatalf("%s: writeEvent failed: %v", name, err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s: expected %q, got %q", name, tt.want, buf.String())
+		}
+	}
+
+	if err := writeEvent(&bytes.Buffer{}, []byte("not json")); err == nil {
+		t.Error("Expected an invalid frame to be refused")
+	}
+}
+
+func TestFrameSeq(t *testing.T) {
+	logged, _ := eventFrame(map[string]string{"message": "hi"}, 3)
+	ephemeral, _ := eventFrame(map[string]string{"message": "hi"}, 0)
+	resync := []byte(`{"payload":{"seq":9,"replayed":0,"resync_required":true},"type":"resync","v":1}`)
+
+	for frame, want := range map[string]int64{string(logged): 3, string(ephemeral): 0, string(resync): 0} {
+		if got := frameSeq([]byte(frame)); got != want {
+			t.Errorf("frameSeq(%s) = %d, expected %d", frame, got, want)
+		}
+	}
+}
+
+func TestResumeStream(t *testing.T) {
+	rc, _ := newTestRedis(t)
+	c := NewConnector(rc)
+	h := NewHandler(c, nil)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.logEvent(ctx, 1, []byte(`{}`)); err != nil {
+			t.Fatalf("logEvent failed: %v", err)
+		}
+	}
+
+	// An event logged while the stream connects is queued live, and is also
+	// part of the replay.
+	client, err := c.ConnectStream(ctx, 1, "s1", nil)
+	if err != nil {
+		t.Fatalf("ConnectStream failed: %v", err)
+	}
+	if err := c.Send(1, map[string]string{"message": "hi"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	frames, seq, err := h.resumeStream(ctx, client, 1)
+	if err != nil {
+		t.Fatalf("resumeStream failed: %v", err)
+	}
+	if seq != 4 || len(frames) != 3 {
+		t.Fatalf("Expected events 2 to 4, got %d frames up to %d", len(frames), seq)
+	}
+	for i, data := range frames {
+		if got := frameSeq(data); got != int64(i+2) {
+			t.Errorf("Expected frame %d to be event %d, got %d", i, i+2, got)
+		}
+	}
+	if live := frameSeq(<-client.send); live > seq {
+		t.Errorf("Expected the live event to be covered by the replay, got %d", live)
+	}
+
+	frames, seq, err = h.resumeStream(ctx, client, 10)
+	if err != nil {
+		t.Fatalf("resumeStream failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if len(frames) != 1 || seq != 4 || writeEvent(&buf, frames[0]) != nil || !bytes.HasPrefix(buf.Bytes(), []byte("event: resync\n")) {
+		t.Errorf("Expected a resync frame, got %q up to %d", frames, seq)
+	}
+}
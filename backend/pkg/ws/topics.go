@@ -0,0 +1,201 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"social-app/pkg/rbac"
+)
+
+const (
+	// TopicChannel carries the events published to topics. Every node gets
+	// them all and keeps those its sockets subscribed to.
+	TopicChannel = "ws:topics"
+
+	// maxTopics bounds the subscriptions of one socket.
+	maxTopics = 100
+)
+
+// Kinds of topic, the part of a topic name before the first colon.
+const (
+	TopicPost = "post"
+	TopicUser = "user"
+	TopicChat = "chat"
+)
+
+// Types of the events published to topics.
+const (
+	EventPostCreated    = "post_created"
+	EventCommentCreated = "comment_created"
+	EventMessageCreated = "message_created"
+)
+
+// PostTopic is the comment thread of a post.
+func PostTopic(postID uint64) string {
+	return fmt.Sprintf("%s:%d", TopicPost, postID)
+}
+
+// UserTopic is the profile feed of a user: the posts they publish.
+func UserTopic(userID uint64) string {
+	return fmt.Sprintf("%s:%d", TopicUser, userID)
+}
+
+// ChatTopic is the conversation between two users. It is the same topic
+// whichever way round the users are given.
+func ChatTopic(userID, otherID uint64) string {
+	return fmt.Sprintf("%s:%d:%d", TopicChat, min(userID, otherID), max(userID, otherID))
+}
+
+// TopicEvent is the payload of the event frames published to a topic.
+type TopicEvent struct {
+	Data  any    `json:"data"`
+	Topic string `json:"topic"`
+	Type  string `json:"type"`
+}
+
+// topicMessage is what a node publishes on TopicChannel.
+type topicMessage struct {
+	Data  json.RawMessage `json:"data"`
+	Topic string          `json:"topic"`
+}
+
+// parseTopic checks the name of a topic and returns its kind and IDs.
+func parseTopic(topic string) (string, []uint64, error) {
+	kind, rest, ok := strings.Cut(topic, ":")
+	if !ok {
+		return "", nil, fmt.Errorf("invalid topic %q", topic)
+	}
+
+	want := 1
+	switch kind {
+	case TopicPost, TopicUser:
+	case TopicChat:
+		want = 2
+	default:
+		return "", nil, fmt.Errorf("unknown topic kind %q", kind)
+	}
+
+	parts := strings.Split(rest, ":")
+	if len(parts) != want {
+		return "", nil, fmt.Errorf("invalid topic %q", topic)
+	}
+	ids := make([]uint64, 0, len(parts))
+	for _, p := range parts {
+		id, err := strconv.ParseUint(p, 10, 64)
+		if err != nil || id == 0 || strconv.FormatUint(id, 10) != p {
+			return "", nil, fmt.Errorf("invalid topic %q", topic)
+		}
+		ids = append(ids, id)
+	}
+	return kind, ids, nil
+}
+
+// checkTopic tells whether the client may subscribe to the topic. Posts and
+// profiles are public; a conversation is only open to its two users.
+func checkTopic(client *Client, topic string) *FrameError {
+	kind, ids, err := parseTopic(topic)
+	if err != nil {
+		return frameError(CodeInvalidPayload, "%v", err)
+	}
+	if kind != TopicChat {
+		return nil
+	}
+	if !rbac.Has(client.Permissions, rbac.ChatRead) {
+		return frameError(CodeForbidden, "missing permission %s", rbac.ChatRead)
+	}
+	if topic != ChatTopic(ids[0], ids[1]) || !slices.Contains(ids, client.UserID) {
+		return frameError(CodeForbidden, "not a participant of %s", topic)
+	}
+	return nil
+}
+
+// subscribe adds topics to the subscriptions of the socket and returns them
+// all.
+func (cl *Client) subscribe(topics []string) ([]string, error) {
+	cl.topicsMu.Lock()
+	defer cl.topicsMu.Unlock()
+
+	added := 0
+	for _, t := range topics {
+		if _, ok := cl.topics[t]; !ok {
+			added++
+		}
+	}
+	if len(cl.topics)+added > maxTopics {
+		return nil, frameError(CodeInvalidPayload, "a socket may subscribe to %d topics at most", maxTopics)
+	}
+
+	for _, t := range topics {
+		cl.topics[t] = struct{}{}
+	}
+	return cl.subscriptions(), nil
+}
+
+// unsubscribe removes topics from the subscriptions of the socket and returns
+// those left.
+func (cl *Client) unsubscribe(topics []string) []string {
+	cl.topicsMu.Lock()
+	defer cl.topicsMu.Unlock()
+
+	for _, t := range topics {
+		delete(cl.topics, t)
+	}
+	return cl.subscriptions()
+}
+
+// subscriptions lists the topics of the socket, sorted. topicsMu is held.
+func (cl *Client) subscriptions() []string {
+	out := make([]string, 0, len(cl.topics))
+	for t := range cl.topics {
+		out = append(out, t)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func (cl *Client) subscribed(topic string) bool {
+	cl.topicsMu.Lock()
+	defer cl.topicsMu.Unlock()
+
+	_, ok := cl.topics[topic]
+	return ok
+}
+
+// publishTopic sends an event frame to the sockets subscribed to the topic,
+// on every node. Topic events are not logged: they are not replayed on
+// resume.
+func (c *Connector) publishTopic(ctx context.Context, topic, eventType string, data any) error {
+	frame, err := eventFrame(TopicEvent{Data: data, Topic: topic, Type: eventType}, 0)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event for %s: %w", eventType, topic, err)
+	}
+
+	msg, err := json.Marshal(topicMessage{Data: frame, Topic: topic})
+	if err != nil {
+		return fmt.Errorf("failed to marshal topic message for %s: %w", topic, err)
+	}
+	if err := c.redisConn.Publish(ctx, TopicChannel, msg); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// deliverTopic queues data on the sockets of this node subscribed to topic.
+func (c *Connector) deliverTopic(topic string, data []byte) {
+	for _, client := range c.sockets(0) {
+		if !client.subscribed(topic) {
+			continue
+		}
+		if !client.enqueue(data) {
+			log.Printf("[WS] Evicting slow socket %s of user %d", client.ID, client.UserID)
+			if err := c.CloseSocket(context.Background(), client.UserID, client.ID); err != nil {
+				log.Printf("Error closing socket %s of user %d: %v", client.ID, client.UserID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package ws
+
+import (
+	"fmt"
+	"testing"
+
+	"social-app/pkg/rbac"
+)
+
+func TestChatTopic(t *testing.T) {
+	if ChatTopic(7, 3) != "chat:3:7" || ChatTopic(3, 7) != "chat:3:7" {
+		t.Errorf("Expected chat:3:7 both ways, got %s and %s", ChatTopic(7, 3), ChatTopic(3, 7))
+	}
+}
+
+func TestCheckTopic(t *testing.T) {
+	client := newClient(nil, "socket", "", 3, []string{rbac.ChatRead})
+	reader := newClient(nil, "socket", "", 3, nil)
+
+	tests := []struct {
+		client *Client
+		topic  string
+		code   ErrorCode
+	}{
+		{client, "post:12", ""},
+		{client, "user:5", ""},
+		{client, "chat:3:7", ""},
+		{client, "chat:7:3", CodeForbidden},
+		{client, "chat:5:7", CodeForbidden},
+		{reader, "chat:3:7", CodeForbidden},
+		{client, "post", CodeInvalidPayload},
+		{client, "post:0", CodeInvalidPayload},
+		{client, "post:012", CodeInvalidPayload},
+		{client, "post:1:2", CodeInvalidPayload},
+		{client, "chat:3", CodeInvalidPayload},
+		{client, "group:1", CodeInvalidPayload},
+	}
+
+	for _, tt := range tests {
+		fe := checkTopic(tt.client, tt.topic)
+		switch {
+		case tt.code == "" && fe != nil:
+			t.Errorf("Expected %s to be allowed, got %v", tt.topic, fe)
+		case tt.code != "" && (fe == nil || fe.Code != tt.code):
+			t.Errorf("Expected %s to be refused with %s, got %v", tt.topic, tt.code, fe)
+		}
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	client := newClient(nil, "socket", "", 1, nil)
+
+	topics, err := client.subscribe([]string{"user:2", "post:1", "user:2"})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	if fmt.Sprint(topics) != "[post:1 user:2]" {
+		t.Errorf("Unexpected subscriptions %v", topics)
+	}
+	if !client.subscribed("post:1") || client.subscribed("post:2") {
+		t.Error("subscribed does not match the subscriptions")
+	}
+
+	if topics := client.unsubscribe([]string{"post:1", "post:9"}); fmt.Sprint(topics) != "[user:2]" {
+		t.Errorf("Unexpected subscriptions after unsubscribe %v", topics)
+	}
+
+	many := make([]string, maxTopics)
+	for i := range many {
+		many[i] = PostTopic(uint64(i + 1))
+	}
+	if _, err := client.subscribe(many); err == nil {
+		t.Errorf("Expected more than %d topics to be refused", maxTopics)
+	}
+}
@@ -1,17 +1,193 @@
 package ws
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ProtocolVersion is the version of the frame envelope. Frames with another
+// version are refused with CodeUnsupportedVersion.
+const ProtocolVersion = 1
+
+// maxFrameIDLength bounds the message IDs chosen by clients.
+const maxFrameIDLength = 64
+
 type MessageType string
 
+// Frames sent by clients. TypeHello is also the first frame the server sends
+// on every socket. TypeMessage sends a chat message, acked with the ID it was
+// stored under. TypeResume replays the events missed since a sequence number.
+// TypeSubscribe and TypeUnsubscribe choose the topics the socket gets the
+// events of.
+const (
+	TypeHello       MessageType = "hello"
+	TypeTyping      MessageType = "typing"
+	TypeSeen        MessageType = "seen"
+	TypeMessage     MessageType = "message"
+	TypeResume      MessageType = "resume"
+	TypeSubscribe   MessageType = "subscribe"
+	TypeUnsubscribe MessageType = "unsubscribe"
+)
+
+// Frames sent by the server. TypeAck and TypeError answer the client frame
+// with the same ID; TypeEvent carries notifications. TypeResync only goes out
+// on event streams, which have no resume ack: its payload is a ResumeAck
+// asking for a full resync.
+const (
+	TypeAck    MessageType = "ack"
+	TypeError  MessageType = "error"
+	TypeEvent  MessageType = "event"
+	TypeResync MessageType = "resync"
+)
+
+// Capabilities advertised in the hello frame of the server.
 const (
-	TypeTyping  MessageType = "typing"
-	TypeSeen    MessageType = "seen"
-	TypeMessage MessageType = "message"
+	CapabilityAcks    = "acks"
+	CapabilitySignals = "signals"
+	CapabilityChat    = "chat"
+	CapabilityResume  = "resume"
+	CapabilityTopics  = "topics"
 )
 
-type WSMessage struct {
-	Payload    map[string]any `json:"payload,omitempty"`
-	Type       MessageType    `json:"type"`
-	UserID     uint64         `json:"user_id"`
-	SenderID   uint64         `json:"sender_id"`
+// Envelope is every frame exchanged over the websocket, in both directions.
+// ID is chosen by the client so it can match the ack or error of its frame.
+// Seq numbers the events of the user's event log, see TypeResume.
+type Envelope struct {
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Type    MessageType     `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Seq     int64           `json:"seq,omitempty"`
+	V       int             `json:"v"`
+}
+
+type Hello struct {
+	SocketID     string   `json:"socket_id,omitempty"`
+	Capabilities []string `json:"capabilities"`
+	Version      int      `json:"version"`
+}
+
+// Signal is the payload of typing and seen frames, relayed to the receiver
+// as a notification.
+type Signal struct {
+	Data       map[string]any `json:"data,omitempty"`
 	ReceiverID uint64         `json:"receiver_id"`
 }
+
+// ChatMessage is the payload of a message frame. IdempotencyKey defaults to
+// the frame ID, so resending the same frame after a reconnect stores the
+// message once.
+type ChatMessage struct {
+	Content        string `json:"content"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	ReceiverID     uint64 `json:"receiver_id"`
+}
+
+// ChatAck is the payload of the ack of a message frame.
+type ChatAck struct {
+	MessageID uint64 `json:"message_id"`
+}
+
+// Resume is the payload of a resume frame: the last sequence number the
+// client received.
+type Resume struct {
+	LastSeq int64 `json:"last_seq"`
+}
+
+// ResumeAck is the payload of the ack of a resume frame, sent once the missed
+// events are queued. When ResyncRequired is set nothing was replayed: the
+// client has to reload its state and carry on from Seq.
+type ResumeAck struct {
+	Seq            int64 `json:"seq"`
+	Replayed       int   `json:"replayed"`
+	ResyncRequired bool  `json:"resync_required,omitempty"`
+}
+
+// Subscription is the payload of subscribe and unsubscribe frames.
+type Subscription struct {
+	Topics []string `json:"topics"`
+}
+
+// SubscriptionAck is the payload of their ack: every topic the socket is now
+// subscribed to.
+type SubscriptionAck struct {
+	Topics []string `json:"topics"`
+}
+
+// ErrInvalidMessage is wrapped by ChatSender errors about the message
+// itself rather than about storing it.
+var ErrInvalidMessage = errors.New("invalid chat message")
+
+// ChatSender stores a chat message sent over the websocket, delivers it to
+// the receiver and returns its ID.
+type ChatSender interface {
+	SendChatMessage(ctx context.Context, senderID uint64, msg ChatMessage) (uint64, error)
+}
+
+type ErrorCode string
+
+const (
+	CodeInvalidFrame       ErrorCode = "invalid_frame"
+	CodeUnsupportedVersion ErrorCode = "unsupported_version"
+	CodeUnknownType        ErrorCode = "unknown_type"
+	CodeInvalidPayload     ErrorCode = "invalid_payload"
+	CodeNotDelivered       ErrorCode = "not_delivered"
+	CodeForbidden          ErrorCode = "forbidden"
+	CodeInternal           ErrorCode = "internal_error"
+)
+
+// FrameError is the payload of an error frame, and the error handlers return
+// to refuse a client frame.
+type FrameError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func frameError(code ErrorCode, format string, args ...any) *FrameError {
+	return &FrameError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// newEnvelope builds a server frame around payload.
+func newEnvelope(typ MessageType, id string, payload any) (Envelope, error) {
+	env := Envelope{Type: typ, ID: id, V: ProtocolVersion}
+	if payload == nil {
+		return env, nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("failed to marshal %s payload: %w", typ, err)
+	}
+	env.Payload = data
+	return env, nil
+}
+
+// eventFrame wraps a notification into an event frame. seq is its number in
+// the user's event log, or 0 for events that are not logged.
+func eventFrame(payload any, seq int64) ([]byte, error) {
+	env, err := newEnvelope(TypeEvent, "", payload)
+	if err != nil {
+		return nil, err
+	}
+	env.Seq = seq
+	data, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return data, nil
+}
+
+// frameSeq returns the seq of an event frame, 0 for other frames and events
+// that are not logged.
+func frameSeq(data []byte) int64 {
+	var env struct {
+		Seq int64 `json:"seq"`
+	}
+	_ = json.Unmarshal(data, &env)
+	return env.Seq
+}
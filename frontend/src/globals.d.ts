@@ -3,5 +3,6 @@ export {}
 declare global {
   interface Window {
     ws: WebSocket | null
+    events: EventSource | null
   }
 }
@@ -4,67 +4,285 @@ import { Notification } from '@/types'
 import { useChatStore } from '@/stores/chat'
 
 const reconnectDelay = 2000
+const maxWsFailures = 3
+let wsFailures = 0
+const protocolVersion = 1
 let typingTimeout = 0
+let frameCounter = 0
 
-export function initNotificationSocket(): void {
-  const auth = useAuthStore()
+export interface Frame {
+  v: number
+  type: string
+  id?: string
+  seq?: number
+  payload?: any
+}
+
+// Events logged by the server carry a seq, counted per user. The last one
+// seen is kept across reloads, under the user's ID, so a new socket can ask
+// for what it missed.
+const seenSeqs = new Set<number>()
+
+function lastSeqKey(): string | null {
+  const id = useAuthStore().user?.id
+  return id ? `ws_last_seq:${id}` : null
+}
 
+function getLastSeq(): number {
+  const key = lastSeqKey()
+  return key ? Number(localStorage.getItem(key)) || 0 : 0
+}
+
+function setLastSeq(seq: number): void {
+  const key = lastSeqKey()
+  if (key && seq > getLastSeq()) localStorage.setItem(key, String(seq))
+}
+
+// Topic subscriptions of the page, kept across reconnects: post:<id> is the
+// comment thread of a post, user:<id> the posts of a user.
+export interface TopicEvent {
+  topic: string
+  type: string
+  data: any
+}
+
+const topicHandlers = new Map<string, Set<(event: TopicEvent) => void>>()
+
+// subscribeTopic calls handler with the events of the topic, and returns the
+// function that stops it.
+export function subscribeTopic(topic: string, handler: (event: TopicEvent) => void): () => void {
+  let handlers = topicHandlers.get(topic)
+  if (!handlers) {
+    handlers = new Set()
+    topicHandlers.set(topic, handlers)
+    request('subscribe', { topics: [topic] }).catch((err) => console.warn('WebSocket subscribe failed', topic, err))
+  }
+  handlers.add(handler)
+
+  return (): void => {
+    handlers.delete(handler)
+    if (handlers.size > 0 || topicHandlers.get(topic) !== handlers) return
+    topicHandlers.delete(topic)
+    sendFrame('unsubscribe', { topics: [topic] })
+  }
+}
+
+function resubscribe(): void {
+  if (topicHandlers.size === 0) return
+  request('subscribe', { topics: [...topicHandlers.keys()] }).catch((err) =>
+    console.warn('WebSocket subscribe failed', err)
+  )
+}
+
+function resync(seq: number): void {
+  const key = lastSeqKey()
+  if (key) localStorage.setItem(key, String(seq || 0))
+  useNotificationStore().fetchNotifications()
+  window.dispatchEvent(new CustomEvent('ws:resync'))
+}
+
+// resume asks the server for the events logged since the last one seen. When
+// too many were lost, the state is reloaded from the API instead.
+function resume(): void {
+  request('resume', { last_seq: getLastSeq() })
+    .then((ack) => {
+      if (ack.resync_required) resync(ack.seq)
+    })
+    .catch((err) => console.warn('WebSocket resume failed', err))
+}
+
+const ackTimeout = 10000
+const pending = new Map<string, { resolve: (payload: any) => void; reject: (err: any) => void }>()
+
+export function newFrameId(): string {
+  frameCounter += 1
+  return `${Date.now().toString(36)}-${frameCounter}-${Math.random().toString(36).slice(2, 8)}`
+}
+
+// sendFrame wraps a payload in a protocol envelope. The returned id is echoed
+// back by the server in the ack or error frame answering it.
+export function sendFrame(type: string, payload?: any, id: string = newFrameId()): string | null {
+  if (!window.ws || window.ws.readyState !== WebSocket.OPEN) return null
+
+  const frame: Frame = { v: protocolVersion, type, id, payload }
+  window.ws.send(JSON.stringify(frame))
+  return id
+}
+
+// request sends a frame and resolves with the payload of its ack, or rejects
+// with the payload of its error frame.
+export function request(type: string, payload?: any, id: string = newFrameId()): Promise<any> {
+  return new Promise((resolve, reject) => {
+    if (!sendFrame(type, payload, id)) {
+      reject(new Error('WebSocket not connected'))
+      return
+    }
+    pending.set(id, { resolve, reject })
+    window.setTimeout(() => {
+      if (pending.delete(id)) reject(new Error('WebSocket ack timeout'))
+    }, ackTimeout)
+  })
+}
+
+// handleEvent dispatches an event frame, from the websocket or the event
+// stream.
+function handleEvent(frame: Frame): void {
   const chatStore = useChatStore()
 
-  const token = auth.getAccessToken()
-  if (!token) return
+  if (frame.type !== 'event' || !frame.payload) return
 
-  window.ws = new WebSocket('ws://localhost:3222/ws?token=' + token)
+  if (frame.payload.topic) {
+    const event = frame.payload as TopicEvent
+    topicHandlers.get(event.topic)?.forEach((handler) => handler(event))
+    return
+  }
 
-  window.ws.onmessage = (e): void => {
-    if (e?.data) {
-      const notif = JSON.parse(e.data)
-      if (!notif) return
+  if (frame.seq) {
+    // A live event may also come back in the replay of a resume.
+    if (seenSeqs.has(frame.seq)) return
+    seenSeqs.add(frame.seq)
+    setLastSeq(frame.seq)
+  }
 
-      const notification = notif as Notification
-      notification.timestamp = notif.timestamp || new Date().toISOString()
+  const notif = frame.payload
+  const notification = notif as Notification
+  notification.timestamp = notif.timestamp || new Date().toISOString()
 
-      if (notification.type === 'ping') {
-        if (!window.ws || window.ws.readyState !== 1) return
-        window.ws.send(JSON.stringify({ type: 'pong' }))
-        return
-      }
+  if (notification.type === 'message') {
+    const payload = JSON.parse(notif.payload)
 
-      if (notification.type === 'message') {
-        const payload = JSON.parse(notif.payload)
+    chatStore.receiveMessage(payload)
 
-        chatStore.receiveMessage(payload)
+    window.dispatchEvent(new CustomEvent('chat:message', { detail: payload }))
+  }
 
-        window.dispatchEvent(new CustomEvent('chat:message', { detail: payload }))
-      }
+  if (notification.type === 'seen') {
+    chatStore.markAsRead(notification.receiver_id, notification.user_id)
+  }
 
-      if (notification.type === 'seen') {
-        chatStore.markAsRead(notification.receiver_id, notification.user_id)
+  if (notification.type === 'typing') {
+    if (notification.user_id === chatStore.currentReceiver) {
+      chatStore.setTyping(true)
+
+      if (typingTimeout) {
+        clearTimeout(typingTimeout)
       }
 
-      if (notification.type === 'typing') {
-        if (notification.user_id === chatStore.currentReceiver) {
-          chatStore.setTyping(true)
+      typingTimeout = window.setTimeout(() => {
+        chatStore.setTyping(false)
+      }, 3000)
+    }
+  }
 
-          if (typingTimeout) {
-            clearTimeout(typingTimeout)
-          }
+  const store = useNotificationStore()
+  store.receive(notification)
+}
 
-          typingTimeout = window.setTimeout(() => {
-            chatStore.setTyping(false)
-          }, 3000)
+export function initNotificationSocket(): void {
+  const auth = useAuthStore()
+
+  const token = auth.getAccessToken()
+  if (!token) return
+
+  if (window.events) return
+
+  const ws = new WebSocket('ws://localhost:3222/ws?token=' + token)
+  window.ws = ws
+  seenSeqs.clear()
+
+  let opened = false
+  ws.onopen = (): void => {
+    opened = true
+    wsFailures = 0
+  }
+
+  window.ws.onmessage = (e): void => {
+    if (e?.data) {
+      const frame = JSON.parse(e.data) as Frame
+      if (!frame || frame.v !== protocolVersion) return
+
+      if (frame.type === 'hello') {
+        // The server greets every new socket without an id; answer only that one.
+        if (!frame.id) {
+          sendFrame('hello', {
+            version: protocolVersion,
+            capabilities: ['acks', 'signals', 'chat', 'resume', 'topics']
+          })
+          resume()
+          resubscribe()
         }
+        return
       }
 
-      const store = useNotificationStore()
-      store.receive(notification)
+      if (frame.type === 'ack' || frame.type === 'error') {
+        const waiting = frame.id ? pending.get(frame.id) : undefined
+        if (waiting) {
+          pending.delete(frame.id as string)
+          if (frame.type === 'ack') waiting.resolve(frame.payload || {})
+          else waiting.reject(frame.payload)
+        } else if (frame.type === 'error') {
+          console.warn('WebSocket frame refused', frame.id, frame.payload)
+        }
+        return
+      }
+
+      if (frame.type === 'event') handleEvent(frame)
     }
   }
 
-  window.ws.onclose = (e) => {
+  ws.onclose = (): void => {
+    // A socket that never opens is likely cut by a proxy: after a few, fall
+    // back to the event stream.
+    if (!opened) wsFailures += 1
+    if (wsFailures >= maxWsFailures) {
+      console.log('WebSocket unavailable, falling back to Server-Sent Events')
+      window.ws = null
+      initEventStream()
+      return
+    }
     console.log('Disconnected. Reconnecting in', reconnectDelay, 'ms')
     setTimeout(initNotificationSocket, reconnectDelay)
   }
 
   console.log('✅ WebSocket connected')
 }
+
+// initEventStream listens to GET /events, which streams the same event frames
+// as the websocket. The browser reconnects on its own and resumes with
+// Last-Event-ID; the first connection resumes from the last seq seen. Frames
+// cannot be sent over it, so chat messages go through the REST API.
+function initEventStream(): void {
+  const auth = useAuthStore()
+
+  const token = auth.getAccessToken()
+  if (!token) return
+
+  seenSeqs.clear()
+  window.events = new EventSource(`/api/events?token=${token}&last_event_id=${getLastSeq()}`)
+
+  window.events.onmessage = (e): void => {
+    const frame = JSON.parse(e.data) as Frame
+    if (!frame || frame.v !== protocolVersion) return
+    if (frame.type === 'event') handleEvent(frame)
+  }
+
+  window.events.addEventListener('resync', (e: MessageEvent) => {
+    const frame = JSON.parse(e.data) as Frame
+    resync(frame.payload?.seq)
+  })
+
+  window.events.onerror = (): void => {
+    // Closed for good, e.g. on an expired token: start over.
+    if (window.events?.readyState !== EventSource.CLOSED) return
+    window.events = null
+    console.log('Event stream closed. Reconnecting in', reconnectDelay, 'ms')
+    setTimeout(initEventStream, reconnectDelay)
+  }
+
+  console.log('✅ Event stream connected')
+}
+
+export function closeEventStream(): void {
+  window.events?.close()
+  window.events = null
+}
@@ -35,8 +35,8 @@ export const routes: Readonly<RouteRecordRaw[]> = [
   { path: `/${routeNames.about}`, component: About },
   { path: `/${routeNames.login}`, component: Login },
   { path: `/${routeNames.register}`, component: Register },
-  { path: `/${routeNames.oauthLogin}`, component: OAuthLogin, meta: { requiresAuth: false } },
-  { path: `/${routeNames.oauthCallback}`, component: OAuthCallback, meta: { requiresAuth: false } },
+  { path: `/${routeNames.oauthLogin}/:provider?`, component: OAuthLogin, meta: { requiresAuth: false } },
+  { path: `/${routeNames.oauthCallback}/:provider?`, component: OAuthCallback, meta: { requiresAuth: false } },
   { path: `/${routeNames.feed}`, component: Feed, meta: { requiresAuth: true } },
   { path: `/${routeNames.chatList}`, component: ChatList, meta: { requiresAuth: true } },
   { path: `/${routeNames.chat}/:id`, component: Chat, meta: { requiresAuth: true } },
@@ -3,7 +3,7 @@ import { jwtDecode } from 'jwt-decode'
 import axios from 'axios'
 import router, { routeNames, routes } from '@/router'
 import { AuthHeader, JwtToken, JwtUser } from '@/types'
-import { initNotificationSocket } from '@/notifications/ws'
+import { closeEventStream, initNotificationSocket } from '@/notifications/ws'
 
 let expireInterval = null
 const accessTokenKey = 'access_token'
@@ -115,6 +115,7 @@ export const useAuthStore = defineStore('auth', {
         window.ws.close()
         window.ws = null
       }
+      closeEventStream()
     },
 
     getAuthHeader(type = 'access'): AuthHeader {